@@ -0,0 +1,182 @@
+/*
+Package dlog_apex provides apex/log functionality for dlog.
+
+https://github.com/apex/log
+*/
+package dlog_apex // import "go.pedge.io/dlog/apex"
+
+import (
+	"fmt"
+
+	"github.com/apex/log"
+	"go.pedge.io/dlog"
+)
+
+var (
+	levelToApexLevel = map[dlog.Level]log.Level{
+		dlog.LevelNone:  log.InfoLevel,
+		dlog.LevelTrace: log.DebugLevel,
+		dlog.LevelDebug: log.DebugLevel,
+		dlog.LevelInfo:  log.InfoLevel,
+		dlog.LevelWarn:  log.WarnLevel,
+		dlog.LevelError: log.ErrorLevel,
+		dlog.LevelFatal: log.FatalLevel,
+		dlog.LevelPanic: log.ErrorLevel,
+	}
+)
+
+func init() {
+	dlog.RegisterBackend(
+		"apex",
+		func() dlog.Logger {
+			return NewLogger(log.Log.(*log.Logger))
+		},
+	)
+}
+
+// Register registers the default apex Logger as the dlog Logger.
+//
+// This panics if log.Log was replaced with a log.Interface that is not a *log.Logger.
+func Register() {
+	dlog.SetLogger(NewLogger(log.Log.(*log.Logger)))
+}
+
+// NewLogger returns a new dlog.Logger that uses the *log.Logger.
+//
+// apex has no trace or panic level, so dlog.LevelTrace is logged at log.DebugLevel,
+// and dlog.LevelPanic at log.ErrorLevel before panicking. Custom Levels are logged at
+// the apex level for dlog.StandardLevel(level).
+//
+// AtLevel returns a dlog.Logger for a new *log.Logger with the same Handler, so the
+// level of the parent is unchanged.
+func NewLogger(apexLogger *log.Logger) dlog.Logger {
+	return &logger{apexLogger, log.Fields{}}
+}
+
+type logger struct {
+	l      *log.Logger
+	fields log.Fields
+}
+
+func (l *logger) Enabled(level dlog.Level) bool {
+	return levelToApexLevel[dlog.StandardLevel(level)] >= l.l.Level
+}
+
+func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
+	return &logger{
+		&log.Logger{
+			Handler: l.l.Handler,
+			Level:   levelToApexLevel[dlog.StandardLevel(level)],
+		},
+		l.fields,
+	}
+}
+
+func (l *logger) WithField(key string, value interface{}) dlog.Logger {
+	fields := l.copyFields(1)
+	fields[key] = value
+	return &logger{l.l, fields}
+}
+
+func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
+	newFields := l.copyFields(len(fields))
+	for key, value := range fields {
+		newFields[key] = value
+	}
+	return &logger{l.l, newFields}
+}
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	newFields := l.copyFields(len(fields))
+	for _, field := range fields {
+		newFields[field.Key] = field.Value()
+	}
+	return &logger{l.l, newFields}
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.entry().Debug(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.entry().Debug(fmt.Sprint(args...))
+}
+
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.entry().Debug(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Debugln(args ...interface{}) {
+	l.entry().Debug(fmt.Sprint(args...))
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.entry().Info(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Infoln(args ...interface{}) {
+	l.entry().Info(fmt.Sprint(args...))
+}
+
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.entry().Warn(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Warnln(args ...interface{}) {
+	l.entry().Warn(fmt.Sprint(args...))
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.entry().Error(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Errorln(args ...interface{}) {
+	l.entry().Error(fmt.Sprint(args...))
+}
+
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	// log.Entry.Fatal exits after logging
+	l.entry().Fatal(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Fatalln(args ...interface{}) {
+	l.entry().Fatal(fmt.Sprint(args...))
+}
+
+func (l *logger) Panicf(format string, args ...interface{}) {
+	l.entry().Error(fmt.Sprintf(format, args...))
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Panicln(args ...interface{}) {
+	l.entry().Error(fmt.Sprint(args...))
+	panic(fmt.Sprint(args...))
+}
+
+func (l *logger) Printf(format string, args ...interface{}) {
+	l.entry().Info(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Println(args ...interface{}) {
+	l.entry().Info(fmt.Sprint(args...))
+}
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	dlog.BaseLogf(l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	dlog.BaseLogln(l, level, args...)
+}
+
+func (l *logger) entry() *log.Entry {
+	return l.l.WithFields(l.fields)
+}
+
+func (l *logger) copyFields(extra int) log.Fields {
+	fields := make(log.Fields, len(l.fields)+extra)
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	return fields
+}
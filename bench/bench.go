@@ -0,0 +1,73 @@
+/*
+Package dlog_bench benchmarks the dlog Logger implementations against each other.
+
+	go test -run XXX -bench . -benchmem go.pedge.io/dlog/bench
+
+Every backend writes to ioutil.Discard except glog, which can only write to files
+or stderr, so glog is benchmarked writing to files in a temporary directory.
+*/
+package dlog_bench // import "go.pedge.io/dlog/bench"
+
+import (
+	"io"
+
+	"github.com/Sirupsen/logrus"
+	apexlog "github.com/apex/log"
+	apexjson "github.com/apex/log/handlers/json"
+	gokitlog "github.com/go-kit/log"
+	"github.com/hashicorp/go-hclog"
+	"github.com/inconshreveable/log15"
+	"github.com/rs/zerolog"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/apex"
+	"go.pedge.io/dlog/glog"
+	"go.pedge.io/dlog/gokit"
+	"go.pedge.io/dlog/hclog"
+	"go.pedge.io/dlog/lion"
+	"go.pedge.io/dlog/log15"
+	"go.pedge.io/dlog/logrus"
+	"go.pedge.io/dlog/zap"
+	"go.pedge.io/dlog/zerolog"
+	"go.pedge.io/lion"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger is a named dlog.Logger to benchmark.
+type Logger struct {
+	Name   string
+	Logger dlog.Logger
+}
+
+// NewLoggers returns a Logger for each backend at dlog.LevelInfo that writes to the io.Writer.
+//
+// glog does not support writing to an io.Writer, and uses its flags instead.
+func NewLoggers(writer io.Writer) []Logger {
+	logrusLogger := logrus.New()
+	logrusLogger.Out = writer
+	logrusLogger.Formatter = &logrus.JSONFormatter{}
+	logrusLogger.Level = logrus.InfoLevel
+	log15Logger := log15.New()
+	// not using AtLevel, which always writes to stdout
+	log15Logger.SetHandler(log15.LvlFilterHandler(log15.LvlInfo, log15.StreamHandler(writer, log15.JsonFormat())))
+	zapLogger := zap.New(
+		zapcore.NewCore(
+			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+			zapcore.AddSync(writer),
+			zapcore.InfoLevel,
+		),
+	)
+	return []Logger{
+		{"builtin", dlog.NewEncoderLogger(writer, dlog.NewJSONEncoder()).AtLevel(dlog.LevelInfo)},
+		{"apex", dlog_apex.NewLogger(&apexlog.Logger{Handler: apexjson.New(writer), Level: apexlog.InfoLevel})},
+		{"glog", dlog_glog.NewLogger().AtLevel(dlog.LevelInfo)},
+		{"gokit", dlog_gokit.NewLogger(gokitlog.NewJSONLogger(writer)).AtLevel(dlog.LevelInfo)},
+		{"hclog", dlog_hclog.NewLogger(hclog.New(&hclog.LoggerOptions{Output: writer, Level: hclog.Info, JSONFormat: true}))},
+		{"lion", dlog_lion.NewLogger(lion.NewLogger(lion.NewTextWritePusher(writer))).AtLevel(dlog.LevelInfo)},
+		{"log15", dlog_log15.NewLogger(log15Logger)},
+		{"logrus", dlog_logrus.NewLogger(logrusLogger)},
+		// zap does not support AtLevel, the level is set on the zapcore.Core
+		{"zap", dlog_zap.NewLogger(zapLogger.Sugar())},
+		{"zerolog", dlog_zerolog.NewLogger(zerolog.New(writer).Level(zerolog.InfoLevel))},
+	}
+}
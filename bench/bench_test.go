@@ -0,0 +1,134 @@
+package dlog_bench
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+var (
+	errTest = errors.New("error")
+
+	tenFields = map[string]interface{}{
+		"string":   "value",
+		"int":      1,
+		"int64":    int64(2),
+		"float":    3.5,
+		"bool":     true,
+		"duration": time.Second,
+		"time":     time.Unix(0, 0),
+		"error":    errTest,
+		"strings":  []string{"a", "b"},
+		"struct":   struct{ A, B int }{1, 2},
+	}
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "dlog_bench")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	_ = flag.Set("log_dir", dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func BenchmarkDisabledLevel(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		for i := 0; i < b.N; i++ {
+			logger.Debugf("message %d", i)
+		}
+	})
+}
+
+func BenchmarkDisabledLevelWithFields(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		for i := 0; i < b.N; i++ {
+			logger.WithFields(tenFields).Debugln("message")
+		}
+	})
+}
+
+func BenchmarkPlainMessage(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		for i := 0; i < b.N; i++ {
+			logger.Infoln("message")
+		}
+	})
+}
+
+func BenchmarkTenFields(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		for i := 0; i < b.N; i++ {
+			logger.WithFields(tenFields).Infoln("message")
+		}
+	})
+}
+
+func BenchmarkTypedFields(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		for i := 0; i < b.N; i++ {
+			logger.With(
+				dlog.String("string", "value"),
+				dlog.Int("int", i),
+				dlog.Duration("duration", time.Second),
+				dlog.Err(errTest),
+			).Infoln("message")
+		}
+	})
+}
+
+func BenchmarkAccumulatedTypedFields(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		logger = logger.With(
+			dlog.String("string", "value"),
+			dlog.Int("int", 1),
+			dlog.Duration("duration", time.Second),
+			dlog.Err(errTest),
+		)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logger.Infoln("message")
+		}
+	})
+}
+
+func BenchmarkAccumulatedContext(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		logger = logger.WithFields(tenFields)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logger.Infoln("message")
+		}
+	})
+}
+
+func BenchmarkParallel(b *testing.B) {
+	benchmarkLoggers(b, func(b *testing.B, logger dlog.Logger) {
+		logger = logger.WithFields(tenFields)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				logger.Infoln("message")
+			}
+		})
+	})
+}
+
+func benchmarkLoggers(b *testing.B, f func(*testing.B, dlog.Logger)) {
+	for _, logger := range NewLoggers(ioutil.Discard) {
+		logger := logger
+		b.Run(logger.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			f(b, logger.Logger)
+		})
+	}
+}
@@ -46,6 +46,29 @@ Or, do something more custom:
 	  dlog.SetLogger(dlog_logrus.NewLogger(logger))
 	}
 
+Loggers can also be built from a Config, which can be decoded from JSON or YAML:
+
+	config := &dlog.Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+	  return err
+	}
+	logger, err := config.Build()
+	if err != nil {
+	  return err
+	}
+	dlog.SetLogger(logger)
+
+Use BuildWithCloser instead of Build to close the files opened for the outputs
+once the Logger is replaced.
+
+Fields can be added from a context.Context for every backend by registering a ContextHook,
+such as the one in the otel package, and logging with WithContext:
+
+	dlog.RegisterContextHook(dlog_otel.NewContextHook(dlog_otel.ContextHookOptions{}))
+	dlog.WithContext(ctx).Infoln("handled request")
+
+The built-in backend is "std". The apex, glog, gokit, hclog, klog, log15, logrus, and zerolog packages register their backends on import.
+
 By default, golang's standard logger is used. This is not recommended, however, as the implementation
 with the WithFields function is slow. It would be better to choose a different implementation in most cases.
 */
@@ -93,9 +116,16 @@ type BaseLogger interface {
 // Logger is an interface that all logging implementations must implement.
 type Logger interface {
 	BaseLogger
+	Tracef(format string, args ...interface{})
+	Traceln(args ...interface{})
+	Logf(level Level, format string, args ...interface{})
+	Logln(level Level, args ...interface{})
+	// Enabled returns true if an entry at the given Level would be logged.
+	Enabled(level Level) bool
 	AtLevel(level Level) Logger
 	WithField(key string, value interface{}) Logger
 	WithFields(fields map[string]interface{}) Logger
+	With(fields ...Field) Logger
 }
 
 // Register re-registers the default Logger as the dlog global Logger.
@@ -127,7 +157,9 @@ func SetLevel(level Level) {
 // NewLogger creates a new Logger using a print function, and optionally
 // specific Level to print functions (levelToPrintFunc can be nil).
 //
-// printFunc is used if a Level is not represented.
+// printFunc is used if a Level is not represented. Custom Levels that are not
+// represented use the print function for StandardLevel(level), or for LevelError
+// if the custom Level is above LevelError.
 // LevelNone overrides printFunc.
 //
 // printFunc is required.
@@ -140,6 +172,11 @@ func NewStdLogger(l *log.Logger) Logger {
 	return newLogger(globalLevel, l.Println, nil)
 }
 
+// Enabled calls Enabled on the global Logger.
+func Enabled(level Level) bool {
+	return globalLogger.Enabled(level)
+}
+
 // WithField calls WithField on the global Logger.
 func WithField(key string, value interface{}) Logger {
 	return globalLogger.WithField(key, value)
@@ -150,6 +187,21 @@ func WithFields(fields map[string]interface{}) Logger {
 	return globalLogger.WithFields(fields)
 }
 
+// With calls With on the global Logger.
+func With(fields ...Field) Logger {
+	return globalLogger.With(fields...)
+}
+
+// Tracef logs at the trace level with the semantics of fmt.Printf.
+func Tracef(format string, args ...interface{}) {
+	globalLogger.Tracef(format, args...)
+}
+
+// Traceln logs at the trace level with the semantics of fmt.Println.
+func Traceln(args ...interface{}) {
+	globalLogger.Traceln(args...)
+}
+
 // Debugf logs at the debug level with the semantics of fmt.Printf.
 func Debugf(format string, args ...interface{}) {
 	globalLogger.Debugf(format, args...)
@@ -220,10 +272,79 @@ func Println(args ...interface{}) {
 	globalLogger.Println(args...)
 }
 
+// Logf logs at the given level with the semantics of fmt.Printf.
+//
+// LevelFatal and LevelPanic have the semantics of Fatalf and Panicf.
+func Logf(level Level, format string, args ...interface{}) {
+	globalLogger.Logf(level, format, args...)
+}
+
+// Logln logs at the given level with the semantics of fmt.Println.
+//
+// LevelFatal and LevelPanic have the semantics of Fatalln and Panicln.
+func Logln(level Level, args ...interface{}) {
+	globalLogger.Logln(level, args...)
+}
+
+// BaseLogf calls the method on the BaseLogger for StandardLevel(level) with the semantics of fmt.Printf.
+//
+// This is the fallback for backends without trace or custom Levels: LevelTrace
+// is logged with Debugf, custom Levels are logged at StandardLevel(level), and
+// LevelNone is logged with Printf. Custom Levels above LevelError are logged
+// with Errorf, only LevelFatal and LevelPanic exit or panic.
+func BaseLogf(baseLogger BaseLogger, level Level, format string, args ...interface{}) {
+	switch baseLevel(level) {
+	case LevelTrace, LevelDebug:
+		baseLogger.Debugf(format, args...)
+	case LevelInfo:
+		baseLogger.Infof(format, args...)
+	case LevelWarn:
+		baseLogger.Warnf(format, args...)
+	case LevelError:
+		baseLogger.Errorf(format, args...)
+	case LevelFatal:
+		baseLogger.Fatalf(format, args...)
+	case LevelPanic:
+		baseLogger.Panicf(format, args...)
+	default:
+		baseLogger.Printf(format, args...)
+	}
+}
+
+// BaseLogln calls the method on the BaseLogger for StandardLevel(level) with the semantics of fmt.Println.
+//
+// See BaseLogf for the fallback semantics.
+func BaseLogln(baseLogger BaseLogger, level Level, args ...interface{}) {
+	switch baseLevel(level) {
+	case LevelTrace, LevelDebug:
+		baseLogger.Debugln(args...)
+	case LevelInfo:
+		baseLogger.Infoln(args...)
+	case LevelWarn:
+		baseLogger.Warnln(args...)
+	case LevelError:
+		baseLogger.Errorln(args...)
+	case LevelFatal:
+		baseLogger.Fatalln(args...)
+	case LevelPanic:
+		baseLogger.Panicln(args...)
+	default:
+		baseLogger.Println(args...)
+	}
+}
+
+func baseLevel(level Level) Level {
+	standardLevel := StandardLevel(level)
+	if standardLevel != level && standardLevel > LevelError {
+		return LevelError
+	}
+	return standardLevel
+}
+
 type logger struct {
-	level            Level
-	levelToPrintFunc map[Level]func(...interface{})
-	fields           map[string]interface{}
+	level   Level
+	printer printer
+	fields  []Field
 }
 
 func newLogger(initialLevel Level, printFunc func(...interface{}), levelToPrintFunc map[Level]func(...interface{})) *logger {
@@ -232,119 +353,175 @@ func newLogger(initialLevel Level, printFunc func(...interface{}), levelToPrintF
 		// easier for now
 		panic("dlog: printFunc is nil")
 	}
-	return &logger{initialLevel, getLevelToPrintFunc(printFunc, levelToPrintFunc), make(map[string]interface{}, 0)}
+	return newPrinterLogger(initialLevel, newFuncPrinter(getLevelToPrintFunc(printFunc, levelToPrintFunc)))
+}
+
+func newPrinterLogger(initialLevel Level, printer printer) *logger {
+	return &logger{initialLevel, printer, nil}
 }
 
 func (l *logger) AtLevel(level Level) Logger {
-	return &logger{level, l.levelToPrintFunc, l.fields}
+	return &logger{level, l.printer, l.fields}
 }
 
 func (l *logger) WithField(key string, value interface{}) Logger {
-	return l.WithFields(map[string]interface{}{key: value})
+	return l.With(Any(key, value))
 }
 
 func (l *logger) WithFields(fields map[string]interface{}) Logger {
-	newFields := make(map[string]interface{}, len(l.fields)+len(fields))
-	for key, value := range l.fields {
-		newFields[key] = value
-	}
-	for key, value := range fields {
-		newFields[key] = value
-	}
-	return &logger{l.level, l.levelToPrintFunc, newFields}
+	return l.With(mapToFields(fields)...)
+}
+
+func (l *logger) With(fields ...Field) Logger {
+	return &logger{l.level, l.printer, appendFields(l.fields, fields)}
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.printf(LevelTrace, format, args)
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.println(LevelTrace, args)
 }
 
 func (l *logger) Debugf(format string, args ...interface{}) {
-	l.print(LevelDebug, fmt.Sprintf(format, args...))
+	l.printf(LevelDebug, format, args)
 }
 
 func (l *logger) Debugln(args ...interface{}) {
-	l.print(LevelDebug, fmt.Sprint(args...))
+	l.println(LevelDebug, args)
 }
 
 func (l *logger) Infof(format string, args ...interface{}) {
-	l.print(LevelInfo, fmt.Sprintf(format, args...))
+	l.printf(LevelInfo, format, args)
 }
 
 func (l *logger) Infoln(args ...interface{}) {
-	l.print(LevelInfo, fmt.Sprint(args...))
+	l.println(LevelInfo, args)
 }
 
 func (l *logger) Warnf(format string, args ...interface{}) {
-	l.print(LevelWarn, fmt.Sprintf(format, args...))
+	l.printf(LevelWarn, format, args)
 }
 
 func (l *logger) Warnln(args ...interface{}) {
-	l.print(LevelWarn, fmt.Sprint(args...))
+	l.println(LevelWarn, args)
 }
 
 func (l *logger) Errorf(format string, args ...interface{}) {
-	l.print(LevelError, fmt.Sprintf(format, args...))
+	l.printf(LevelError, format, args)
 }
 
 func (l *logger) Errorln(args ...interface{}) {
-	l.print(LevelError, fmt.Sprint(args...))
+	l.println(LevelError, args)
 }
 
 func (l *logger) Fatalf(format string, args ...interface{}) {
-	l.print(LevelFatal, fmt.Sprintf(format, args...))
+	l.printf(LevelFatal, format, args)
 	os.Exit(1)
 }
 
 func (l *logger) Fatalln(args ...interface{}) {
-	l.print(LevelFatal, fmt.Sprint(args...))
+	l.println(LevelFatal, args)
 	os.Exit(1)
 }
 
 func (l *logger) Panicf(format string, args ...interface{}) {
-	l.print(LevelPanic, fmt.Sprintf(format, args...))
+	l.printf(LevelPanic, format, args)
 	panic(fmt.Sprintf(format, args...))
 }
 
 func (l *logger) Panicln(args ...interface{}) {
-	l.print(LevelPanic, fmt.Sprint(args...))
+	l.println(LevelPanic, args)
 	panic(fmt.Sprint(args...))
 }
 
 func (l *logger) Printf(format string, args ...interface{}) {
-	l.print(LevelNone, fmt.Sprintf(format, args...))
+	l.printf(LevelNone, format, args)
 }
 
 func (l *logger) Println(args ...interface{}) {
-	l.print(LevelNone, fmt.Sprint(args...))
+	l.println(LevelNone, args)
+}
+
+func (l *logger) Logf(level Level, format string, args ...interface{}) {
+	switch level {
+	case LevelFatal:
+		l.Fatalf(format, args...)
+	case LevelPanic:
+		l.Panicf(format, args...)
+	default:
+		l.printf(level, format, args)
+	}
 }
 
-func (l *logger) print(level Level, value string) {
+func (l *logger) Logln(level Level, args ...interface{}) {
+	switch level {
+	case LevelFatal:
+		l.Fatalln(args...)
+	case LevelPanic:
+		l.Panicln(args...)
+	default:
+		l.println(level, args)
+	}
+}
+
+func (l *logger) Enabled(level Level) bool {
 	if level < l.level && l.level != LevelNone {
-		return
+		return false
+	}
+	levelEnabler, ok := l.printer.(printerLevelEnabler)
+	return !ok || levelEnabler.enabled(level)
+}
+
+// printf checks the Level before formatting, so disabled Levels do not allocate.
+func (l *logger) printf(level Level, format string, args []interface{}) {
+	if l.Enabled(level) {
+		l.printer.print(level, fmt.Sprintf(format, args...), l.fields)
+	}
+}
+
+func (l *logger) println(level Level, args []interface{}) {
+	if l.Enabled(level) {
+		l.printer.print(level, fmt.Sprint(args...), l.fields)
 	}
+}
+
+// printer is the output of a logger.
+type printer interface {
+	print(level Level, message string, fields []Field)
+}
+
+// printerLevelEnabler is implemented by printers that filter by Level.
+type printerLevelEnabler interface {
+	enabled(level Level) bool
+}
+
+type funcPrinter struct {
+	levelToPrintFunc map[Level]func(...interface{})
+}
+
+func newFuncPrinter(levelToPrintFunc map[Level]func(...interface{})) *funcPrinter {
+	return &funcPrinter{levelToPrintFunc}
+}
+
+func (p *funcPrinter) print(level Level, value string, fields []Field) {
 	// expected to be ok since we covered this internally
-	printFunc, ok := l.levelToPrintFunc[level]
+	printFunc, ok := p.levelToPrintFunc[level]
+	if !ok {
+		printFunc, ok = p.levelToPrintFunc[baseLevel(level)]
+	}
 	if !ok {
-		printFunc, ok = l.levelToPrintFunc[LevelNone]
+		printFunc, ok = p.levelToPrintFunc[LevelNone]
 		if !ok {
 			panic("dlog: cannot find any printFunc")
 		}
 	}
-	fieldsString := l.getFieldsString()
-	if fieldsString == "" {
+	if len(fields) == 0 {
 		printFunc(value)
 	} else {
-		printFunc(fmt.Sprintf("%s %s", strings.TrimRightFunc(value, unicode.IsSpace), fieldsString))
-	}
-}
-
-func (l *logger) getFieldsString() string {
-	if len(l.fields) == 0 {
-		return ""
-	}
-	values := make([]string, len(l.fields))
-	i := 0
-	for key, value := range l.fields {
-		values[i] = fmt.Sprintf("%s=%v", key, value)
-		i++
+		printFunc(string(appendTextFields(append([]byte(strings.TrimRightFunc(value, unicode.IsSpace)), ' '), fields)))
 	}
-	return strings.Join(values, " ")
 }
 
 func getLevelToPrintFunc(printFunc func(...interface{}), inputLevelToPrintFunc map[Level]func(...interface{})) map[Level]func(...interface{}) {
@@ -357,7 +534,7 @@ func getLevelToPrintFunc(printFunc func(...interface{}), inputLevelToPrintFunc m
 	if _, ok := levelToPrintFunc[LevelNone]; !ok {
 		levelToPrintFunc[LevelNone] = printFunc
 	}
-	for level := range levelToName {
+	for _, level := range standardLevels {
 		if _, ok := levelToPrintFunc[level]; !ok {
 			levelToPrintFunc[level] = printFunc
 		}
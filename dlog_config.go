@@ -0,0 +1,511 @@
+package dlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BackendStd is the name of the built-in backend, used if Config.Backend is empty.
+	BackendStd = "std"
+	// ComponentKey is the field key used to look up per-component Levels in Config.Components.
+	ComponentKey = "component"
+)
+
+var (
+	backendToNewLogger = map[string]func() Logger{}
+	backendLock        = &sync.RWMutex{}
+)
+
+// Config is a declarative description of a Logger that can be decoded from JSON or YAML.
+//
+//	backend: logrus
+//	level: info
+//	components:
+//	  db: debug
+//	outputs:
+//	  - path: stderr
+//	    encoder: json
+//	sampling:
+//	  initial: 100
+//	  thereafter: 100
+//	fields:
+//	  service: api
+type Config struct {
+	// Backend is the name of a backend registered with RegisterBackend, or BackendStd.
+	// If empty, BackendStd is used.
+	Backend string `json:"backend,omitempty" yaml:"backend,omitempty"`
+	// Level is the name of the Level to log at. If empty, DefaultLevel is used.
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Components maps component names to the name of the Level to log at
+	// for Loggers with a ComponentKey field set to that component.
+	Components map[string]string `json:"components,omitempty" yaml:"components,omitempty"`
+	// Outputs are where the std backend writes to. If empty, stderr is used
+	// with the text encoder. Only supported by the std backend.
+	Outputs []OutputConfig `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	// Sampling enables sampling if set.
+	Sampling *SamplingConfig `json:"sampling,omitempty" yaml:"sampling,omitempty"`
+	// Fields are added to every entry.
+	Fields map[string]interface{} `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// OutputConfig describes an output for the std backend.
+type OutputConfig struct {
+	// Path is "stdout", "stderr", or the path of a file to append to.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Encoder is the name of the Encoder to use. If empty, EncoderText is used.
+	Encoder string `json:"encoder,omitempty" yaml:"encoder,omitempty"`
+}
+
+// SamplingConfig describes sampling. Within each second, the first Initial entries
+// with a given Level and message are logged, and then every Thereafter-th entry
+// after that. Fatal and Panic entries are never sampled.
+type SamplingConfig struct {
+	Initial    int `json:"initial,omitempty" yaml:"initial,omitempty"`
+	Thereafter int `json:"thereafter,omitempty" yaml:"thereafter,omitempty"`
+}
+
+// ConfigError is the error returned from Config.Validate, Config.Build, and Config.BuildWithCloser.
+type ConfigError struct {
+	// Key is the path to the bad key, for example "outputs[1].encoder".
+	Key     string
+	Message string
+}
+
+// Error implements error.
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("dlog: invalid config: %s: %s", e.Key, e.Message)
+}
+
+// RegisterBackend registers a backend for use with Config.Backend.
+//
+// newLogger is called once per Config.Build or Config.BuildWithCloser. Level filtering, components, sampling,
+// and fields are handled by dlog on top of the returned Logger, so newLogger
+// should return a Logger that can have AtLevel called on it.
+//
+// The backend packages register themselves on import if they can be configured.
+func RegisterBackend(name string, newLogger func() Logger) {
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	backendToNewLogger[name] = newLogger
+}
+
+// Validate validates the Config.
+func (c *Config) Validate() error {
+	_, err := c.validate()
+	return err
+}
+
+// Build builds a new Logger from the Config.
+//
+// The files opened for Outputs stay open, use BuildWithCloser to close them.
+func (c *Config) Build() (Logger, error) {
+	logger, _, err := c.BuildWithCloser()
+	return logger, err
+}
+
+// BuildWithCloser builds a new Logger from the Config like Build.
+//
+// The returned io.Closer closes the files opened for Outputs, and should be
+// called once the Logger is no longer used, for example after it is replaced
+// with SetLogger.
+func (c *Config) BuildWithCloser() (Logger, io.Closer, error) {
+	newLogger, err := c.validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	level := DefaultLevel
+	if c.Level != "" {
+		level, _ = NameToLevel(c.Level)
+	}
+	componentToLevel := make(map[string]Level, len(c.Components))
+	for component, name := range c.Components {
+		componentToLevel[component], _ = NameToLevel(name)
+	}
+	var delegate Logger
+	var closer multiCloser
+	if newLogger != nil {
+		delegate = newLogger()
+	} else {
+		printers := make(multiPrinter, 0, len(c.Outputs))
+		for i, output := range c.Outputs {
+			writer, outputCloser, err := openOutput(output.Path)
+			if err != nil {
+				_ = closer.Close()
+				return nil, nil, &ConfigError{fmt.Sprintf("outputs[%d].path", i), err.Error()}
+			}
+			if outputCloser != nil {
+				closer = append(closer, outputCloser)
+			}
+			encoderName := output.Encoder
+			if encoderName == "" {
+				encoderName = EncoderText
+			}
+			encoder, _ := NameToEncoder(encoderName)
+			printers = append(printers, newEncoderPrinter(writer, encoder))
+		}
+		if len(printers) == 0 {
+			printers = append(printers, newEncoderPrinter(os.Stderr, NewTextEncoder()))
+		}
+		delegate = newPrinterLogger(level, printers)
+	}
+	var s *sampler
+	if c.Sampling != nil {
+		s = newSampler(c.Sampling.Initial, c.Sampling.Thereafter)
+	}
+	var logger Logger = newConfigLogger(delegate.AtLevel(lowestLevel(level, componentToLevel)), level, level, componentToLevel, s)
+	if len(c.Fields) > 0 {
+		logger = logger.WithFields(c.Fields)
+	}
+	return logger, closer, nil
+}
+
+// validate returns the registered backend function, or nil for BackendStd.
+func (c *Config) validate() (func() Logger, error) {
+	var newLogger func() Logger
+	if c.Backend != "" && c.Backend != BackendStd {
+		backendLock.RLock()
+		newLogger = backendToNewLogger[c.Backend]
+		backendLock.RUnlock()
+		if newLogger == nil {
+			return nil, &ConfigError{"backend", fmt.Sprintf("unknown backend %q, registered backends are %s", c.Backend, strings.Join(registeredBackends(), ", "))}
+		}
+		if len(c.Outputs) > 0 {
+			return nil, &ConfigError{"outputs", fmt.Sprintf("not supported by backend %q", c.Backend)}
+		}
+	}
+	if c.Level != "" {
+		if _, err := NameToLevel(c.Level); err != nil {
+			return nil, &ConfigError{"level", fmt.Sprintf("unknown level %q", c.Level)}
+		}
+	}
+	for _, component := range sortedComponents(c.Components) {
+		if _, err := NameToLevel(c.Components[component]); err != nil {
+			return nil, &ConfigError{"components." + component, fmt.Sprintf("unknown level %q", c.Components[component])}
+		}
+	}
+	for i, output := range c.Outputs {
+		if output.Path == "" {
+			return nil, &ConfigError{fmt.Sprintf("outputs[%d].path", i), "required"}
+		}
+		if output.Encoder != "" {
+			if _, err := NameToEncoder(output.Encoder); err != nil {
+				return nil, &ConfigError{fmt.Sprintf("outputs[%d].encoder", i), fmt.Sprintf("unknown encoder %q", output.Encoder)}
+			}
+		}
+	}
+	if c.Sampling != nil {
+		if c.Sampling.Initial < 0 {
+			return nil, &ConfigError{"sampling.initial", "must not be negative"}
+		}
+		if c.Sampling.Thereafter < 0 {
+			return nil, &ConfigError{"sampling.thereafter", "must not be negative"}
+		}
+		if c.Sampling.Initial == 0 && c.Sampling.Thereafter == 0 {
+			return nil, &ConfigError{"sampling", "initial or thereafter is required"}
+		}
+	}
+	return newLogger, nil
+}
+
+// openOutput returns a nil io.Closer for stdout and stderr.
+func openOutput(path string) (io.Writer, io.Closer, error) {
+	switch path {
+	case "stdout":
+		return os.Stdout, nil, nil
+	case "stderr":
+		return os.Stderr, nil, nil
+	default:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, file, nil
+	}
+}
+
+type multiCloser []io.Closer
+
+func (c multiCloser) Close() error {
+	var err error
+	for _, closer := range c {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func registeredBackends() []string {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	backends := []string{BackendStd}
+	for backend := range backendToNewLogger {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends[1:])
+	return backends
+}
+
+func sortedComponents(components map[string]string) []string {
+	keys := make([]string, 0, len(components))
+	for key := range components {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func lowestLevel(level Level, componentToLevel map[string]Level) Level {
+	for _, componentLevel := range componentToLevel {
+		if componentLevel < level {
+			level = componentLevel
+		}
+	}
+	return level
+}
+
+// configLogger does level filtering and sampling on top of a delegate Logger
+// that is set to the lowest configured Level.
+type configLogger struct {
+	delegate         Logger
+	level            Level
+	baseLevel        Level
+	componentToLevel map[string]Level
+	sampler          *sampler
+}
+
+func newConfigLogger(delegate Logger, level Level, baseLevel Level, componentToLevel map[string]Level, sampler *sampler) *configLogger {
+	return &configLogger{delegate, level, baseLevel, componentToLevel, sampler}
+}
+
+func (l *configLogger) AtLevel(level Level) Logger {
+	return newConfigLogger(l.delegate.AtLevel(lowestLevel(level, l.componentToLevel)), level, level, l.componentToLevel, l.sampler)
+}
+
+func (l *configLogger) WithField(key string, value interface{}) Logger {
+	return newConfigLogger(l.delegate.WithField(key, value), l.levelForFields(map[string]interface{}{key: value}), l.baseLevel, l.componentToLevel, l.sampler)
+}
+
+func (l *configLogger) WithFields(fields map[string]interface{}) Logger {
+	return newConfigLogger(l.delegate.WithFields(fields), l.levelForFields(fields), l.baseLevel, l.componentToLevel, l.sampler)
+}
+
+func (l *configLogger) With(fields ...Field) Logger {
+	level := l.level
+	for _, field := range fields {
+		if field.Key == ComponentKey {
+			level = l.levelForComponent(field.Value())
+		}
+	}
+	return newConfigLogger(l.delegate.With(fields...), level, l.baseLevel, l.componentToLevel, l.sampler)
+}
+
+func (l *configLogger) levelForFields(fields map[string]interface{}) Level {
+	value, ok := fields[ComponentKey]
+	if !ok {
+		return l.level
+	}
+	return l.levelForComponent(value)
+}
+
+func (l *configLogger) levelForComponent(value interface{}) Level {
+	if level, ok := l.componentToLevel[fmt.Sprint(value)]; ok {
+		return level
+	}
+	return l.baseLevel
+}
+
+func (l *configLogger) Tracef(format string, args ...interface{}) {
+	if l.check(LevelTrace, format) {
+		l.delegate.Tracef(format, args...)
+	}
+}
+
+func (l *configLogger) Traceln(args ...interface{}) {
+	if l.checkln(LevelTrace, args) {
+		l.delegate.Traceln(args...)
+	}
+}
+
+func (l *configLogger) Debugf(format string, args ...interface{}) {
+	if l.check(LevelDebug, format) {
+		l.delegate.Debugf(format, args...)
+	}
+}
+
+func (l *configLogger) Debugln(args ...interface{}) {
+	if l.checkln(LevelDebug, args) {
+		l.delegate.Debugln(args...)
+	}
+}
+
+func (l *configLogger) Infof(format string, args ...interface{}) {
+	if l.check(LevelInfo, format) {
+		l.delegate.Infof(format, args...)
+	}
+}
+
+func (l *configLogger) Infoln(args ...interface{}) {
+	if l.checkln(LevelInfo, args) {
+		l.delegate.Infoln(args...)
+	}
+}
+
+func (l *configLogger) Warnf(format string, args ...interface{}) {
+	if l.check(LevelWarn, format) {
+		l.delegate.Warnf(format, args...)
+	}
+}
+
+func (l *configLogger) Warnln(args ...interface{}) {
+	if l.checkln(LevelWarn, args) {
+		l.delegate.Warnln(args...)
+	}
+}
+
+func (l *configLogger) Errorf(format string, args ...interface{}) {
+	if l.check(LevelError, format) {
+		l.delegate.Errorf(format, args...)
+	}
+}
+
+func (l *configLogger) Errorln(args ...interface{}) {
+	if l.checkln(LevelError, args) {
+		l.delegate.Errorln(args...)
+	}
+}
+
+func (l *configLogger) Fatalf(format string, args ...interface{}) {
+	if l.enabled(LevelFatal) {
+		l.delegate.Fatalf(format, args...)
+	}
+	os.Exit(1)
+}
+
+func (l *configLogger) Fatalln(args ...interface{}) {
+	if l.enabled(LevelFatal) {
+		l.delegate.Fatalln(args...)
+	}
+	os.Exit(1)
+}
+
+func (l *configLogger) Panicf(format string, args ...interface{}) {
+	if l.enabled(LevelPanic) {
+		l.delegate.Panicf(format, args...)
+	}
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (l *configLogger) Panicln(args ...interface{}) {
+	if l.enabled(LevelPanic) {
+		l.delegate.Panicln(args...)
+	}
+	panic(fmt.Sprint(args...))
+}
+
+func (l *configLogger) Printf(format string, args ...interface{}) {
+	if l.check(LevelNone, format) {
+		l.delegate.Printf(format, args...)
+	}
+}
+
+func (l *configLogger) Println(args ...interface{}) {
+	if l.checkln(LevelNone, args) {
+		l.delegate.Println(args...)
+	}
+}
+
+func (l *configLogger) Logf(level Level, format string, args ...interface{}) {
+	switch level {
+	case LevelFatal:
+		l.Fatalf(format, args...)
+	case LevelPanic:
+		l.Panicf(format, args...)
+	default:
+		if l.check(level, format) {
+			l.delegate.Logf(level, format, args...)
+		}
+	}
+}
+
+func (l *configLogger) Logln(level Level, args ...interface{}) {
+	switch level {
+	case LevelFatal:
+		l.Fatalln(args...)
+	case LevelPanic:
+		l.Panicln(args...)
+	default:
+		if l.checkln(level, args) {
+			l.delegate.Logln(level, args...)
+		}
+	}
+}
+
+func (l *configLogger) Enabled(level Level) bool {
+	return l.enabled(level) && l.delegate.Enabled(level)
+}
+
+func (l *configLogger) enabled(level Level) bool {
+	// same semantics as logger.print
+	return !(level < l.level && l.level != LevelNone)
+}
+
+func (l *configLogger) check(level Level, message string) bool {
+	if !l.enabled(level) {
+		return false
+	}
+	if l.sampler == nil {
+		return true
+	}
+	return l.sampler.check(level, message)
+}
+
+// checkln is check for the *ln functions, and only formats the message if sampling.
+func (l *configLogger) checkln(level Level, args []interface{}) bool {
+	if !l.enabled(level) {
+		return false
+	}
+	if l.sampler == nil {
+		return true
+	}
+	return l.sampler.check(level, fmt.Sprint(args...))
+}
+
+type samplerKey struct {
+	level   Level
+	message string
+}
+
+type sampler struct {
+	initial    uint64
+	thereafter uint64
+	resetTime  time.Time
+	counts     map[samplerKey]uint64
+	lock       *sync.Mutex
+}
+
+func newSampler(initial int, thereafter int) *sampler {
+	return &sampler{uint64(initial), uint64(thereafter), time.Time{}, make(map[samplerKey]uint64), &sync.Mutex{}}
+}
+
+func (s *sampler) check(level Level, message string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if now := time.Now(); now.After(s.resetTime) {
+		s.counts = make(map[samplerKey]uint64)
+		s.resetTime = now.Add(time.Second)
+	}
+	key := samplerKey{level, message}
+	s.counts[key]++
+	count := s.counts[key]
+	if count <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (count-s.initial)%s.thereafter == 0
+}
@@ -0,0 +1,221 @@
+package dlog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// RequestIDKey is the field key of request IDs.
+const RequestIDKey = "request_id"
+
+var (
+	contextHooks    []ContextHook
+	contextHookLock = &sync.RWMutex{}
+)
+
+type loggerContextKey struct{}
+
+type requestIDContextKey struct{}
+
+// NewContext returns a new context that carries the Logger.
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the Logger carried by the context, or the global Logger if there is none.
+func FromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(Logger); ok {
+		return logger
+	}
+	return globalLogger
+}
+
+// NewRequestIDContext returns a new context that carries the request ID.
+func NewRequestIDContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by the context, or "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// ContextHook adds fields from a context to the Loggers created with WithContext
+// and NewContextLogger, and is called for each of their log calls.
+//
+// ContextHooks must be safe for concurrent use.
+type ContextHook interface {
+	// Fields returns the fields to add for the context.
+	Fields(ctx context.Context) []Field
+	// Log is called for each log call at an enabled Level, before the Logger is called,
+	// with the fields added to the context Logger, including the fields from the ContextHooks.
+	Log(ctx context.Context, level Level, message string, fields []Field)
+}
+
+// RegisterContextHook registers a ContextHook for the Loggers created with WithContext
+// and NewContextLogger after it is registered.
+func RegisterContextHook(contextHook ContextHook) {
+	contextHookLock.Lock()
+	defer contextHookLock.Unlock()
+	contextHooks = append(contextHooks, contextHook)
+}
+
+// WithContext returns the global Logger with the fields from the registered ContextHooks.
+func WithContext(ctx context.Context) Logger {
+	return NewContextLogger(ctx, globalLogger)
+}
+
+// NewContextLogger returns the Logger with the fields from the registered ContextHooks,
+// calling the ContextHooks for each log call.
+//
+// If no ContextHooks are registered, the Logger is returned.
+func NewContextLogger(ctx context.Context, logger Logger) Logger {
+	contextHookLock.RLock()
+	hooks := contextHooks
+	contextHookLock.RUnlock()
+	if len(hooks) == 0 {
+		return logger
+	}
+	var fields []Field
+	for _, hook := range hooks {
+		fields = append(fields, hook.Fields(ctx)...)
+	}
+	return &contextLogger{ctx, hooks, logger.With(fields...), fields}
+}
+
+type contextLogger struct {
+	ctx    context.Context
+	hooks  []ContextHook
+	logger Logger
+	fields []Field
+}
+
+func (l *contextLogger) AtLevel(level Level) Logger {
+	return &contextLogger{l.ctx, l.hooks, l.logger.AtLevel(level), l.fields}
+}
+
+func (l *contextLogger) WithField(key string, value interface{}) Logger {
+	return l.With(Any(key, value))
+}
+
+func (l *contextLogger) WithFields(fields map[string]interface{}) Logger {
+	return l.With(mapToFields(fields)...)
+}
+
+func (l *contextLogger) With(fields ...Field) Logger {
+	return &contextLogger{l.ctx, l.hooks, l.logger.With(fields...), appendFields(l.fields, fields)}
+}
+
+func (l *contextLogger) Enabled(level Level) bool {
+	return l.logger.Enabled(level)
+}
+
+func (l *contextLogger) Tracef(format string, args ...interface{}) {
+	l.logf(LevelTrace, format, args)
+	l.logger.Tracef(format, args...)
+}
+
+func (l *contextLogger) Traceln(args ...interface{}) {
+	l.logln(LevelTrace, args)
+	l.logger.Traceln(args...)
+}
+
+func (l *contextLogger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args)
+	l.logger.Debugf(format, args...)
+}
+
+func (l *contextLogger) Debugln(args ...interface{}) {
+	l.logln(LevelDebug, args)
+	l.logger.Debugln(args...)
+}
+
+func (l *contextLogger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, format, args)
+	l.logger.Infof(format, args...)
+}
+
+func (l *contextLogger) Infoln(args ...interface{}) {
+	l.logln(LevelInfo, args)
+	l.logger.Infoln(args...)
+}
+
+func (l *contextLogger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, format, args)
+	l.logger.Warnf(format, args...)
+}
+
+func (l *contextLogger) Warnln(args ...interface{}) {
+	l.logln(LevelWarn, args)
+	l.logger.Warnln(args...)
+}
+
+func (l *contextLogger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, format, args)
+	l.logger.Errorf(format, args...)
+}
+
+func (l *contextLogger) Errorln(args ...interface{}) {
+	l.logln(LevelError, args)
+	l.logger.Errorln(args...)
+}
+
+func (l *contextLogger) Fatalf(format string, args ...interface{}) {
+	l.logf(LevelFatal, format, args)
+	l.logger.Fatalf(format, args...)
+}
+
+func (l *contextLogger) Fatalln(args ...interface{}) {
+	l.logln(LevelFatal, args)
+	l.logger.Fatalln(args...)
+}
+
+func (l *contextLogger) Panicf(format string, args ...interface{}) {
+	l.logf(LevelPanic, format, args)
+	l.logger.Panicf(format, args...)
+}
+
+func (l *contextLogger) Panicln(args ...interface{}) {
+	l.logln(LevelPanic, args)
+	l.logger.Panicln(args...)
+}
+
+func (l *contextLogger) Printf(format string, args ...interface{}) {
+	l.logf(LevelNone, format, args)
+	l.logger.Printf(format, args...)
+}
+
+func (l *contextLogger) Println(args ...interface{}) {
+	l.logln(LevelNone, args)
+	l.logger.Println(args...)
+}
+
+func (l *contextLogger) Logf(level Level, format string, args ...interface{}) {
+	l.logf(level, format, args)
+	l.logger.Logf(level, format, args...)
+}
+
+func (l *contextLogger) Logln(level Level, args ...interface{}) {
+	l.logln(level, args)
+	l.logger.Logln(level, args...)
+}
+
+func (l *contextLogger) logf(level Level, format string, args []interface{}) {
+	if l.logger.Enabled(level) {
+		l.log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *contextLogger) logln(level Level, args []interface{}) {
+	if l.logger.Enabled(level) {
+		l.log(level, fmt.Sprint(args...))
+	}
+}
+
+func (l *contextLogger) log(level Level, message string) {
+	for _, hook := range l.hooks {
+		hook.Log(l.ctx, level, message, l.fields)
+	}
+}
@@ -0,0 +1,456 @@
+package dlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// EncoderText is the name of the text Encoder.
+	EncoderText = "text"
+	// EncoderJSON is the name of the JSON Encoder.
+	EncoderJSON = "json"
+	// EncoderLogfmt is the name of the logfmt Encoder.
+	EncoderLogfmt = "logfmt"
+)
+
+// reservedKeyPrefix prefixes the keys of fields that are also keys of the Entry
+// in the JSON and logfmt encodings.
+const reservedKeyPrefix = "fields."
+
+var (
+	nameToNewEncoder = map[string]func() Encoder{
+		EncoderText:   NewTextEncoder,
+		EncoderJSON:   NewJSONEncoder,
+		EncoderLogfmt: NewLogfmtEncoder,
+	}
+
+	bufferPool = &sync.Pool{
+		New: func() interface{} {
+			buffer := make([]byte, 0, 1024)
+			return &buffer
+		},
+	}
+)
+
+// Entry is a single log entry.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  map[string]interface{}
+	// File and Line are the location of the logging call.
+	// They are only set for Loggers created with NewEntryLogger.
+	File string
+	Line int
+}
+
+// Encoder encodes an Entry into a single line, without a trailing newline.
+type Encoder interface {
+	Encode(entry *Entry) ([]byte, error)
+}
+
+// NewTextEncoder returns a new Encoder that encodes Entries as
+// "time LEVEL message key=value".
+func NewTextEncoder() Encoder {
+	return &textEncoder{}
+}
+
+// NewJSONEncoder returns a new Encoder that encodes Entries as JSON objects
+// with the keys "time", "level", "message", and one key per field. Fields with
+// these keys are prefixed with "fields.".
+func NewJSONEncoder() Encoder {
+	return &jsonEncoder{}
+}
+
+// NewLogfmtEncoder returns a new Encoder that encodes Entries in logfmt,
+// with the keys "time", "level", "msg", and one key per field. Fields with
+// these keys are prefixed with "fields.", and spaces, equal signs, quotes,
+// and control characters in keys are replaced with underscores.
+func NewLogfmtEncoder() Encoder {
+	return &logfmtEncoder{}
+}
+
+// NameToEncoder returns a new Encoder for the given name.
+func NameToEncoder(name string) (Encoder, error) {
+	newEncoder, ok := nameToNewEncoder[name]
+	if !ok {
+		return nil, fmt.Errorf("dlog: no encoder for name: %s", name)
+	}
+	return newEncoder(), nil
+}
+
+// NewEncoderLogger creates a new Logger that encodes Entries with the Encoder,
+// and writes each as a line to the io.Writer.
+//
+// Writes are serialized, so the io.Writer does not need to be thread-safe.
+// With the built-in Encoders, Fields added with With are encoded without allocating.
+func NewEncoderLogger(writer io.Writer, encoder Encoder) Logger {
+	return newPrinterLogger(globalLevel, newEncoderPrinter(writer, encoder))
+}
+
+// appendEncoder is implemented by the built-in Encoders, which append
+// the encoded entry directly to a buffer from typed Fields.
+type appendEncoder interface {
+	appendEntry(buffer []byte, t time.Time, level Level, message string, fields []Field) []byte
+}
+
+type textEncoder struct{}
+
+func (e *textEncoder) Encode(entry *Entry) ([]byte, error) {
+	return e.appendEntry(nil, entry.Time, entry.Level, entry.Message, mapToFields(entry.Fields)), nil
+}
+
+func (e *textEncoder) appendEntry(buffer []byte, t time.Time, level Level, message string, fields []Field) []byte {
+	buffer = t.AppendFormat(buffer, time.RFC3339)
+	if level != LevelNone {
+		buffer = append(buffer, ' ')
+		buffer = append(buffer, level.String()...)
+	}
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, strings.TrimRightFunc(message, unicode.IsSpace)...)
+	if len(fields) > 0 {
+		buffer = appendTextFields(append(buffer, ' '), fields)
+	}
+	return buffer
+}
+
+type jsonEncoder struct{}
+
+func (e *jsonEncoder) Encode(entry *Entry) ([]byte, error) {
+	return e.appendEntry(nil, entry.Time, entry.Level, entry.Message, mapToFields(entry.Fields)), nil
+}
+
+func (e *jsonEncoder) appendEntry(buffer []byte, t time.Time, level Level, message string, fields []Field) []byte {
+	buffer = append(buffer, `{"time":"`...)
+	buffer = t.AppendFormat(buffer, time.RFC3339Nano)
+	buffer = append(buffer, '"')
+	if level != LevelNone {
+		buffer = append(buffer, `,"level":`...)
+		buffer = appendJSONString(buffer, level.String())
+	}
+	buffer = append(buffer, `,"message":`...)
+	buffer = appendJSONString(buffer, strings.TrimRightFunc(message, unicode.IsSpace))
+	for _, field := range fields {
+		buffer = append(buffer, ',')
+		switch field.Key {
+		case "time", "level", "message":
+			// the keys of the Entry would result in duplicate keys
+			buffer = appendJSONString(buffer, reservedKeyPrefix+field.Key)
+		default:
+			buffer = appendJSONString(buffer, field.Key)
+		}
+		buffer = append(buffer, ':')
+		buffer = appendJSONValue(buffer, field)
+	}
+	return append(buffer, '}')
+}
+
+type logfmtEncoder struct{}
+
+func (e *logfmtEncoder) Encode(entry *Entry) ([]byte, error) {
+	return e.appendEntry(nil, entry.Time, entry.Level, entry.Message, mapToFields(entry.Fields)), nil
+}
+
+func (e *logfmtEncoder) appendEntry(buffer []byte, t time.Time, level Level, message string, fields []Field) []byte {
+	buffer = append(buffer, "time="...)
+	buffer = t.AppendFormat(buffer, time.RFC3339)
+	if level != LevelNone {
+		buffer = append(buffer, " level="...)
+		name := level.String()
+		for i := 0; i < len(name); i++ {
+			c := name[i]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			buffer = append(buffer, c)
+		}
+	}
+	buffer = append(buffer, " msg="...)
+	buffer = appendLogfmtString(buffer, strings.TrimRightFunc(message, unicode.IsSpace))
+	for _, field := range fields {
+		buffer = append(buffer, ' ')
+		switch field.Key {
+		case "time", "level", "msg":
+			// the keys of the Entry would result in duplicate keys
+			buffer = append(buffer, reservedKeyPrefix...)
+		}
+		buffer = appendLogfmtKey(buffer, field.Key)
+		buffer = append(buffer, '=')
+		switch field.Type {
+		case FieldTypeInt:
+			buffer = strconv.AppendInt(buffer, field.Integer, 10)
+		case FieldTypeDuration:
+			buffer = appendDuration(buffer, time.Duration(field.Integer))
+		case FieldTypeString:
+			buffer = appendLogfmtString(buffer, field.String)
+		case FieldTypeError:
+			buffer = appendLogfmtString(buffer, errorString(field))
+		default:
+			buffer = appendLogfmtString(buffer, fmt.Sprint(fieldValue(field)))
+		}
+	}
+	return buffer
+}
+
+func appendTextFields(buffer []byte, fields []Field) []byte {
+	for i, field := range fields {
+		if i > 0 {
+			buffer = append(buffer, ' ')
+		}
+		buffer = append(buffer, field.Key...)
+		buffer = append(buffer, '=')
+		switch field.Type {
+		case FieldTypeString:
+			buffer = append(buffer, field.String...)
+		case FieldTypeInt:
+			buffer = strconv.AppendInt(buffer, field.Integer, 10)
+		case FieldTypeDuration:
+			buffer = appendDuration(buffer, time.Duration(field.Integer))
+		case FieldTypeError:
+			buffer = append(buffer, errorString(field)...)
+		default:
+			buffer = append(buffer, fmt.Sprint(fieldValue(field))...)
+		}
+	}
+	return buffer
+}
+
+func appendJSONValue(buffer []byte, field Field) []byte {
+	switch field.Type {
+	case FieldTypeString:
+		return appendJSONString(buffer, field.String)
+	case FieldTypeInt:
+		return strconv.AppendInt(buffer, field.Integer, 10)
+	case FieldTypeDuration:
+		buffer = append(buffer, '"')
+		buffer = appendDuration(buffer, time.Duration(field.Integer))
+		return append(buffer, '"')
+	case FieldTypeError:
+		if field.Interface == nil {
+			return append(buffer, "null"...)
+		}
+		return appendJSONString(buffer, errorString(field))
+	}
+	value := fieldValue(field)
+	if s, ok := value.(string); ok {
+		return appendJSONString(buffer, s)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return appendJSONString(buffer, fmt.Sprint(value))
+	}
+	return append(buffer, data...)
+}
+
+func appendJSONString(buffer []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buffer = append(buffer, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			buffer = append(buffer, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buffer = append(buffer, '\\', b)
+			case '\n':
+				buffer = append(buffer, '\\', 'n')
+			case '\r':
+				buffer = append(buffer, '\\', 'r')
+			case '\t':
+				buffer = append(buffer, '\\', 't')
+			default:
+				buffer = append(buffer, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buffer = append(buffer, s[start:i]...)
+			buffer = append(buffer, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buffer = append(buffer, s[start:]...)
+	return append(buffer, '"')
+}
+
+// appendLogfmtKey replaces the characters that cannot be in logfmt keys with underscores.
+func appendLogfmtKey(buffer []byte, key string) []byte {
+	if key == "" {
+		return append(buffer, '_')
+	}
+	for i := 0; i < len(key); {
+		r, size := utf8.DecodeRuneInString(key[i:])
+		if r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) || (r == utf8.RuneError && size == 1) {
+			buffer = append(buffer, '_')
+		} else {
+			buffer = append(buffer, key[i:i+size]...)
+		}
+		i += size
+	}
+	return buffer
+}
+
+func appendLogfmtString(buffer []byte, s string) []byte {
+	if s == "" {
+		return append(buffer, `""`...)
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return strconv.AppendQuote(buffer, s)
+		}
+	}
+	return append(buffer, s...)
+}
+
+// appendDuration appends the Duration in the format of time.Duration.String.
+func appendDuration(buffer []byte, d time.Duration) []byte {
+	if d == 0 {
+		return append(buffer, "0s"...)
+	}
+	u := uint64(d)
+	if d < 0 {
+		buffer = append(buffer, '-')
+		u = -u
+	}
+	switch {
+	case u < uint64(time.Microsecond):
+		buffer = strconv.AppendUint(buffer, u, 10)
+		return append(buffer, "ns"...)
+	case u < uint64(time.Millisecond):
+		buffer = appendFraction(buffer, u, 3)
+		return append(buffer, "µs"...)
+	case u < uint64(time.Second):
+		buffer = appendFraction(buffer, u, 6)
+		return append(buffer, "ms"...)
+	}
+	hours := u / uint64(time.Hour)
+	u -= hours * uint64(time.Hour)
+	minutes := u / uint64(time.Minute)
+	u -= minutes * uint64(time.Minute)
+	if hours > 0 {
+		buffer = strconv.AppendUint(buffer, hours, 10)
+		buffer = append(buffer, 'h')
+	}
+	if hours > 0 || minutes > 0 {
+		buffer = strconv.AppendUint(buffer, minutes, 10)
+		buffer = append(buffer, 'm')
+	}
+	buffer = appendFraction(buffer, u, 9)
+	return append(buffer, 's')
+}
+
+// appendFraction appends v/10^precision, omitting trailing zeros in the fraction.
+func appendFraction(buffer []byte, v uint64, precision int) []byte {
+	divisor := uint64(1)
+	for i := 0; i < precision; i++ {
+		divisor *= 10
+	}
+	buffer = strconv.AppendUint(buffer, v/divisor, 10)
+	fraction := v % divisor
+	if fraction == 0 {
+		return buffer
+	}
+	buffer = append(buffer, '.')
+	for divisor /= 10; fraction > 0; divisor /= 10 {
+		buffer = append(buffer, byte('0'+fraction/divisor))
+		fraction %= divisor
+	}
+	return buffer
+}
+
+// errorString returns the message of an error Field without boxing it, or "<nil>".
+func errorString(field Field) string {
+	if err, ok := field.Interface.(error); ok && err != nil {
+		return err.Error()
+	}
+	return "<nil>"
+}
+
+// fieldValue returns the value of the Field with Lazy values evaluated
+// and errors converted to their messages, so that all Encoders print them the same way.
+func fieldValue(field Field) interface{} {
+	value := field.Value()
+	if lazy, ok := value.(Lazy); ok {
+		value = lazy()
+	}
+	if err, ok := value.(error); ok && err != nil {
+		return err.Error()
+	}
+	return value
+}
+
+// evaluateFields returns the values of the fields by key, with
+// Lazy values evaluated and errors converted to strings.
+func evaluateFields(fields []Field) map[string]interface{} {
+	evaluatedFields := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		evaluatedFields[field.Key] = fieldValue(field)
+	}
+	return evaluatedFields
+}
+
+type encoderPrinter struct {
+	writer  io.Writer
+	encoder Encoder
+	lock    *sync.Mutex
+}
+
+func newEncoderPrinter(writer io.Writer, encoder Encoder) *encoderPrinter {
+	return &encoderPrinter{writer, encoder, &sync.Mutex{}}
+}
+
+func (p *encoderPrinter) print(level Level, message string, fields []Field) {
+	if appendEncoder, ok := p.encoder.(appendEncoder); ok {
+		bufferPointer := bufferPool.Get().(*[]byte)
+		buffer := appendEncoder.appendEntry((*bufferPointer)[:0], time.Now(), level, message, fields)
+		p.write(append(buffer, '\n'))
+		*bufferPointer = buffer
+		bufferPool.Put(bufferPointer)
+		return
+	}
+	data, err := p.encoder.Encode(
+		&Entry{
+			Time:    time.Now(),
+			Level:   level,
+			Message: message,
+			Fields:  evaluateFields(fields),
+		},
+	)
+	if err != nil {
+		data = []byte(fmt.Sprintf("dlog: could not encode entry: %s: %v", message, err))
+	}
+	p.write(append(data, '\n'))
+}
+
+func (p *encoderPrinter) write(data []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// like the standard golang Logger, write errors are ignored
+	_, _ = p.writer.Write(data)
+}
+
+type multiPrinter []printer
+
+func (p multiPrinter) print(level Level, message string, fields []Field) {
+	for _, printer := range p {
+		printer.print(level, message, fields)
+	}
+}
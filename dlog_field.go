@@ -0,0 +1,178 @@
+package dlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.pedge.io/dlog/internal"
+)
+
+// Lazy is a field value that is evaluated only when an entry is emitted,
+// for fields that are expensive to compute:
+//
+//	dlog.WithField("diff", dlog.Lazy(func() interface{} { return computeDiff(a, b) })).Debugln("state changed")
+//
+// The function is called each time an entry with the field is emitted, and should be safe to call concurrently.
+//
+// Lazy implements fmt.Stringer and json.Marshaler, so backends that format
+// field values with the fmt or encoding/json packages evaluate it when formatting.
+type Lazy func() interface{}
+
+// String implements fmt.Stringer.
+func (l Lazy) String() string {
+	return fmt.Sprint(l())
+}
+
+// MarshalJSON implements json.Marshaler.
+func (l Lazy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l())
+}
+
+// EvaluateFields returns the fields with all Lazy values evaluated.
+//
+// If there are no Lazy values, the fields are returned as-is, otherwise a copy is returned.
+func EvaluateFields(fields map[string]interface{}) map[string]interface{} {
+	hasLazy := false
+	for _, value := range fields {
+		if _, ok := value.(Lazy); ok {
+			hasLazy = true
+			break
+		}
+	}
+	if !hasLazy {
+		return fields
+	}
+	evaluatedFields := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if lazy, ok := value.(Lazy); ok {
+			value = lazy()
+		}
+		evaluatedFields[key] = value
+	}
+	return evaluatedFields
+}
+
+// FieldType is the type of a Field.
+type FieldType uint8
+
+const (
+	// FieldTypeAny is a Field with any value, stored in Interface.
+	FieldTypeAny FieldType = iota
+	// FieldTypeString is a string Field, stored in String.
+	FieldTypeString
+	// FieldTypeInt is an integer Field, stored in Integer.
+	FieldTypeInt
+	// FieldTypeDuration is a time.Duration Field, stored in Integer.
+	FieldTypeDuration
+	// FieldTypeError is an error Field, stored in Interface.
+	FieldTypeError
+)
+
+// Field is a typed field for Logger.With.
+//
+// Fields should be created with String, Int, Duration, Err, or Any. Unlike the values
+// in WithFields, typed Fields do not need to be boxed into an interface{}, so the
+// built-in Logger can encode them without allocating.
+type Field struct {
+	Key       string
+	Type      FieldType
+	Integer   int64
+	String    string
+	Interface interface{}
+}
+
+// String returns a new string Field.
+func String(key string, value string) Field {
+	return Field{Key: key, Type: FieldTypeString, String: value}
+}
+
+// Int returns a new integer Field.
+func Int(key string, value int) Field {
+	return Field{Key: key, Type: FieldTypeInt, Integer: int64(value)}
+}
+
+// Duration returns a new time.Duration Field.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Type: FieldTypeDuration, Integer: int64(value)}
+}
+
+// Err returns a new error Field with the key "error".
+func Err(err error) Field {
+	return Field{Key: "error", Type: FieldTypeError, Interface: err}
+}
+
+// Any returns a new Field for any value, using the typed Field if there is one for the value.
+func Any(key string, value interface{}) Field {
+	switch typedValue := value.(type) {
+	case string:
+		return String(key, typedValue)
+	case int:
+		return Int(key, typedValue)
+	case int64:
+		return Field{Key: key, Type: FieldTypeInt, Integer: typedValue}
+	case time.Duration:
+		return Duration(key, typedValue)
+	case error:
+		return Field{Key: key, Type: FieldTypeError, Interface: typedValue}
+	default:
+		return Field{Key: key, Type: FieldTypeAny, Interface: value}
+	}
+}
+
+// Value returns the value of the Field.
+//
+// Lazy values are returned as-is, and not evaluated.
+func (f Field) Value() interface{} {
+	switch f.Type {
+	case FieldTypeString:
+		return f.String
+	case FieldTypeInt:
+		return f.Integer
+	case FieldTypeDuration:
+		return time.Duration(f.Integer)
+	default:
+		return f.Interface
+	}
+}
+
+// FieldsToMap returns the Fields as a map from key to value, for Loggers that do not support typed Fields.
+//
+// If there are duplicate keys, the last Field wins.
+func FieldsToMap(fields []Field) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		m[field.Key] = field.Value()
+	}
+	return m
+}
+
+// mapToFields returns the map as Fields sorted by key.
+func mapToFields(m map[string]interface{}) []Field {
+	fields := make([]Field, 0, len(m))
+	for _, key := range dlog_internal.SortedKeys(m) {
+		fields = append(fields, Any(key, m[key]))
+	}
+	return fields
+}
+
+// appendFields returns a new slice with the Fields in newFields appended to
+// fields, replacing any Fields in fields with the same key.
+func appendFields(fields []Field, newFields []Field) []Field {
+	result := make([]Field, len(fields), len(fields)+len(newFields))
+	copy(result, fields)
+	for _, newField := range newFields {
+		replaced := false
+		for i := range result {
+			if result[i].Key == newField.Key {
+				result[i] = newField
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result = append(result, newField)
+		}
+	}
+	return result
+}
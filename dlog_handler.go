@@ -0,0 +1,130 @@
+package dlog
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+var (
+	// packagePrefix is the prefix of the names of functions in this package,
+	// used to find the caller of a Logger.
+	packagePrefix = getPackagePrefix()
+
+	// callerSkipPrefixes are the prefixes of the names of functions skipped to find
+	// the caller of a Logger, a []string. The standard log package is skipped for
+	// the output of RedirectStdLog and NewWriter.
+	callerSkipPrefixes   = newCallerSkipPrefixes(packagePrefix, "log.")
+	callerSkipPrefixLock = &sync.Mutex{}
+)
+
+// SkipCallerPackage skips the functions of the package with the import path when finding
+// the caller of an entry, for packages that adapt other logging APIs to a Logger.
+func SkipCallerPackage(packagePath string) {
+	callerSkipPrefixLock.Lock()
+	defer callerSkipPrefixLock.Unlock()
+	prefixes := callerSkipPrefixes.Load().([]string)
+	callerSkipPrefixes.Store(append(prefixes[:len(prefixes):len(prefixes)], packagePath+"."))
+}
+
+// EntryHandler handles Entries.
+//
+// EntryHandlers must be safe for concurrent use.
+type EntryHandler interface {
+	Handle(entry *Entry) error
+}
+
+// LevelEnabler is implemented by EntryHandlers that filter Entries by Level themselves.
+//
+// A Logger created with NewEntryLogger for a LevelEnabler only logs the Levels for
+// which Enabled returns true, in addition to filtering at the Level of the Logger.
+type LevelEnabler interface {
+	Enabled(level Level) bool
+}
+
+// EntryHandlerFunc is a function that implements EntryHandler.
+type EntryHandlerFunc func(entry *Entry) error
+
+// Handle calls the function.
+func (f EntryHandlerFunc) Handle(entry *Entry) error {
+	return f(entry)
+}
+
+// NewEntryLogger creates a new Logger that passes an Entry to the EntryHandler for each log call.
+//
+// Entries have their Lazy field values evaluated, errors converted to strings,
+// trailing whitespace trimmed from the Message, and File and Line set.
+// Errors returned by the EntryHandler are printed to stderr.
+func NewEntryLogger(entryHandler EntryHandler) Logger {
+	return newPrinterLogger(globalLevel, &entryPrinter{entryHandler})
+}
+
+type entryPrinter struct {
+	entryHandler EntryHandler
+}
+
+func (p *entryPrinter) enabled(level Level) bool {
+	levelEnabler, ok := p.entryHandler.(LevelEnabler)
+	return !ok || levelEnabler.Enabled(level)
+}
+
+func (p *entryPrinter) print(level Level, message string, fields []Field) {
+	file, line := caller()
+	if err := p.entryHandler.Handle(
+		&Entry{
+			Time:    time.Now(),
+			Level:   level,
+			Message: strings.TrimRightFunc(message, unicode.IsSpace),
+			Fields:  evaluateFields(fields),
+			File:    file,
+			Line:    line,
+		},
+	); err != nil {
+		fmt.Fprintf(os.Stderr, "dlog: could not handle entry: %s: %v\n", message, err)
+	}
+}
+
+// caller returns the location of the first caller outside of this package
+// and the packages skipped with SkipCallerPackage.
+func caller() (string, int) {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	prefixes := callerSkipPrefixes.Load().([]string)
+	for {
+		frame, more := frames.Next()
+		if !hasAnyPrefix(frame.Function, prefixes) {
+			return frame.File, frame.Line
+		}
+		if !more {
+			return "", 0
+		}
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newCallerSkipPrefixes(prefixes ...string) *atomic.Value {
+	value := &atomic.Value{}
+	value.Store(prefixes)
+	return value
+}
+
+func getPackagePrefix() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	// the package path may contain dots, so find the first dot after the last slash
+	slash := strings.LastIndex(name, "/")
+	return name[:slash+strings.Index(name[slash:], ".")+1]
+}
@@ -1,39 +1,59 @@
 package dlog
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// The built-in Levels are spaced apart so that custom Levels can be
+// registered between them with RegisterLevel.
+//
+// Before LevelTrace was added, LevelDebug to LevelPanic were numbered 1 to 6.
+// These numerical values are still accepted by NameToLevel, UnmarshalText and
+// UnmarshalJSON, and are printed by Format, so persisted and configured
+// numerical Levels keep working.
 const (
 	// LevelNone represents no Level.
 	LevelNone Level = 0
+	// LevelTrace is the trace Level.
+	LevelTrace Level = 10
 	// LevelDebug is the debug Level.
-	LevelDebug Level = 1
+	LevelDebug Level = 20
 	// LevelInfo is the info Level.
-	LevelInfo Level = 2
+	LevelInfo Level = 30
 	// LevelWarn is the warn Level.
-	LevelWarn Level = 3
+	LevelWarn Level = 40
 	// LevelError is the error Level.
-	LevelError Level = 4
+	LevelError Level = 50
 	// LevelFatal is the fatal Level.
-	LevelFatal Level = 5
+	LevelFatal Level = 60
 	// LevelPanic is the panic Level.
-	LevelPanic Level = 6
+	LevelPanic Level = 70
 )
 
 var (
-	levelToName = map[Level]string{
-		LevelNone:  "NONE",
-		LevelDebug: "DEBUG",
-		LevelInfo:  "INFO",
-		LevelWarn:  "WARN",
-		LevelError: "ERROR",
-		LevelFatal: "FATAL",
-		LevelPanic: "PANIC",
-	}
+	// levelToName is a map[Level]string, replaced on RegisterLevel so that
+	// String does not lock on every entry.
+	levelToName = newLevelToName(
+		map[Level]string{
+			LevelNone:  "NONE",
+			LevelTrace: "TRACE",
+			LevelDebug: "DEBUG",
+			LevelInfo:  "INFO",
+			LevelWarn:  "WARN",
+			LevelError: "ERROR",
+			LevelFatal: "FATAL",
+			LevelPanic: "PANIC",
+		},
+	)
 	nameToLevel = map[string]Level{
 		"NONE":  LevelNone,
+		"TRACE": LevelTrace,
 		"DEBUG": LevelDebug,
 		"INFO":  LevelInfo,
 		"WARN":  LevelWarn,
@@ -41,6 +61,31 @@ var (
 		"FATAL": LevelFatal,
 		"PANIC": LevelPanic,
 	}
+	aliasToLevel = map[string]Level{
+		"WARNING":  LevelWarn,
+		"ERR":      LevelError,
+		"CRIT":     LevelFatal,
+		"CRITICAL": LevelFatal,
+	}
+	// legacyValueToLevel maps the numerical values of the Levels before LevelTrace was added.
+	legacyValueToLevel = map[int64]Level{
+		1: LevelDebug,
+		2: LevelInfo,
+		3: LevelWarn,
+		4: LevelError,
+		5: LevelFatal,
+		6: LevelPanic,
+	}
+	standardLevels = []Level{
+		LevelTrace,
+		LevelDebug,
+		LevelInfo,
+		LevelWarn,
+		LevelError,
+		LevelFatal,
+		LevelPanic,
+	}
+	levelLock = &sync.RWMutex{}
 )
 
 // Level is a logging level.
@@ -48,7 +93,7 @@ type Level int32
 
 // String returns the name of a Level or the numerical value if the Level is unknown.
 func (l Level) String() string {
-	name, ok := levelToName[l]
+	name, ok := levelToName.Load().(map[Level]string)[l]
 	if !ok {
 		return strconv.Itoa(int(l))
 	}
@@ -56,10 +101,208 @@ func (l Level) String() string {
 }
 
 // NameToLevel returns the Level for the given name.
+//
+// Names are case-insensitive. The aliases "warning", "err", "crit", and "critical"
+// are also accepted, as well as the numerical value of a Level, including
+// the values 1 to 6 that LevelDebug to LevelPanic had before LevelTrace was added.
+// If there is no Level for the name, a *UnknownLevelError is returned.
 func NameToLevel(name string) (Level, error) {
-	level, ok := nameToLevel[name]
-	if !ok {
-		return LevelNone, fmt.Errorf("lion: no level for name: %s", name)
+	upperName := strings.ToUpper(strings.TrimSpace(name))
+	levelLock.RLock()
+	defer levelLock.RUnlock()
+	if level, ok := nameToLevel[upperName]; ok {
+		return level, nil
+	}
+	if level, ok := aliasToLevel[upperName]; ok {
+		return level, nil
+	}
+	if value, err := strconv.ParseInt(upperName, 10, 32); err == nil {
+		if level, ok := legacyValueToLevel[value]; ok {
+			return level, nil
+		}
+		if _, ok := levelToName.Load().(map[Level]string)[Level(value)]; ok {
+			return Level(value), nil
+		}
+	}
+	return LevelNone, &UnknownLevelError{name}
+}
+
+// RegisterLevel registers a custom Level with the given name and severity.
+//
+// The severity orders the Level relative to the built-in Levels, for example
+// a NOTICE Level between LevelInfo and LevelWarn:
+//
+//	var LevelNotice = dlog.MustRegisterLevel("NOTICE", 35)
+//
+// Custom Levels are logged with Logf and Logln, and are filtered by AtLevel
+// like the built-in Levels. Backends that do not support a Level fall back
+// to StandardLevel(level). Names are case-insensitive.
+//
+// Severities 1 to 6 are reserved for the numerical values LevelDebug to LevelPanic
+// had before LevelTrace was added.
+//
+// RegisterLevel should be called at initialization.
+func RegisterLevel(name string, severity int32) (Level, error) {
+	upperName := strings.ToUpper(strings.TrimSpace(name))
+	level := Level(severity)
+	if upperName == "" {
+		return LevelNone, fmt.Errorf("dlog: level name is empty")
+	}
+	if _, err := strconv.ParseInt(upperName, 10, 32); err == nil {
+		return LevelNone, fmt.Errorf("dlog: level name is numerical: %s", name)
+	}
+	if level <= LevelNone {
+		return LevelNone, fmt.Errorf("dlog: level severity must be greater than %d: %d", LevelNone, severity)
+	}
+	if _, ok := legacyValueToLevel[int64(severity)]; ok {
+		return LevelNone, fmt.Errorf("dlog: level severity %d is reserved for %s", severity, legacyValueToLevel[int64(severity)])
+	}
+	levelLock.Lock()
+	defer levelLock.Unlock()
+	if _, ok := nameToLevel[upperName]; ok {
+		return LevelNone, fmt.Errorf("dlog: level name already registered: %s", upperName)
 	}
+	if _, ok := aliasToLevel[upperName]; ok {
+		return LevelNone, fmt.Errorf("dlog: level name already registered: %s", upperName)
+	}
+	existingLevelToName := levelToName.Load().(map[Level]string)
+	if existingName, ok := existingLevelToName[level]; ok {
+		return LevelNone, fmt.Errorf("dlog: level severity %d already registered as %s", severity, existingName)
+	}
+	newLevelToNameMap := make(map[Level]string, len(existingLevelToName)+1)
+	for existingLevel, existingName := range existingLevelToName {
+		newLevelToNameMap[existingLevel] = existingName
+	}
+	newLevelToNameMap[level] = upperName
+	levelToName.Store(newLevelToNameMap)
+	nameToLevel[upperName] = level
 	return level, nil
 }
+
+// MustRegisterLevel calls RegisterLevel and panics on error.
+func MustRegisterLevel(name string, severity int32) Level {
+	level, err := RegisterLevel(name, severity)
+	if err != nil {
+		panic(err.Error())
+	}
+	return level
+}
+
+// StandardLevel returns the highest built-in Level that is at or below the given Level,
+// or LevelTrace if there is none. LevelNone returns LevelNone.
+//
+// This is the fallback for backends that do not support custom Levels.
+func StandardLevel(level Level) Level {
+	if level == LevelNone {
+		return LevelNone
+	}
+	standardLevel := LevelTrace
+	for _, candidate := range standardLevels {
+		if candidate <= level {
+			standardLevel = candidate
+		}
+	}
+	return standardLevel
+}
+
+// UnknownLevelError is the error returned when there is no Level for a name.
+type UnknownLevelError struct {
+	Name string
+}
+
+// Error implements error.
+func (e *UnknownLevelError) Error() string {
+	return fmt.Sprintf("dlog: no level for name: %q, valid names are %s", e.Name, strings.Join(levelNames(), ", "))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := NameToLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// Both names and numerical values are accepted.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var value int32
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("dlog: level must be a string or number: %s", string(data))
+		}
+		name = strconv.Itoa(int(value))
+	}
+	return l.UnmarshalText([]byte(name))
+}
+
+// Set implements flag.Value.
+func (l *Level) Set(name string) error {
+	return l.UnmarshalText([]byte(name))
+}
+
+// Format implements fmt.Formatter.
+//
+// The verbs %d, %x, %X, %o, and %b print the numerical value, and all other
+// verbs print the name.
+func (l Level) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'd', 'x', 'X', 'o', 'b':
+		fmt.Fprintf(f, fmtDirective(f, verb), int32(l))
+	case 'q':
+		fmt.Fprintf(f, fmtDirective(f, verb), l.String())
+	default:
+		fmt.Fprintf(f, fmtDirective(f, 's'), l.String())
+	}
+}
+
+// fmtDirective rebuilds the directive for the given verb with the flags, width and precision of f.
+func fmtDirective(f fmt.State, verb rune) string {
+	directive := "%"
+	for _, flag := range "+-# 0" {
+		if f.Flag(int(flag)) {
+			directive += string(flag)
+		}
+	}
+	if width, ok := f.Width(); ok {
+		directive += strconv.Itoa(width)
+	}
+	if precision, ok := f.Precision(); ok {
+		directive += "." + strconv.Itoa(precision)
+	}
+	return directive + string(verb)
+}
+
+func levelNames() []string {
+	levelToName := levelToName.Load().(map[Level]string)
+	levels := make([]int, 0, len(levelToName))
+	for level := range levelToName {
+		levels = append(levels, int(level))
+	}
+	sort.Ints(levels)
+	names := make([]string, len(levels))
+	for i, level := range levels {
+		names[i] = levelToName[Level(level)]
+	}
+	return names
+}
+
+func newLevelToName(levelToName map[Level]string) *atomic.Value {
+	value := &atomic.Value{}
+	value.Store(levelToName)
+	return value
+}
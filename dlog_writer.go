@@ -0,0 +1,123 @@
+package dlog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"sync"
+)
+
+// maxWriterLineLength is the length from which NewWriter logs a line
+// without waiting for its newline.
+const maxWriterLineLength = 64 * 1024
+
+// ErrWriterClosed is returned by the io.WriteCloser from NewWriter after it is closed.
+var ErrWriterClosed = errors.New("dlog: writer closed")
+
+// RedirectStdLog redirects the standard logger of the log package to the global
+// Logger at the Level, and returns a function that restores the standard logger.
+//
+// Each call to the standard logger is logged as one entry, with the flags and prefix
+// of the standard logger cleared, and the caller of the standard logger as the caller.
+// The global Logger must not write to the standard logger.
+func RedirectStdLog(level Level) (restore func()) {
+	flags, prefix, writer := log.Flags(), log.Prefix(), log.Writer()
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(&stdLogWriter{level})
+	return func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(writer)
+	}
+}
+
+// stdLogWriter logs each write from the standard logger to the global Logger.
+type stdLogWriter struct {
+	level Level
+}
+
+func (w *stdLogWriter) Write(data []byte) (int, error) {
+	// the standard logger appends a newline if the message does not end with one
+	globalLogger.Logln(w.level, string(bytes.TrimSuffix(data, []byte{'\n'})))
+	return len(data), nil
+}
+
+// NewWriter returns a new io.WriteCloser that logs each line written to it
+// to the Logger at the Level, such as the output of a subprocess or the ErrorLog
+// of an http.Server:
+//
+//	server.ErrorLog = log.New(dlog.NewWriter(logger, dlog.LevelError), "", 0)
+//
+// Empty lines are dropped, and lines longer than 64KB are split. Close logs the
+// last line if it does not end with a newline. If the logger is nil, the global
+// Logger is used.
+func NewWriter(logger Logger, level Level) io.WriteCloser {
+	return &writer{logger: logger, level: level}
+}
+
+type writer struct {
+	logger Logger
+	level  Level
+	buffer []byte
+	closed bool
+	lock   sync.Mutex
+}
+
+func (w *writer) Write(data []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	n := len(data)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			w.buffer = append(w.buffer, data...)
+			for len(w.buffer) >= maxWriterLineLength {
+				w.log(w.buffer[:maxWriterLineLength])
+				w.buffer = w.buffer[maxWriterLineLength:]
+			}
+			break
+		}
+		if len(w.buffer) > 0 {
+			w.buffer = append(w.buffer, data[:i]...)
+			w.log(w.buffer)
+			w.buffer = w.buffer[:0]
+		} else {
+			w.log(data[:i])
+		}
+		data = data[i+1:]
+	}
+	return n, nil
+}
+
+func (w *writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+	w.log(w.buffer)
+	w.buffer = nil
+	return nil
+}
+
+func (w *writer) log(line []byte) {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	logger := w.logger
+	if logger == nil {
+		logger = globalLogger
+	}
+	for len(line) > 0 {
+		n := len(line)
+		if n > maxWriterLineLength {
+			n = maxWriterLineLength
+		}
+		logger.Logln(w.level, string(line[:n]))
+		line = line[n:]
+	}
+}
@@ -0,0 +1,283 @@
+/*
+Package dloggrpc provides gRPC server and client interceptors for dlog.
+
+The server interceptors add a request-scoped Logger to the context of each call,
+and log one line per call:
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(dloggrpc.UnaryServerInterceptor(nil, dloggrpc.Options{})),
+		grpc.StreamInterceptor(dloggrpc.StreamServerInterceptor(nil, dloggrpc.Options{})),
+	)
+
+	func (s *server) Get(ctx context.Context, request *GetRequest) (*GetResponse, error) {
+		dlog.FromContext(ctx).Infoln("getting")
+		...
+	}
+
+The client interceptors log each call, and propagate the request ID of the context:
+
+	conn, err := grpc.Dial(
+		address,
+		grpc.WithUnaryInterceptor(dloggrpc.UnaryClientInterceptor(nil, dloggrpc.Options{})),
+		grpc.WithStreamInterceptor(dloggrpc.StreamClientInterceptor(nil, dloggrpc.Options{})),
+	)
+*/
+package dloggrpc // import "go.pedge.io/dlog/dloggrpc"
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// RequestIDMetadataKey is the metadata key of request IDs.
+	RequestIDMetadataKey = "x-request-id"
+	// ServerMessage is the message of the lines logged by the server interceptors.
+	ServerMessage = "grpc request"
+	// ClientMessage is the message of the lines logged by the client interceptors.
+	ClientMessage = "grpc client request"
+)
+
+// Options are the options for the interceptors.
+type Options struct {
+	// CodeToLevel returns the Level of a call with the code.
+	// If nil, DefaultCodeToLevel is used.
+	CodeToLevel func(code codes.Code) dlog.Level
+	// NewRequestID returns a request ID for server calls without one.
+	// If nil, a random 128-bit hex ID is used.
+	NewRequestID func() string
+}
+
+// DefaultCodeToLevel returns LevelInfo for OK and the codes that are usually caused by
+// the client, LevelError for the codes that indicate a server bug, and LevelWarn otherwise.
+func DefaultCodeToLevel(code codes.Code) dlog.Level {
+	switch code {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.Unauthenticated:
+		return dlog.LevelInfo
+	case codes.Unknown, codes.Unimplemented, codes.Internal, codes.DataLoss:
+		return dlog.LevelError
+	default:
+		return dlog.LevelWarn
+	}
+}
+
+// UnaryServerInterceptor returns a new grpc.UnaryServerInterceptor that logs calls.
+//
+// The request ID of a call is the RequestIDMetadataKey of the incoming metadata if set,
+// otherwise a new request ID, and is sent as a header and carried by the context.
+//
+// The context of the call carries a Logger with the fields "request_id", "method", and
+// "peer", which can be retrieved with dlog.FromContext. The Logger has the fields from
+// the registered dlog.ContextHooks. After each call, a line is logged with the additional
+// fields "code", "duration", and "error" if the call failed. If the logger is nil, the
+// global Logger is used.
+func UnaryServerInterceptor(logger dlog.Logger, options Options) grpc.UnaryServerInterceptor {
+	options = withDefaults(options)
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, callLogger := newServerContext(ctx, logger, options, info.FullMethod)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, dlog.RequestIDFromContext(ctx)))
+		response, err := handler(ctx, request)
+		logCall(callLogger, options, ServerMessage, start, err)
+		return response, err
+	}
+}
+
+// StreamServerInterceptor returns a new grpc.StreamServerInterceptor that logs calls.
+//
+// See UnaryServerInterceptor for the request ID, context, and fields.
+func StreamServerInterceptor(logger dlog.Logger, options Options) grpc.StreamServerInterceptor {
+	options = withDefaults(options)
+	return func(server interface{}, serverStream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, callLogger := newServerContext(serverStream.Context(), logger, options, info.FullMethod)
+		_ = serverStream.SetHeader(metadata.Pairs(RequestIDMetadataKey, dlog.RequestIDFromContext(ctx)))
+		err := handler(server, &contextServerStream{serverStream, ctx})
+		logCall(callLogger, options, ServerMessage, start, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns a new grpc.UnaryClientInterceptor that logs calls.
+//
+// The request ID carried by the context is sent as the RequestIDMetadataKey if the
+// outgoing metadata does not have one. Each call is logged with the fields "method",
+// "target", "request_id" if there is a request ID, "code", "duration", and "error"
+// if the call failed. If the logger is nil, the Logger carried by the context is used.
+func UnaryClientInterceptor(logger dlog.Logger, options Options) grpc.UnaryClientInterceptor {
+	options = withDefaults(options)
+	return func(ctx context.Context, method string, request interface{}, response interface{}, clientConn *grpc.ClientConn, invoker grpc.UnaryInvoker, callOptions ...grpc.CallOption) error {
+		start := time.Now()
+		ctx, callLogger := newClientContext(ctx, logger, method, clientConn)
+		err := invoker(ctx, method, request, response, clientConn, callOptions...)
+		logCall(callLogger, options, ClientMessage, start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a new grpc.StreamClientInterceptor that logs calls
+// when the stream ends: when RecvMsg returns io.EOF or an error, when RecvMsg returns
+// the response of a method without server streaming, or when the context is done.
+//
+// See UnaryClientInterceptor for the request ID and fields.
+func StreamClientInterceptor(logger dlog.Logger, options Options) grpc.StreamClientInterceptor {
+	options = withDefaults(options)
+	return func(ctx context.Context, streamDesc *grpc.StreamDesc, clientConn *grpc.ClientConn, method string, streamer grpc.Streamer, callOptions ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		ctx, callLogger := newClientContext(ctx, logger, method, clientConn)
+		clientStream, err := streamer(ctx, streamDesc, clientConn, method, callOptions...)
+		if err != nil {
+			logCall(callLogger, options, ClientMessage, start, err)
+			return nil, err
+		}
+		return newLoggingClientStream(
+			ctx,
+			clientStream,
+			streamDesc.ServerStreams,
+			func(err error) {
+				logCall(callLogger, options, ClientMessage, start, err)
+			},
+		), nil
+	}
+}
+
+func withDefaults(options Options) Options {
+	if options.CodeToLevel == nil {
+		options.CodeToLevel = DefaultCodeToLevel
+	}
+	if options.NewRequestID == nil {
+		options.NewRequestID = dlog_internal.NewRequestID
+	}
+	return options
+}
+
+func newServerContext(ctx context.Context, logger dlog.Logger, options Options, method string) (context.Context, dlog.Logger) {
+	if logger == nil {
+		logger = dlog.FromContext(ctx)
+	}
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadataKey); len(values) > 0 && dlog_internal.ValidRequestID(values[0]) {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" {
+		requestID = options.NewRequestID()
+	}
+	fields := []dlog.Field{
+		dlog.String(dlog.RequestIDKey, requestID),
+		dlog.String("method", method),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields = append(fields, dlog.String("peer", p.Addr.String()))
+	}
+	logger = dlog.NewContextLogger(ctx, logger.With(fields...))
+	return dlog.NewRequestIDContext(dlog.NewContext(ctx, logger), requestID), logger
+}
+
+func newClientContext(ctx context.Context, logger dlog.Logger, method string, clientConn *grpc.ClientConn) (context.Context, dlog.Logger) {
+	if logger == nil {
+		logger = dlog.FromContext(ctx)
+	}
+	fields := []dlog.Field{
+		dlog.String("method", method),
+		dlog.String("target", clientConn.Target()),
+	}
+	if requestID := dlog.RequestIDFromContext(ctx); requestID != "" {
+		fields = append(fields, dlog.String(dlog.RequestIDKey, requestID))
+		if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(RequestIDMetadataKey)) == 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadataKey, requestID)
+		}
+	}
+	return ctx, logger.With(fields...)
+}
+
+func logCall(logger dlog.Logger, options Options, message string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []dlog.Field{
+		dlog.String("code", code.String()),
+		dlog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		fields = append(fields, dlog.Err(err))
+	}
+	logger.With(fields...).Logln(options.CodeToLevel(code), message)
+}
+
+// contextServerStream is a grpc.ServerStream with a different context.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// loggingClientStream logs the call once the stream ends.
+type loggingClientStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	logCall       func(err error)
+	once          sync.Once
+	doneC         chan struct{}
+}
+
+func newLoggingClientStream(ctx context.Context, clientStream grpc.ClientStream, serverStreams bool, logCall func(err error)) *loggingClientStream {
+	s := &loggingClientStream{
+		ClientStream:  clientStream,
+		serverStreams: serverStreams,
+		logCall:       logCall,
+		doneC:         make(chan struct{}),
+	}
+	// a stream that is cancelled without a final RecvMsg ends with the context
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.end(status.FromContextError(ctx.Err()).Err())
+		case <-s.doneC:
+		}
+	}()
+	return s
+}
+
+func (s *loggingClientStream) SendMsg(message interface{}) error {
+	err := s.ClientStream.SendMsg(message)
+	if err != nil && err != io.EOF {
+		s.end(err)
+	}
+	return err
+}
+
+func (s *loggingClientStream) RecvMsg(message interface{}) error {
+	err := s.ClientStream.RecvMsg(message)
+	switch {
+	case err == io.EOF:
+		s.end(nil)
+	case err != nil:
+		s.end(err)
+	case !s.serverStreams:
+		// the single response of a method without server streaming ends the call
+		s.end(nil)
+	}
+	return err
+}
+
+func (s *loggingClientStream) end(err error) {
+	s.once.Do(
+		func() {
+			close(s.doneC)
+			s.logCall(err)
+		},
+	)
+}
@@ -0,0 +1,224 @@
+/*
+Package dloghttp provides HTTP server and client logging for dlog.
+
+Middleware adds a request-scoped Logger to the context of each request,
+and logs one access line per request:
+
+	handler := dloghttp.Middleware(nil, dloghttp.MiddlewareOptions{})(mux)
+
+	func handle(responseWriter http.ResponseWriter, request *http.Request) {
+		dlog.FromContext(request.Context()).Infoln("handling request")
+	}
+
+Transport logs outgoing requests, and propagates the request ID of the context:
+
+	client := &http.Client{Transport: &dloghttp.Transport{MaxBodySize: 1024}}
+*/
+package dloghttp // import "go.pedge.io/dlog/dloghttp"
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+)
+
+const (
+	// RequestIDHeader is the header of request IDs.
+	RequestIDHeader = "X-Request-ID"
+	// TraceparentHeader is the W3C Trace Context header.
+	TraceparentHeader = "traceparent"
+	// TraceIDKey is the field key of the trace ID from TraceparentHeader.
+	TraceIDKey = "trace_id"
+	// AccessMessage is the message of access lines.
+	AccessMessage = "http request"
+)
+
+// MiddlewareOptions are the options for Middleware.
+type MiddlewareOptions struct {
+	// Level is the Level of access lines for responses other than 5xx,
+	// which are logged at LevelError. If LevelNone, LevelInfo is used.
+	Level dlog.Level
+	// NewRequestID returns a request ID for requests without one.
+	// If nil, a random 128-bit hex ID is used.
+	NewRequestID func() string
+}
+
+// Middleware returns a function that wraps an http.Handler to log requests.
+//
+// The request ID of a request is the RequestIDHeader if set, otherwise the trace ID
+// of the TraceparentHeader if valid, otherwise a new request ID, and is set as the
+// RequestIDHeader of the response and carried by the request context.
+//
+// The context of the request carries a Logger with the fields "request_id", "method",
+// "path", "remote", and "trace_id" if there is a TraceparentHeader, which can be
+// retrieved with dlog.FromContext. The Logger has the fields from the registered
+// dlog.ContextHooks.
+//
+// After each request, an access line is logged with the additional fields "status",
+// "bytes", and "duration". Panics are recovered and logged at LevelError with the
+// field "stack", and a 500 is sent if nothing was written. If the logger is nil,
+// the global Logger is used.
+func Middleware(logger dlog.Logger, options MiddlewareOptions) func(http.Handler) http.Handler {
+	if options.Level == dlog.LevelNone {
+		options.Level = dlog.LevelInfo
+	}
+	if options.NewRequestID == nil {
+		options.NewRequestID = dlog_internal.NewRequestID
+	}
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				serve(logger, options, handler, responseWriter, request)
+			},
+		)
+	}
+}
+
+func serve(logger dlog.Logger, options MiddlewareOptions, handler http.Handler, responseWriter http.ResponseWriter, request *http.Request) {
+	start := time.Now()
+	ctx := request.Context()
+	if logger == nil {
+		logger = dlog.FromContext(ctx)
+	}
+	traceID := parseTraceparent(request.Header.Get(TraceparentHeader))
+	requestID := request.Header.Get(RequestIDHeader)
+	if !dlog_internal.ValidRequestID(requestID) {
+		requestID = traceID
+	}
+	if requestID == "" {
+		requestID = options.NewRequestID()
+	}
+	fields := []dlog.Field{
+		dlog.String(dlog.RequestIDKey, requestID),
+		dlog.String("method", request.Method),
+		dlog.String("path", request.URL.Path),
+		dlog.String("remote", request.RemoteAddr),
+	}
+	if traceID != "" {
+		fields = append(fields, dlog.String(TraceIDKey, traceID))
+	}
+	logger = dlog.NewContextLogger(ctx, logger.With(fields...))
+	ctx = dlog.NewRequestIDContext(dlog.NewContext(ctx, logger), requestID)
+	responseWriter.Header().Set(RequestIDHeader, requestID)
+	recorder := &responseRecorder{ResponseWriter: responseWriter}
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			if recovered == http.ErrAbortHandler {
+				// the connection is aborted on purpose
+				panic(recovered)
+			}
+			logger.With(dlog.String("stack", string(debug.Stack()))).Errorf("panic: %v", recovered)
+			if !recorder.wroteHeader {
+				http.Error(recorder, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}
+		level := options.Level
+		if recovered != nil || recorder.status/100 == 5 {
+			level = dlog.LevelError
+		}
+		logger.With(
+			dlog.Int("status", recorder.Status()),
+			dlog.Int("bytes", recorder.bytes),
+			dlog.Duration("duration", time.Since(start)),
+		).Logln(level, AccessMessage)
+	}()
+	handler.ServeHTTP(recorder, request.WithContext(ctx))
+}
+
+// responseRecorder records the status and number of bytes of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+// Status returns the status of the response, which is 200 if nothing was written.
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Flush implements http.Flusher.
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		if !r.wroteHeader {
+			r.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("dloghttp: response writer does not implement http.Hijacker")
+	}
+	if !r.wroteHeader {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the http.ResponseWriter for http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// parseTraceparent returns the trace ID of a version 00 traceparent, or "" if invalid.
+func parseTraceparent(traceparent string) string {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ""
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return ""
+	}
+	for _, part := range parts[:4] {
+		if !isLowerHex(part) {
+			return ""
+		}
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return ""
+	}
+	return parts[1]
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
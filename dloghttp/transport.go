@@ -0,0 +1,224 @@
+package dloghttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+const (
+	// ClientMessage is the message of the lines logged by Transport.
+	ClientMessage = "http client request"
+	// RequestBodyMessage is the message of request body dumps.
+	RequestBodyMessage = "http client request body"
+	// ResponseBodyMessage is the message of response body dumps.
+	ResponseBodyMessage = "http client response body"
+	// Redacted replaces redacted query values and passwords.
+	Redacted = "REDACTED"
+)
+
+type attemptContextKey struct{}
+
+// NewAttemptContext returns a new context that carries the attempt number of a
+// retried request, which Transport logs as the field "attempt".
+func NewAttemptContext(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptContextKey{}, attempt)
+}
+
+// Transport is an http.RoundTripper that logs requests and their responses.
+//
+// Each request is logged with the fields "method", "url", "status", "duration",
+// "attempt" if the context was created with NewAttemptContext, and "error" if
+// the request failed. If the context carries a request ID, it is sent as the
+// RequestIDHeader if the request does not have one, and logged as "request_id".
+type Transport struct {
+	// Base sends the requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Logger logs the requests. If nil, the Logger carried by the context
+	// of each request is used, see dlog.FromContext.
+	Logger dlog.Logger
+	// Level is the Level of responses other than 5xx. If LevelNone, LevelInfo is used.
+	Level dlog.Level
+	// ErrorLevel is the Level of 5xx responses and failed requests.
+	// If LevelNone, LevelError is used.
+	ErrorLevel dlog.Level
+	// QueryParams are the query parameters whose values are logged.
+	// The values of other query parameters are redacted.
+	QueryParams []string
+	// MaxBodySize is the number of bytes of request and response bodies that
+	// are logged at LevelDebug. Bodies are logged as they are read, once more
+	// than MaxBodySize bytes were read, at EOF, or when they are closed, so
+	// streamed responses are not delayed. If 0, bodies are not logged.
+	MaxBodySize int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	ctx := request.Context()
+	logger := t.Logger
+	if logger == nil {
+		logger = dlog.FromContext(ctx)
+	}
+	fields := []dlog.Field{
+		dlog.String("method", request.Method),
+		dlog.String("url", t.redactURL(request.URL)),
+	}
+	if attempt, ok := ctx.Value(attemptContextKey{}).(int); ok {
+		fields = append(fields, dlog.Int("attempt", attempt))
+	}
+	if requestID := dlog.RequestIDFromContext(ctx); requestID != "" {
+		fields = append(fields, dlog.String(dlog.RequestIDKey, requestID))
+		if request.Header.Get(RequestIDHeader) == "" {
+			// a RoundTripper must not modify the request
+			request = cloneRequest(request)
+			request.Header.Set(RequestIDHeader, requestID)
+		}
+	}
+	logger = logger.With(fields...)
+	dumpBodies := t.MaxBodySize > 0 && logger.Enabled(dlog.LevelDebug)
+	if dumpBodies && request.Body != nil && request.Body != http.NoBody {
+		request = cloneRequest(request)
+		request.Body = newBodyLogger(request.Body, logger, RequestBodyMessage, t.MaxBodySize)
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	response, err := base.RoundTrip(request)
+	duration := dlog.Duration("duration", time.Since(start))
+	if err != nil {
+		logger.With(duration, dlog.Err(err)).Logln(t.errorLevel(), ClientMessage)
+		return nil, err
+	}
+	level := t.Level
+	if level == dlog.LevelNone {
+		level = dlog.LevelInfo
+	}
+	if response.StatusCode/100 == 5 {
+		level = t.errorLevel()
+	}
+	logger.With(dlog.Int("status", response.StatusCode), duration).Logln(level, ClientMessage)
+	if dumpBodies && response.Body != nil && response.Body != http.NoBody {
+		response.Body = newBodyLogger(response.Body, logger, ResponseBodyMessage, t.MaxBodySize)
+	}
+	return response, nil
+}
+
+func (t *Transport) errorLevel() dlog.Level {
+	if t.ErrorLevel == dlog.LevelNone {
+		return dlog.LevelError
+	}
+	return t.ErrorLevel
+}
+
+// redactURL returns the URL with the password and the values of the query
+// parameters not in QueryParams redacted.
+func (t *Transport) redactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.User != nil {
+		if _, ok := redacted.User.Password(); ok {
+			redacted.User = url.UserPassword(redacted.User.Username(), Redacted)
+		}
+	}
+	if redacted.RawQuery != "" {
+		values := redacted.Query()
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, key := range keys {
+			logged := false
+			for _, queryParam := range t.QueryParams {
+				if key == queryParam {
+					logged = true
+				}
+			}
+			for _, value := range values[key] {
+				if !logged {
+					value = Redacted
+				}
+				parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+			}
+		}
+		redacted.RawQuery = strings.Join(parts, "&")
+	}
+	return redacted.String()
+}
+
+func cloneRequest(request *http.Request) *http.Request {
+	clone := request.WithContext(request.Context())
+	clone.Header = make(http.Header, len(request.Header)+1)
+	for key, values := range request.Header {
+		clone.Header[key] = values
+	}
+	return clone
+}
+
+// bodyLogger is an io.ReadCloser that logs the first maxSize bytes of
+// the body once more than maxSize bytes were read, at EOF or another
+// read error, or on Close, whichever is first.
+type bodyLogger struct {
+	body    io.ReadCloser
+	logger  dlog.Logger
+	message string
+	maxSize int
+
+	// lock guards data and logged, as the body may be closed while it is read
+	lock   sync.Mutex
+	data   []byte
+	logged bool
+}
+
+func newBodyLogger(body io.ReadCloser, logger dlog.Logger, message string, maxSize int) *bodyLogger {
+	return &bodyLogger{body: body, logger: logger, message: message, maxSize: maxSize}
+}
+
+func (b *bodyLogger) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.logged {
+		return n, err
+	}
+	if remaining := b.maxSize + 1 - len(b.data); remaining > 0 {
+		if remaining > n {
+			remaining = n
+		}
+		b.data = append(b.data, p[:remaining]...)
+	}
+	if len(b.data) > b.maxSize || err != nil {
+		b.log()
+	}
+	return n, err
+}
+
+func (b *bodyLogger) Close() error {
+	b.lock.Lock()
+	if !b.logged {
+		b.log()
+	}
+	b.lock.Unlock()
+	return b.body.Close()
+}
+
+// log must be called with the lock held.
+func (b *bodyLogger) log() {
+	b.logged = true
+	data := b.data
+	truncated := len(data) > b.maxSize
+	if truncated {
+		data = data[:b.maxSize]
+	}
+	b.logger.With(dlog.Any("truncated", truncated), dlog.String("body", string(data))).Debugln(b.message)
+	b.data = nil
+}
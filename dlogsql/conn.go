@@ -0,0 +1,290 @@
+package dlogsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// wrappedConn logs the queries of a driver.Conn.
+//
+// The optional interfaces of the driver.Conn are forwarded, and database/sql is
+// told to fall back with driver.ErrSkip if the driver.Conn does not implement them.
+type wrappedConn struct {
+	conn   driver.Conn
+	logger *queryLogger
+}
+
+func (c *wrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	start := time.Now()
+	var stmt driver.Stmt
+	var err error
+	if prepareContext, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = prepareContext.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		c.logger.log(ctx, query, nil, nil, start, err)
+		return nil, err
+	}
+	return newWrappedStmt(stmt, query, c.logger), nil
+}
+
+func (c *wrappedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wrappedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *wrappedConn) BeginTx(ctx context.Context, options driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.beginTx(ctx, options)
+	c.logger.log(ctx, "BEGIN", nil, nil, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedTx{tx, ctx, c.logger}, nil
+}
+
+func (c *wrappedConn) beginTx(ctx context.Context, options driver.TxOptions) (driver.Tx, error) {
+	if beginTx, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginTx.BeginTx(ctx, options)
+	}
+	if options.Isolation != driver.IsolationLevel(0) {
+		return nil, errors.New("dlogsql: driver does not support non-default isolation level")
+	}
+	if options.ReadOnly {
+		return nil, errors.New("dlogsql: driver does not support read-only transactions")
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return c.conn.Begin()
+}
+
+func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.execContext(ctx, query, args)
+	c.logger.log(ctx, query, args, result, start, err)
+	return result, err
+}
+
+func (c *wrappedConn) execContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execerContext, ok := c.conn.(driver.ExecerContext); ok {
+		return execerContext.ExecContext(ctx, query, args)
+	}
+	execer, ok := c.conn.(driver.Execer)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return execer.Exec(query, values)
+}
+
+func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.queryContext(ctx, query, args)
+	c.logger.log(ctx, query, args, nil, start, err)
+	return rows, err
+}
+
+func (c *wrappedConn) queryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryerContext, ok := c.conn.(driver.QueryerContext); ok {
+		return queryerContext.QueryContext(ctx, query, args)
+	}
+	queryer, ok := c.conn.(driver.Queryer)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return queryer.Query(query, values)
+}
+
+func (c *wrappedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) ResetSession(ctx context.Context) error {
+	if sessionResetter, ok := c.conn.(driver.SessionResetter); ok {
+		return sessionResetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *wrappedConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *wrappedConn) CheckNamedValue(namedValue *driver.NamedValue) error {
+	if namedValueChecker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return namedValueChecker.CheckNamedValue(namedValue)
+	}
+	return driver.ErrSkip
+}
+
+// wrappedStmt logs the executions of a driver.Stmt.
+type wrappedStmt struct {
+	stmt   driver.Stmt
+	query  string
+	logger *queryLogger
+}
+
+// wrappedColumnConverterStmt forwards driver.ColumnConverter, which database/sql
+// falls back to after wrappedStmt.CheckNamedValue returns driver.ErrSkip.
+type wrappedColumnConverterStmt struct {
+	*wrappedStmt
+	columnConverter driver.ColumnConverter
+}
+
+func newWrappedStmt(stmt driver.Stmt, query string, logger *queryLogger) driver.Stmt {
+	s := &wrappedStmt{stmt, query, logger}
+	if columnConverter, ok := stmt.(driver.ColumnConverter); ok {
+		return &wrappedColumnConverterStmt{s, columnConverter}
+	}
+	return s
+}
+
+func (s *wrappedColumnConverterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.columnConverter.ColumnConverter(idx)
+}
+
+func (s *wrappedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *wrappedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *wrappedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.execContext(ctx, args)
+	s.logger.log(ctx, s.query, args, result, start, err)
+	return result, err
+}
+
+func (s *wrappedStmt) execContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if execContext, ok := s.stmt.(driver.StmtExecContext); ok {
+		return execContext.ExecContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return s.stmt.Exec(values)
+}
+
+func (s *wrappedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (s *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.queryContext(ctx, args)
+	s.logger.log(ctx, s.query, args, nil, start, err)
+	return rows, err
+}
+
+func (s *wrappedStmt) queryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if queryContext, ok := s.stmt.(driver.StmtQueryContext); ok {
+		return queryContext.QueryContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	return s.stmt.Query(values)
+}
+
+func (s *wrappedStmt) CheckNamedValue(namedValue *driver.NamedValue) error {
+	if namedValueChecker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return namedValueChecker.CheckNamedValue(namedValue)
+	}
+	return driver.ErrSkip
+}
+
+// wrappedTx logs the end of a driver.Tx.
+type wrappedTx struct {
+	tx     driver.Tx
+	ctx    context.Context
+	logger *queryLogger
+}
+
+func (t *wrappedTx) Commit() error {
+	start := time.Now()
+	err := t.tx.Commit()
+	t.logger.log(t.ctx, "COMMIT", nil, nil, start, err)
+	return err
+}
+
+func (t *wrappedTx) Rollback() error {
+	start := time.Now()
+	err := t.tx.Rollback()
+	t.logger.log(t.ctx, "ROLLBACK", nil, nil, start, err)
+	return err
+}
+
+func namedValuesToValues(namedValues []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(namedValues))
+	for i, namedValue := range namedValues {
+		if namedValue.Name != "" {
+			return nil, errors.New("dlogsql: driver does not support the use of named parameters")
+		}
+		values[i] = namedValue.Value
+	}
+	return values, nil
+}
+
+func valuesToNamedValues(values []driver.Value) []driver.NamedValue {
+	namedValues := make([]driver.NamedValue, len(values))
+	for i, value := range values {
+		namedValues[i] = driver.NamedValue{Ordinal: i + 1, Value: value}
+	}
+	return namedValues
+}
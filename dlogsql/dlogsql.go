@@ -0,0 +1,148 @@
+/*
+Package dlogsql provides a database/sql driver wrapper that logs queries with dlog.
+
+	sql.Register("postgres-dlog", dlogsql.Wrap(&pq.Driver{}, nil, dlogsql.Options{SlowThreshold: time.Second}))
+	db, err := sql.Open("postgres-dlog", dataSourceName)
+
+Each query is logged with the fields "query", "args" with the number of arguments,
+"rows_affected" for executions, "duration", and "error" if the query failed. Transactions
+are logged as the queries "BEGIN", "COMMIT", and "ROLLBACK".
+*/
+package dlogsql // import "go.pedge.io/dlog/dlogsql"
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+// QueryMessage is the message of the lines logged for queries.
+const QueryMessage = "sql query"
+
+// Options are the options for Wrap.
+type Options struct {
+	// Level is the Level of queries that are not slow and did not fail.
+	// If LevelNone, LevelDebug is used.
+	Level dlog.Level
+	// SlowThreshold is the duration from which queries are logged at LevelWarn.
+	// If 0, queries are never slow.
+	SlowThreshold time.Duration
+	// ErrorLevel is the Level of failed queries. If LevelNone, LevelError is used.
+	ErrorLevel dlog.Level
+	// ArgValues logs the values of the arguments as "arg_values". By default only the
+	// number of arguments is logged, since the values often contain personal data or secrets.
+	ArgValues bool
+}
+
+// Wrap returns a new driver.Driver that logs the queries of the driver.
+//
+// If the logger is nil, the Logger carried by the context of each query is used,
+// see dlog.FromContext.
+func Wrap(d driver.Driver, logger dlog.Logger, options Options) driver.Driver {
+	if options.Level == dlog.LevelNone {
+		options.Level = dlog.LevelDebug
+	}
+	if options.ErrorLevel == dlog.LevelNone {
+		options.ErrorLevel = dlog.LevelError
+	}
+	l := &queryLogger{logger, options}
+	if driverContext, ok := d.(driver.DriverContext); ok {
+		return &wrappedDriverContext{&wrappedDriver{d, l}, driverContext}
+	}
+	return &wrappedDriver{d, l}
+}
+
+type wrappedDriver struct {
+	driver driver.Driver
+	logger *queryLogger
+}
+
+func (d *wrappedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{conn, d.logger}, nil
+}
+
+type wrappedDriverContext struct {
+	*wrappedDriver
+	driverContext driver.DriverContext
+}
+
+func (d *wrappedDriverContext) OpenConnector(name string) (driver.Connector, error) {
+	connector, err := d.driverContext.OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConnector{connector, d}, nil
+}
+
+type wrappedConnector struct {
+	connector driver.Connector
+	driver    *wrappedDriverContext
+}
+
+func (c *wrappedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConn{conn, c.driver.logger}, nil
+}
+
+func (c *wrappedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type queryLogger struct {
+	logger  dlog.Logger
+	options Options
+}
+
+// log logs a query that started at start. The result is nil for queries that
+// do not return a driver.Result.
+func (l *queryLogger) log(ctx context.Context, query string, args []driver.NamedValue, result driver.Result, start time.Time, err error) {
+	if err == driver.ErrSkip {
+		// database/sql falls back to another method, which is logged
+		return
+	}
+	duration := time.Since(start)
+	logger := l.logger
+	if logger == nil {
+		logger = dlog.FromContext(ctx)
+	}
+	level := l.options.Level
+	switch {
+	case err != nil:
+		level = l.options.ErrorLevel
+	case l.options.SlowThreshold > 0 && duration >= l.options.SlowThreshold:
+		level = dlog.LevelWarn
+	}
+	if !logger.Enabled(level) {
+		return
+	}
+	fields := []dlog.Field{
+		dlog.String("query", query),
+		dlog.Int("args", len(args)),
+	}
+	if l.options.ArgValues {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		fields = append(fields, dlog.Any("arg_values", values))
+	}
+	if result != nil {
+		if rowsAffected, err := result.RowsAffected(); err == nil {
+			fields = append(fields, dlog.Any("rows_affected", rowsAffected))
+		}
+	}
+	fields = append(fields, dlog.Duration("duration", duration))
+	if err != nil {
+		fields = append(fields, dlog.Err(err))
+	}
+	logger.With(fields...).Logln(level, QueryMessage)
+}
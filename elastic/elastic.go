@@ -0,0 +1,389 @@
+/*
+Package dlog_elastic provides an Elasticsearch and OpenSearch backend for dlog.
+
+Entries are batched and indexed with the bulk API into daily indices:
+
+	writer, err := dlog_elastic.NewWriter(
+		dlog_elastic.Options{
+			URL:      "http://elasticsearch:9200",
+			Index:    "logs",
+			Username: "elastic",
+			Password: "changeme",
+		},
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = writer.Close() }()
+	dlog.SetLogger(dlog_elastic.NewLogger(writer))
+
+Each Entry is indexed as a document with the keys "@timestamp", "level", "message",
+"caller", and one key per field. The index of an Entry is Options.Index and the UTC
+date of the Entry formatted with Options.IndexDateFormat, for example "logs-2017.01.02".
+
+Items of a bulk request that fail with 429 or 5xx are retried with backoff, and
+items that are rejected, for example because of a mapping conflict, are dropped
+and returned from Flush as ItemErrors.
+
+Entries are kept in memory until Options.BufferLimit is reached, including
+while a batch is retried, after which Entries are dropped and Handle returns
+ErrBufferFull.
+*/
+package dlog_elastic // import "go.pedge.io/dlog/elastic"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+)
+
+const (
+	// BulkPath is the path of the bulk API.
+	BulkPath = "/_bulk"
+
+	// DefaultIndex is the index prefix if Options.Index is not set.
+	DefaultIndex = "logs"
+	// DefaultIndexDateFormat is the date format of the index if Options.IndexDateFormat is not set.
+	DefaultIndexDateFormat = "2006.01.02"
+	// DefaultBatchSize is the number of Entries after which a batch is sent if Options.BatchSize is not set.
+	DefaultBatchSize = 500
+	// DefaultBufferLimit is the number of Entries to buffer if Options.BufferLimit is not set.
+	DefaultBufferLimit = 16 * DefaultBatchSize
+	// DefaultFlushInterval is the interval at which batches are sent if Options.FlushInterval is not set.
+	DefaultFlushInterval = time.Second
+	// DefaultMinBackoff is the first backoff if Options.MinBackoff is not set.
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the maximum backoff if Options.MaxBackoff is not set.
+	DefaultMaxBackoff = time.Minute
+	// DefaultMaxRetries is the number of retries for a batch if Options.MaxRetries is not set.
+	DefaultMaxRetries = 10
+)
+
+var (
+	// ErrClosed is returned if the Writer is used after Close.
+	ErrClosed = errors.New("dlog_elastic: writer is closed")
+	// ErrBufferFull is returned by Handle if Options.BufferLimit is reached.
+	ErrBufferFull = errors.New("dlog_elastic: buffer is full")
+)
+
+// Options are the options for a Writer.
+type Options struct {
+	// URL is the base URL of the cluster, to which BulkPath is appended.
+	URL string
+	// Index is the prefix of the index names.
+	// If empty, DefaultIndex is used.
+	Index string
+	// IndexDateFormat is the time layout of the date appended to Index.
+	// If empty, DefaultIndexDateFormat is used.
+	IndexDateFormat string
+	// Username and Password are sent with basic authentication if Username is set.
+	Username string
+	Password string
+	// BatchSize is the number of Entries after which a batch is sent.
+	// If 0, DefaultBatchSize is used.
+	BatchSize int
+	// FlushInterval is the interval at which batches are sent.
+	// If 0, DefaultFlushInterval is used.
+	FlushInterval time.Duration
+	// BufferLimit is the number of Entries to buffer, including the batch being sent.
+	// If 0, DefaultBufferLimit is used.
+	BufferLimit int
+	// MinBackoff is the backoff after the first failure, which is doubled after every failure.
+	// If 0, DefaultMinBackoff is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum backoff.
+	// If 0, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+	// MaxRetries is the number of times failed items are retried before they are dropped.
+	// If 0, DefaultMaxRetries is used.
+	MaxRetries int
+	// Client is the HTTP client. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Writer is a dlog.EntryHandler that indexes Entries in Elasticsearch or OpenSearch.
+//
+// Entries are sent in the background. Errors while sending in the
+// background are printed to stderr.
+type Writer struct {
+	options Options
+	url     string
+	batcher *dlog_internal.Batcher
+}
+
+// item is the action and document lines of an Entry.
+type item struct {
+	index string
+	data  []byte
+}
+
+// ResponseError is returned if a bulk request fails with an HTTP error status.
+type ResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements error.
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("dlog_elastic: bulk request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// ItemError is the error of a single item of a bulk request.
+type ItemError struct {
+	Index  string
+	Status int
+	Type   string
+	Reason string
+}
+
+// Error implements error.
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("dlog_elastic: %s: %d %s: %s", e.Index, e.Status, e.Type, e.Reason)
+}
+
+// ItemErrors is returned if items of a bulk request were dropped.
+type ItemErrors []*ItemError
+
+// Error implements error.
+func (e ItemErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("dlog_elastic: %d items dropped, first error: %s", len(e), strings.TrimPrefix(e[0].Error(), "dlog_elastic: "))
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(options Options) (*Writer, error) {
+	if options.URL == "" {
+		return nil, errors.New("dlog_elastic: no url")
+	}
+	if options.Index == "" {
+		options.Index = DefaultIndex
+	}
+	if options.IndexDateFormat == "" {
+		options.IndexDateFormat = DefaultIndexDateFormat
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.FlushInterval == 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	if options.BufferLimit == 0 {
+		options.BufferLimit = DefaultBufferLimit
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = DefaultMaxRetries
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	w := &Writer{
+		options: options,
+		url:     strings.TrimSuffix(options.URL, "/") + BulkPath,
+	}
+	w.batcher = dlog_internal.NewBatcher(
+		dlog_internal.BatcherOptions{
+			BatchSize:     options.BatchSize,
+			FlushInterval: options.FlushInterval,
+			BufferLimit:   options.BufferLimit,
+			MinBackoff:    options.MinBackoff,
+			MaxBackoff:    options.MaxBackoff,
+			MaxRetries:    options.MaxRetries,
+			ErrClosed:     ErrClosed,
+			ErrBufferFull: ErrBufferFull,
+			ErrorMessage:  "dlog_elastic: could not index entries",
+		},
+		w.send,
+	)
+	return w, nil
+}
+
+// NewLogger returns a new dlog.Logger that writes to the Writer.
+func NewLogger(writer *Writer) dlog.Logger {
+	return dlog.NewEntryLogger(writer)
+}
+
+// Handle adds the Entry to the batch to be sent, and returns
+// ErrBufferFull if Options.BufferLimit is reached.
+func (w *Writer) Handle(entry *dlog.Entry) error {
+	index := w.options.Index + "-" + entry.Time.UTC().Format(w.options.IndexDateFormat)
+	action, err := json.Marshal(map[string]map[string]string{"create": {"_index": index}})
+	if err != nil {
+		return err
+	}
+	document, err := encodeDocument(entry)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 0, len(action)+len(document)+2)
+	data = append(append(data, action...), '\n')
+	data = append(append(data, document...), '\n')
+	return w.batcher.Add(&item{index, data})
+}
+
+// Flush sends the batch, retrying the failed items with backoff after
+// 429 and 5xx responses and network errors.
+//
+// If items were dropped, Flush returns ItemErrors, or the last error if
+// the whole batch was dropped.
+func (w *Writer) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close sends the batch and stops sending in the background.
+func (w *Writer) Close() error {
+	return w.batcher.Close()
+}
+
+func (w *Writer) send(batch []interface{}) error {
+	items := make([]*item, len(batch))
+	for i, batchItem := range batch {
+		items[i] = batchItem.(*item)
+	}
+	var dropped ItemErrors
+	var retryErrors ItemErrors
+	var err error
+	w.batcher.Retry(
+		func() bool {
+			var retryItems []*item
+			var itemErrors ItemErrors
+			retryItems, retryErrors, itemErrors, err = w.bulk(items)
+			dropped = append(dropped, itemErrors...)
+			if err != nil {
+				return retryable(err)
+			}
+			items = retryItems
+			return len(items) > 0
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if dropped = append(dropped, retryErrors...); len(dropped) > 0 {
+		return dropped
+	}
+	return nil
+}
+
+// bulk sends a bulk request, and returns the items to retry and their errors,
+// and the errors of the rejected items.
+func (w *Writer) bulk(items []*item) ([]*item, ItemErrors, ItemErrors, error) {
+	var body bytes.Buffer
+	for _, item := range items {
+		body.Write(item.data)
+	}
+	request, err := http.NewRequest("POST", w.url, &body)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	if w.options.Username != "" {
+		request.SetBasicAuth(w.options.Username, w.options.Password)
+	}
+	response, err := w.options.Client.Do(request)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, nil, nil, &ResponseError{response.StatusCode, strings.TrimSpace(string(data))}
+	}
+	var bulkResponse struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&bulkResponse); err != nil {
+		return nil, nil, nil, fmt.Errorf("dlog_elastic: could not decode bulk response: %v", err)
+	}
+	if !bulkResponse.Errors {
+		return nil, nil, nil, nil
+	}
+	if len(bulkResponse.Items) != len(items) {
+		return nil, nil, nil, fmt.Errorf("dlog_elastic: expected %d items in bulk response, got %d", len(items), len(bulkResponse.Items))
+	}
+	var retryItems []*item
+	var retryErrors ItemErrors
+	var itemErrors ItemErrors
+	for i, responseItem := range bulkResponse.Items {
+		// each item has a single key, the action
+		for _, result := range responseItem {
+			if result.Status/100 == 2 {
+				continue
+			}
+			itemError := &ItemError{Index: items[i].index, Status: result.Status}
+			if result.Error != nil {
+				itemError.Type = result.Error.Type
+				itemError.Reason = result.Error.Reason
+			}
+			if result.Status == http.StatusTooManyRequests || result.Status/100 == 5 {
+				retryItems = append(retryItems, items[i])
+				retryErrors = append(retryErrors, itemError)
+			} else {
+				itemErrors = append(itemErrors, itemError)
+			}
+		}
+	}
+	return retryItems, retryErrors, itemErrors, nil
+}
+
+// encodeDocument encodes the Entry as a JSON object.
+func encodeDocument(entry *dlog.Entry) ([]byte, error) {
+	document := make(map[string]interface{}, len(entry.Fields)+4)
+	for key, value := range entry.Fields {
+		document[key] = value
+	}
+	// the keys of the Entry take precedence over fields with the same keys
+	document["@timestamp"] = entry.Time.Format(time.RFC3339Nano)
+	document["message"] = entry.Message
+	delete(document, "level")
+	if entry.Level != dlog.LevelNone {
+		document["level"] = strings.ToLower(entry.Level.String())
+	}
+	delete(document, "caller")
+	if entry.File != "" {
+		document["caller"] = entry.File + ":" + strconv.Itoa(entry.Line)
+	}
+	data, err := json.Marshal(document)
+	if err == nil {
+		return data, nil
+	}
+	// fall back to strings for the values that cannot be encoded
+	for key, value := range entry.Fields {
+		if _, ok := document[key].(string); !ok {
+			if _, err := json.Marshal(value); err != nil {
+				document[key] = fmt.Sprint(value)
+			}
+		}
+	}
+	return json.Marshal(document)
+}
+
+// retryable returns true for network errors and 429 and 5xx responses.
+func retryable(err error) bool {
+	responseError, ok := err.(*ResponseError)
+	return !ok || responseError.StatusCode == http.StatusTooManyRequests || responseError.StatusCode/100 == 5
+}
@@ -0,0 +1,325 @@
+/*
+Package dlog_fluent provides a Fluentd and Fluent Bit backend for dlog.
+
+Entries are buffered and sent with the Forward protocol in PackedForward mode
+over TCP or a unix socket:
+
+	writer, err := dlog_fluent.NewWriter(
+		dlog_fluent.Options{
+			Network:    "tcp",
+			Address:    "localhost:24224",
+			Tag:        "app",
+			RequireAck: true,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = writer.Close() }()
+	dlog.SetLogger(dlog_fluent.NewLogger(writer))
+
+Each Entry is sent as a record with the keys "message", "level", and one key per field,
+and the time of the Entry as an EventTime.
+
+If Options.RequireAck is set, each batch has a chunk ID and is resent with the same
+chunk ID until the server acknowledges it, for at-least-once delivery. Batches that
+could not be sent are retried with backoff until Options.MaxRetries is reached, and
+Entries are kept in memory until Options.BufferLimit is reached, including while a
+batch is retried, after which Entries are dropped and Handle returns ErrBufferFull.
+
+Shared key authentication is not supported.
+*/
+package dlog_fluent // import "go.pedge.io/dlog/fluent"
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+)
+
+const (
+	// DefaultBatchSize is the number of Entries after which a batch is sent if Options.BatchSize is not set.
+	DefaultBatchSize = 256
+	// DefaultFlushInterval is the interval at which batches are sent if Options.FlushInterval is not set.
+	DefaultFlushInterval = time.Second
+	// DefaultBufferLimit is the limit of buffered bytes if Options.BufferLimit is not set.
+	DefaultBufferLimit = 8 << 20
+	// DefaultTimeout is the timeout for connecting, each write, and each ack if Options.Timeout is not set.
+	DefaultTimeout = 10 * time.Second
+	// DefaultMinBackoff is the first backoff if Options.MinBackoff is not set.
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the maximum backoff if Options.MaxBackoff is not set.
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultMaxRetries is the number of retries for a batch if Options.MaxRetries is not set.
+	DefaultMaxRetries = 10
+)
+
+var (
+	// ErrClosed is returned if the Writer is used after Close.
+	ErrClosed = errors.New("dlog_fluent: writer is closed")
+	// ErrBufferFull is returned by Handle if Options.BufferLimit is reached.
+	ErrBufferFull = errors.New("dlog_fluent: buffer is full")
+)
+
+// Options are the options for a Writer.
+type Options struct {
+	// Network is "tcp" or "unix".
+	Network string
+	// Address is the host:port or socket path to connect to.
+	Address string
+	// Tag is the tag of every Entry.
+	Tag string
+	// RequireAck requires the server to acknowledge each batch.
+	RequireAck bool
+	// BatchSize is the number of Entries after which a batch is sent.
+	// If 0, DefaultBatchSize is used.
+	BatchSize int
+	// FlushInterval is the interval at which batches are sent.
+	// If 0, DefaultFlushInterval is used.
+	FlushInterval time.Duration
+	// BufferLimit is the number of bytes of encoded Entries to buffer, including the batch being sent.
+	// If 0, DefaultBufferLimit is used.
+	BufferLimit int
+	// Timeout is the timeout for connecting, each write, and each ack.
+	// If 0, DefaultTimeout is used.
+	Timeout time.Duration
+	// MinBackoff is the backoff after the first failed send, which is doubled after every failure.
+	// If 0, DefaultMinBackoff is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum backoff.
+	// If 0, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+	// MaxRetries is the number of times a batch is retried before it is dropped.
+	// If 0, DefaultMaxRetries is used.
+	MaxRetries int
+}
+
+// Writer is a dlog.EntryHandler that sends Entries to Fluentd or Fluent Bit.
+//
+// Entries are sent in the background. Errors while sending in the
+// background are printed to stderr.
+type Writer struct {
+	options Options
+	batcher *dlog_internal.Batcher
+
+	// connLock guards the connection
+	connLock sync.Mutex
+	conn     net.Conn
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(options Options) (*Writer, error) {
+	switch options.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return nil, fmt.Errorf("dlog_fluent: unknown network: %s", options.Network)
+	}
+	if options.Address == "" {
+		return nil, errors.New("dlog_fluent: no address")
+	}
+	if options.Tag == "" {
+		return nil, errors.New("dlog_fluent: no tag")
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.FlushInterval == 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	if options.BufferLimit == 0 {
+		options.BufferLimit = DefaultBufferLimit
+	}
+	if options.Timeout == 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = DefaultMaxRetries
+	}
+	w := &Writer{options: options}
+	w.batcher = dlog_internal.NewBatcher(
+		dlog_internal.BatcherOptions{
+			BatchSize:     options.BatchSize,
+			FlushInterval: options.FlushInterval,
+			BufferLimit:   options.BufferLimit,
+			Size:          func(item interface{}) int { return len(item.([]byte)) },
+			MinBackoff:    options.MinBackoff,
+			MaxBackoff:    options.MaxBackoff,
+			MaxRetries:    options.MaxRetries,
+			ErrClosed:     ErrClosed,
+			ErrBufferFull: ErrBufferFull,
+			ErrorMessage:  "dlog_fluent: could not send entries",
+		},
+		w.sendItems,
+	)
+	return w, nil
+}
+
+// NewLogger returns a new dlog.Logger that writes to the Writer.
+func NewLogger(writer *Writer) dlog.Logger {
+	return dlog.NewEntryLogger(writer)
+}
+
+// Handle buffers the Entry to be sent.
+func (w *Writer) Handle(entry *dlog.Entry) error {
+	buffer := bytes.NewBuffer(nil)
+	if err := encodeEntry(buffer, entry); err != nil {
+		return err
+	}
+	return w.batcher.Add(buffer.Bytes())
+}
+
+// Flush sends the buffered Entries, retrying with backoff, and returns
+// the last error if the batch was dropped.
+func (w *Writer) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close sends the buffered Entries and closes the connection.
+func (w *Writer) Close() error {
+	err := w.batcher.Close()
+	w.connLock.Lock()
+	defer w.connLock.Unlock()
+	if w.conn != nil {
+		if closeErr := w.conn.Close(); err == nil {
+			err = closeErr
+		}
+		w.conn = nil
+	}
+	return err
+}
+
+// sendItems sends the encoded Entries as one batch, resent with the same chunk.
+func (w *Writer) sendItems(items []interface{}) error {
+	buffer := bytes.NewBuffer(nil)
+	for _, item := range items {
+		buffer.Write(item.([]byte))
+	}
+	var chunk string
+	if w.options.RequireAck {
+		chunkBytes := make([]byte, 16)
+		if _, err := rand.Read(chunkBytes); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(chunkBytes)
+	}
+	var err error
+	w.batcher.Retry(
+		func() bool {
+			err = w.send(buffer.Bytes(), len(items), chunk)
+			return err != nil
+		},
+	)
+	return err
+}
+
+func (w *Writer) send(entries []byte, size int, chunk string) error {
+	w.connLock.Lock()
+	defer w.connLock.Unlock()
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.options.Network, w.options.Address, w.options.Timeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	if err := w.sendBatch(entries, size, chunk); err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// [tag, entries, {"size": size, "chunk": chunk}]
+func (w *Writer) sendBatch(entries []byte, size int, chunk string) error {
+	option := map[string]interface{}{"size": size}
+	if chunk != "" {
+		option["chunk"] = chunk
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, len(entries)+len(w.options.Tag)+64))
+	encoder := msgpack.NewEncoder(buffer)
+	if err := encoder.EncodeArrayLen(3); err != nil {
+		return err
+	}
+	if err := encoder.EncodeString(w.options.Tag); err != nil {
+		return err
+	}
+	if err := encoder.EncodeBytes(entries); err != nil {
+		return err
+	}
+	if err := encoder.Encode(option); err != nil {
+		return err
+	}
+	if err := w.conn.SetDeadline(time.Now().Add(w.options.Timeout)); err != nil {
+		return err
+	}
+	if _, err := w.conn.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	response := make(map[string]interface{})
+	if err := msgpack.NewDecoder(w.conn).Decode(&response); err != nil {
+		return err
+	}
+	if ack, _ := response["ack"].(string); ack != chunk {
+		return fmt.Errorf("dlog_fluent: expected ack %s, got %v", chunk, response["ack"])
+	}
+	return nil
+}
+
+// [EventTime, record]
+func encodeEntry(buffer *bytes.Buffer, entry *dlog.Entry) error {
+	// fixarray of length 2
+	buffer.WriteByte(0x92)
+	// EventTime is fixext8 with type 0, and the big-endian seconds and nanoseconds
+	var eventTime [10]byte
+	eventTime[0] = 0xd7
+	binary.BigEndian.PutUint32(eventTime[2:], uint32(entry.Time.Unix()))
+	binary.BigEndian.PutUint32(eventTime[6:], uint32(entry.Time.Nanosecond()))
+	buffer.Write(eventTime[:])
+	record := make(map[string]interface{}, len(entry.Fields)+2)
+	for key, value := range entry.Fields {
+		record[key] = recordValue(value)
+	}
+	// the message and level take precedence over fields with the same keys
+	record["message"] = entry.Message
+	if entry.Level != dlog.LevelNone {
+		record["level"] = entry.Level.String()
+	} else {
+		delete(record, "level")
+	}
+	return msgpack.NewEncoder(buffer).Encode(record)
+}
+
+// recordValue converts the values that msgpack would encode as extension
+// types or empty maps to strings.
+func recordValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case time.Duration:
+		return value.String()
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return value
+	}
+}
@@ -0,0 +1,344 @@
+/*
+Package dlog_gelf provides a GELF backend for dlog, for use with Graylog.
+
+Entries are written as GELF 1.1 messages over UDP, chunked and compressed, or over TCP:
+
+	writer, err := dlog_gelf.NewWriter(
+		dlog_gelf.Options{
+			Network: "udp",
+			Address: "graylog.example.com:12201",
+		},
+	)
+	if err != nil {
+		return err
+	}
+	dlog.SetLogger(dlog_gelf.NewLogger(writer))
+
+Fields are written as additional fields prefixed with an underscore, except for
+fields named file and line, which are written as _field_file and _field_line as
+_file and _line are the caller, and the level is written as the syslog severity. If an Entry has a StackKey field,
+it is written as the full_message. Otherwise, if the message has multiple lines,
+the first line is the short_message and the message is the full_message.
+*/
+package dlog_gelf // import "go.pedge.io/dlog/gelf"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/syslog"
+)
+
+const (
+	// CompressionGzip compresses UDP messages with gzip.
+	CompressionGzip Compression = iota
+	// CompressionZlib compresses UDP messages with zlib.
+	CompressionZlib
+	// CompressionNone does not compress UDP messages.
+	CompressionNone
+)
+
+const (
+	// StackKey is the field key whose value is written as the full_message.
+	StackKey = "stack"
+	// DefaultChunkSize is the maximum size of a UDP datagram if Options.ChunkSize is not set.
+	DefaultChunkSize = 1420
+
+	version        = "1.1"
+	chunkHeaderLen = 12
+	maxChunks      = 128
+)
+
+var (
+	// ErrClosed is returned if the Writer is used after Close.
+	ErrClosed = errors.New("dlog_gelf: writer is closed")
+
+	chunkMagic = []byte{0x1e, 0x0f}
+)
+
+// Compression is the compression used for UDP messages.
+type Compression int
+
+// Options are the options for a Writer.
+type Options struct {
+	// Network is "udp" or "tcp".
+	Network string
+	// Address is the host:port to send messages to.
+	Address string
+	// Compression is the compression used for UDP messages, by default CompressionGzip.
+	// TCP messages are never compressed.
+	Compression Compression
+	// ChunkSize is the maximum size of a UDP datagram, after which messages are chunked.
+	// If 0, DefaultChunkSize is used.
+	ChunkSize int
+	// Host is the host of every message. If empty, os.Hostname is used.
+	Host string
+	// Timeout is the timeout for connecting and for each write. If 0, there is no timeout.
+	Timeout time.Duration
+}
+
+// Writer is a dlog.EntryHandler that writes Entries as GELF messages.
+//
+// For TCP, the connection is made on the first write, and if a write fails the
+// Writer reconnects and retries the write once.
+type Writer struct {
+	options Options
+
+	lock   sync.Mutex
+	conn   net.Conn
+	buffer *bytes.Buffer
+	closed bool
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(options Options) (*Writer, error) {
+	switch options.Network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("dlog_gelf: unknown network: %s", options.Network)
+	}
+	if options.Address == "" {
+		return nil, errors.New("dlog_gelf: no address")
+	}
+	switch options.Compression {
+	case CompressionGzip, CompressionZlib, CompressionNone:
+	default:
+		return nil, fmt.Errorf("dlog_gelf: unknown compression: %d", options.Compression)
+	}
+	if options.ChunkSize == 0 {
+		options.ChunkSize = DefaultChunkSize
+	}
+	if options.ChunkSize <= chunkHeaderLen {
+		return nil, fmt.Errorf("dlog_gelf: chunk size must be greater than %d: %d", chunkHeaderLen, options.ChunkSize)
+	}
+	if options.Host == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		options.Host = host
+	}
+	return &Writer{
+		options: options,
+		buffer:  bytes.NewBuffer(nil),
+	}, nil
+}
+
+// NewLogger returns a new dlog.Logger that writes to the Writer.
+func NewLogger(writer *Writer) dlog.Logger {
+	return dlog.NewEntryLogger(writer)
+}
+
+// Handle writes the Entry.
+func (w *Writer) Handle(entry *dlog.Entry) error {
+	data, err := json.Marshal(w.message(entry))
+	if err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	if !w.stream() {
+		return w.writeDatagram(data)
+	}
+	if err := w.writeStream(data); err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+		if err := w.connect(); err != nil {
+			return err
+		}
+		return w.writeStream(data)
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *Writer) message(entry *dlog.Entry) map[string]interface{} {
+	message := map[string]interface{}{
+		"version":   version,
+		"host":      w.options.Host,
+		"timestamp": float64(entry.Time.UnixNano()/int64(time.Millisecond)) / 1000,
+		"level":     int(dlog_syslog.LevelToSeverity(entry.Level)),
+	}
+	shortMessage := entry.Message
+	if i := strings.IndexByte(shortMessage, '\n'); i >= 0 {
+		shortMessage = shortMessage[:i]
+		message["full_message"] = entry.Message
+	}
+	if shortMessage == "" {
+		// short_message is required to be non-empty
+		shortMessage = "-"
+	}
+	message["short_message"] = shortMessage
+	for key, value := range entry.Fields {
+		if key == StackKey {
+			message["full_message"] = fmt.Sprint(value)
+			continue
+		}
+		switch key = additionalFieldName(key); key {
+		case "_id":
+			// _id is not allowed
+			continue
+		case "_file", "_line":
+			// _file and _line are the caller
+			key = "_field" + key
+		}
+		message[key] = additionalFieldValue(value)
+	}
+	if entry.File != "" {
+		message["_file"] = entry.File
+		message["_line"] = entry.Line
+	}
+	return message
+}
+
+// connect must be called with the lock held.
+func (w *Writer) connect() error {
+	conn, err := net.DialTimeout(w.options.Network, w.options.Address, w.options.Timeout)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *Writer) stream() bool {
+	return strings.HasPrefix(w.options.Network, "tcp")
+}
+
+// writeStream must be called with the lock held.
+func (w *Writer) writeStream(data []byte) error {
+	if err := w.setDeadline(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write(append(data, 0))
+	return err
+}
+
+// writeDatagram must be called with the lock held.
+func (w *Writer) writeDatagram(data []byte) error {
+	data, err := w.compress(data)
+	if err != nil {
+		return err
+	}
+	if err := w.setDeadline(); err != nil {
+		return err
+	}
+	if len(data) <= w.options.ChunkSize {
+		_, err := w.conn.Write(data)
+		return err
+	}
+	chunkDataSize := w.options.ChunkSize - chunkHeaderLen
+	numChunks := (len(data) + chunkDataSize - 1) / chunkDataSize
+	if numChunks > maxChunks {
+		return fmt.Errorf("dlog_gelf: message of %d bytes needs more than %d chunks", len(data), maxChunks)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	chunk := make([]byte, 0, w.options.ChunkSize)
+	for i := 0; i < numChunks; i++ {
+		chunk = append(chunk[:0], chunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(numChunks))
+		end := (i + 1) * chunkDataSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk = append(chunk, data[i*chunkDataSize:end]...)
+		if _, err := w.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress must be called with the lock held.
+func (w *Writer) compress(data []byte) ([]byte, error) {
+	var writer io.WriteCloser
+	w.buffer.Reset()
+	switch w.options.Compression {
+	case CompressionGzip:
+		writer = gzip.NewWriter(w.buffer)
+	case CompressionZlib:
+		writer = zlib.NewWriter(w.buffer)
+	default:
+		return data, nil
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return w.buffer.Bytes(), nil
+}
+
+func (w *Writer) setDeadline() error {
+	if w.options.Timeout > 0 {
+		return w.conn.SetWriteDeadline(time.Now().Add(w.options.Timeout))
+	}
+	return nil
+}
+
+// additionalFieldName returns the key prefixed with an underscore, with
+// the characters not allowed in GELF field names replaced with underscores.
+func additionalFieldName(key string) string {
+	return "_" + strings.Map(
+		func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+				return r
+			default:
+				return '_'
+			}
+		},
+		key,
+	)
+}
+
+// additionalFieldValue returns the value if it is a number, or the value
+// formatted as a string otherwise, as GELF only allows strings and numbers.
+func additionalFieldValue(value interface{}) interface{} {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -11,16 +11,24 @@ import (
 	"github.com/golang/glog"
 )
 
+func init() {
+	dlog.RegisterBackend("glog", NewLogger)
+}
+
 // Register registers the default glog Logger as the dlog Logger.
 func Register() {
 	dlog.SetLogger(NewLogger())
 }
 
 // NewLogger returns a new dlog.Logger for glog.
+//
+// glog has no trace or debug level, so both are logged with glog.Infoln.
+// Custom Levels are logged with the function for dlog.StandardLevel(level).
 func NewLogger() dlog.Logger {
 	return dlog.NewLogger(
 		glog.Infoln,
 		map[dlog.Level]func(...interface{}){
+			dlog.LevelTrace: glog.Infoln,
 			dlog.LevelDebug: glog.Infoln,
 			dlog.LevelInfo:  glog.Infoln,
 			dlog.LevelWarn:  glog.Warningln,
@@ -0,0 +1,208 @@
+/*
+Package dlog_gokit provides go-kit log functionality for dlog.
+
+https://github.com/go-kit/log
+*/
+package dlog_gokit // import "go.pedge.io/dlog/gokit"
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.pedge.io/dlog"
+)
+
+// MessageKey is the key of messages.
+const MessageKey = "msg"
+
+func init() {
+	dlog.RegisterBackend(
+		"gokit",
+		func() dlog.Logger {
+			return NewLogger(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)))
+		},
+	)
+}
+
+// Register registers a go-kit logfmt Logger that writes to stderr as the dlog Logger.
+func Register() {
+	dlog.SetLogger(NewLogger(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))))
+}
+
+// NewLogger returns a new dlog.Logger that uses the go-kit log.Logger.
+//
+// Entries are logged with the level from the go-kit level package, and the message as
+// MessageKey. go-kit has no trace, fatal, or panic level, so dlog.LevelTrace is logged
+// at level.Debug, and dlog.LevelFatal and dlog.LevelPanic at level.Error before exiting
+// or panicking. Custom Levels are logged at the go-kit level for dlog.StandardLevel(level).
+//
+// AtLevel filters the log.Logger with level.NewFilter. go-kit Loggers cannot be queried
+// for their level, so Enabled returns true until AtLevel is called.
+//
+// dlog.Lazy field values are translated to log.Valuers, which are only evaluated
+// for entries that pass the level filter.
+func NewLogger(gokitLogger log.Logger) dlog.Logger {
+	return newLogger(gokitLogger, dlog.LevelNone)
+}
+
+type logger struct {
+	// base has the fields, but not the level filter
+	base     log.Logger
+	level    dlog.Level
+	filtered log.Logger
+}
+
+func newLogger(base log.Logger, l dlog.Level) *logger {
+	filtered := base
+	if l != dlog.LevelNone {
+		filtered = level.NewFilter(base, levelToAllow(dlog.StandardLevel(l)))
+	}
+	return &logger{base, l, filtered}
+}
+
+func (l *logger) Enabled(level dlog.Level) bool {
+	return l.level == dlog.LevelNone || levelToFilterLevel(dlog.StandardLevel(level)) >= levelToFilterLevel(dlog.StandardLevel(l.level))
+}
+
+func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
+	return newLogger(l.base, level)
+}
+
+func (l *logger) WithField(key string, value interface{}) dlog.Logger {
+	return newLogger(log.With(l.base, key, gokitValue(value)), l.level)
+}
+
+func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
+	keyvals := make([]interface{}, 0, len(fields)*2)
+	for key, value := range fields {
+		keyvals = append(keyvals, key, gokitValue(value))
+	}
+	return newLogger(log.With(l.base, keyvals...), l.level)
+}
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	keyvals := make([]interface{}, 0, len(fields)*2)
+	for _, field := range fields {
+		keyvals = append(keyvals, field.Key, gokitValue(field.Value()))
+	}
+	return newLogger(log.With(l.base, keyvals...), l.level)
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.log(level.Debug, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.log(level.Debug, fmt.Sprint(args...))
+}
+
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.log(level.Debug, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Debugln(args ...interface{}) {
+	l.log(level.Debug, fmt.Sprint(args...))
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.log(level.Info, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Infoln(args ...interface{}) {
+	l.log(level.Info, fmt.Sprint(args...))
+}
+
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.log(level.Warn, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Warnln(args ...interface{}) {
+	l.log(level.Warn, fmt.Sprint(args...))
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.log(level.Error, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Errorln(args ...interface{}) {
+	l.log(level.Error, fmt.Sprint(args...))
+}
+
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	l.log(level.Error, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (l *logger) Fatalln(args ...interface{}) {
+	l.log(level.Error, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+func (l *logger) Panicf(format string, args ...interface{}) {
+	l.log(level.Error, fmt.Sprintf(format, args...))
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Panicln(args ...interface{}) {
+	l.log(level.Error, fmt.Sprint(args...))
+	panic(fmt.Sprint(args...))
+}
+
+func (l *logger) Printf(format string, args ...interface{}) {
+	l.log(level.Info, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Println(args ...interface{}) {
+	l.log(level.Info, fmt.Sprint(args...))
+}
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	dlog.BaseLogf(l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	dlog.BaseLogln(l, level, args...)
+}
+
+func (l *logger) log(withLevel func(log.Logger) log.Logger, message string) {
+	if err := withLevel(l.filtered).Log(MessageKey, message); err != nil {
+		fmt.Fprintf(os.Stderr, "dlog_gokit: could not log: %s: %v\n", message, err)
+	}
+}
+
+// levelToFilterLevel returns the go-kit level that the dlog.Level is logged at,
+// as dlog.LevelDebug, dlog.LevelInfo, dlog.LevelWarn, or dlog.LevelError.
+func levelToFilterLevel(l dlog.Level) dlog.Level {
+	switch {
+	case l <= dlog.LevelDebug && l != dlog.LevelNone:
+		return dlog.LevelDebug
+	case l >= dlog.LevelError:
+		return dlog.LevelError
+	case l == dlog.LevelWarn:
+		return dlog.LevelWarn
+	default:
+		return dlog.LevelInfo
+	}
+}
+
+func levelToAllow(l dlog.Level) level.Option {
+	switch levelToFilterLevel(l) {
+	case dlog.LevelDebug:
+		return level.AllowDebug()
+	case dlog.LevelWarn:
+		return level.AllowWarn()
+	case dlog.LevelError:
+		return level.AllowError()
+	default:
+		return level.AllowInfo()
+	}
+}
+
+func gokitValue(value interface{}) interface{} {
+	if lazy, ok := value.(dlog.Lazy); ok {
+		return log.Valuer(lazy)
+	}
+	return value
+}
@@ -0,0 +1,199 @@
+/*
+Package dlog_hclog provides hclog functionality for dlog.
+
+https://github.com/hashicorp/go-hclog
+*/
+package dlog_hclog // import "go.pedge.io/dlog/hclog"
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"go.pedge.io/dlog"
+)
+
+var (
+	levelToHclogLevel = map[dlog.Level]hclog.Level{
+		dlog.LevelNone:  hclog.Info,
+		dlog.LevelTrace: hclog.Trace,
+		dlog.LevelDebug: hclog.Debug,
+		dlog.LevelInfo:  hclog.Info,
+		dlog.LevelWarn:  hclog.Warn,
+		dlog.LevelError: hclog.Error,
+		dlog.LevelFatal: hclog.Error,
+		dlog.LevelPanic: hclog.Error,
+	}
+)
+
+func init() {
+	dlog.RegisterBackend(
+		"hclog",
+		func() dlog.Logger {
+			return NewLogger(hclog.New(&hclog.LoggerOptions{IndependentLevels: true}))
+		},
+	)
+}
+
+// Register registers a new hclog Logger with the default options and IndependentLevels
+// as the dlog Logger.
+//
+// hclog.Default() is not used, as it is not created with IndependentLevels.
+func Register() {
+	dlog.SetLogger(NewLogger(hclog.New(&hclog.LoggerOptions{IndependentLevels: true})))
+}
+
+// NewLogger returns a new dlog.Logger that uses the hclog.Logger.
+//
+// hclog has no fatal or panic level, so dlog.LevelFatal and dlog.LevelPanic are logged
+// at hclog.Error before exiting or panicking. Custom Levels are logged at the hclog level
+// for dlog.StandardLevel(level).
+//
+// Fields with the key dlog.ComponentKey and a string value name the hclog.Logger with
+// Named instead of being added as fields.
+//
+// AtLevel calls SetLevel on a derived hclog.Logger, which only leaves the level of
+// the parent unchanged if the hclog.Logger was created with IndependentLevels.
+func NewLogger(hclogLogger hclog.Logger) dlog.Logger {
+	return &logger{hclogLogger}
+}
+
+type logger struct {
+	l hclog.Logger
+}
+
+func (l *logger) Enabled(level dlog.Level) bool {
+	switch levelToHclogLevel[dlog.StandardLevel(level)] {
+	case hclog.Trace:
+		return l.l.IsTrace()
+	case hclog.Debug:
+		return l.l.IsDebug()
+	case hclog.Info:
+		return l.l.IsInfo()
+	case hclog.Warn:
+		return l.l.IsWarn()
+	default:
+		return l.l.IsError()
+	}
+}
+
+func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
+	hclogLogger := l.l.With()
+	hclogLogger.SetLevel(levelToHclogLevel[dlog.StandardLevel(level)])
+	return &logger{hclogLogger}
+}
+
+func (l *logger) WithField(key string, value interface{}) dlog.Logger {
+	return l.With(dlog.Any(key, value))
+}
+
+func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
+	args := make([]interface{}, 0, len(fields)*2)
+	hclogLogger := l.l
+	for key, value := range fields {
+		if name, ok := value.(string); ok && key == dlog.ComponentKey {
+			hclogLogger = hclogLogger.Named(name)
+			continue
+		}
+		args = append(args, key, value)
+	}
+	return &logger{hclogLogger.With(args...)}
+}
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	args := make([]interface{}, 0, len(fields)*2)
+	hclogLogger := l.l
+	for _, field := range fields {
+		if field.Key == dlog.ComponentKey && field.Type == dlog.FieldTypeString {
+			hclogLogger = hclogLogger.Named(field.String)
+			continue
+		}
+		args = append(args, field.Key, field.Value())
+	}
+	return &logger{hclogLogger.With(args...)}
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.l.Trace(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.l.Trace(fmt.Sprint(args...))
+}
+
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.l.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Debugln(args ...interface{}) {
+	l.l.Debug(fmt.Sprint(args...))
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.l.Info(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Infoln(args ...interface{}) {
+	l.l.Info(fmt.Sprint(args...))
+}
+
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.l.Warn(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Warnln(args ...interface{}) {
+	l.l.Warn(fmt.Sprint(args...))
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.l.Error(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Errorln(args ...interface{}) {
+	l.l.Error(fmt.Sprint(args...))
+}
+
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	l.l.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (l *logger) Fatalln(args ...interface{}) {
+	l.l.Error(fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+func (l *logger) Panicf(format string, args ...interface{}) {
+	l.l.Error(fmt.Sprintf(format, args...))
+	panic(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Panicln(args ...interface{}) {
+	l.l.Error(fmt.Sprint(args...))
+	panic(fmt.Sprint(args...))
+}
+
+func (l *logger) Printf(format string, args ...interface{}) {
+	l.l.Info(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Println(args ...interface{}) {
+	l.l.Info(fmt.Sprint(args...))
+}
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	// dlog.BaseLogf logs dlog.LevelTrace at the debug level, but hclog has a trace level
+	if dlog.StandardLevel(level) == dlog.LevelTrace {
+		l.Tracef(format, args...)
+		return
+	}
+	dlog.BaseLogf(l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	if dlog.StandardLevel(level) == dlog.LevelTrace {
+		l.Traceln(args...)
+		return
+	}
+	dlog.BaseLogln(l, level, args...)
+}
@@ -0,0 +1,163 @@
+package dlog_internal
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// BatcherOptions are the options for a Batcher. All fields but Size must be set.
+type BatcherOptions struct {
+	// BatchSize is the number of items after which a batch is sent in the background.
+	BatchSize int
+	// FlushInterval is the interval at which batches are sent in the background.
+	FlushInterval time.Duration
+	// BufferLimit is the total size of the items to buffer, including the batch being sent.
+	BufferLimit int
+	// Size returns the size of an item counted against BufferLimit.
+	// If nil, the size of every item is 1.
+	Size func(item interface{}) int
+	// MinBackoff is the first backoff of Retry, which is doubled after every retry.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum backoff of Retry.
+	MaxBackoff time.Duration
+	// MaxRetries is the number of times Retry retries.
+	MaxRetries int
+	// ErrClosed is returned by Add and Close after Close.
+	ErrClosed error
+	// ErrBufferFull is returned by Add if BufferLimit is reached.
+	ErrBufferFull error
+	// ErrorMessage prefixes the errors of background sends printed to stderr.
+	ErrorMessage string
+}
+
+// Batcher buffers items and sends them in batches in the background.
+type Batcher struct {
+	options BatcherOptions
+	send    func([]interface{}) error
+
+	// lock guards the batch
+	lock     sync.Mutex
+	batch    []interface{}
+	buffered int
+	closed   bool
+
+	// sendLock serializes sends
+	sendLock sync.Mutex
+
+	flushC chan struct{}
+	doneC  chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewBatcher returns a new Batcher that sends batches with send.
+func NewBatcher(options BatcherOptions, send func([]interface{}) error) *Batcher {
+	b := &Batcher{
+		options: options,
+		send:    send,
+		flushC:  make(chan struct{}, 1),
+		doneC:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+// Add adds the item to the batch.
+func (b *Batcher) Add(item interface{}) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return b.options.ErrClosed
+	}
+	if b.buffered >= b.options.BufferLimit {
+		return b.options.ErrBufferFull
+	}
+	b.batch = append(b.batch, item)
+	b.buffered += b.size(item)
+	if len(b.batch) >= b.options.BatchSize {
+		select {
+		case b.flushC <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush sends the batch and returns the error of send.
+func (b *Batcher) Flush() error {
+	b.sendLock.Lock()
+	defer b.sendLock.Unlock()
+	b.lock.Lock()
+	batch := b.batch
+	b.batch = nil
+	b.lock.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	err := b.send(batch)
+	size := 0
+	for _, item := range batch {
+		size += b.size(item)
+	}
+	b.lock.Lock()
+	b.buffered -= size
+	b.lock.Unlock()
+	return err
+}
+
+// Close sends the batch and stops sending in the background.
+func (b *Batcher) Close() error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return b.options.ErrClosed
+	}
+	b.closed = true
+	b.lock.Unlock()
+	close(b.doneC)
+	b.wg.Wait()
+	return b.Flush()
+}
+
+// Retry calls f until it returns false or was retried BatcherOptions.MaxRetries
+// times, with exponential backoff between the calls. Retry returns without
+// waiting for the full backoff if the Batcher is closed.
+func (b *Batcher) Retry(f func() bool) {
+	backoff := b.options.MinBackoff
+	for retries := 0; f() && retries < b.options.MaxRetries; retries++ {
+		select {
+		case <-time.After(backoff):
+		case <-b.doneC:
+			return
+		}
+		if backoff *= 2; backoff > b.options.MaxBackoff {
+			backoff = b.options.MaxBackoff
+		}
+	}
+}
+
+func (b *Batcher) size(item interface{}) int {
+	if b.options.Size == nil {
+		return 1
+	}
+	return b.options.Size(item)
+}
+
+func (b *Batcher) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.flushC:
+		case <-b.doneC:
+			return
+		}
+		if err := b.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", b.options.ErrorMessage, err)
+		}
+	}
+}
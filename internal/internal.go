@@ -0,0 +1,47 @@
+/*
+Package dlog_internal provides helpers shared by the dlog packages.
+*/
+package dlog_internal // import "go.pedge.io/dlog/internal"
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const maxRequestIDLength = 128
+
+// SortedKeys returns the keys of the fields, sorted.
+func SortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ValidRequestID returns true for non-empty printable ASCII request IDs
+// of at most 128 characters, so that they cannot forge log lines.
+func ValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a random 128-bit hex request ID.
+func NewRequestID() string {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(data)
+}
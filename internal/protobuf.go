@@ -0,0 +1,39 @@
+package dlog_internal
+
+import (
+	"encoding/binary"
+)
+
+// AppendProtobufVarint appends the varint field.
+func AppendProtobufVarint(buffer []byte, fieldNumber int, value uint64) []byte {
+	buffer = appendUvarint(buffer, uint64(fieldNumber)<<3)
+	return appendUvarint(buffer, value)
+}
+
+// AppendProtobufFixed32 appends the 32-bit field.
+func AppendProtobufFixed32(buffer []byte, fieldNumber int, value uint32) []byte {
+	buffer = appendUvarint(buffer, uint64(fieldNumber)<<3|5)
+	var fixed [4]byte
+	binary.LittleEndian.PutUint32(fixed[:], value)
+	return append(buffer, fixed[:]...)
+}
+
+// AppendProtobufFixed64 appends the 64-bit field.
+func AppendProtobufFixed64(buffer []byte, fieldNumber int, value uint64) []byte {
+	buffer = appendUvarint(buffer, uint64(fieldNumber)<<3|1)
+	var fixed [8]byte
+	binary.LittleEndian.PutUint64(fixed[:], value)
+	return append(buffer, fixed[:]...)
+}
+
+// AppendProtobufBytes appends the length-delimited field.
+func AppendProtobufBytes(buffer []byte, fieldNumber int, value []byte) []byte {
+	buffer = appendUvarint(buffer, uint64(fieldNumber)<<3|2)
+	buffer = appendUvarint(buffer, uint64(len(value)))
+	return append(buffer, value...)
+}
+
+func appendUvarint(buffer []byte, value uint64) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	return append(buffer, varint[:binary.PutUvarint(varint[:], value)]...)
+}
@@ -0,0 +1,154 @@
+/*
+Package dlog_journald provides a systemd journald backend for dlog.
+
+Entries are written with journald's native protocol, so that fields can be queried
+with journalctl:
+
+	writer, err := dlog_journald.NewWriter(dlog_journald.Options{})
+	if err != nil {
+		return err
+	}
+	dlog.SetLogger(dlog_journald.NewLogger(writer))
+
+	dlog.WithField("request_id", "1234").Infoln("hello")
+
+	$ journalctl REQUEST_ID=1234
+
+Each Entry is written with the MESSAGE, PRIORITY, CODE_FILE, CODE_LINE, and
+SYSLOG_IDENTIFIER fields, and one field per dlog field. Field keys are uppercased,
+and characters that are not allowed in journal field names are replaced with underscores.
+
+The native protocol is only supported on linux.
+*/
+package dlog_journald // import "go.pedge.io/dlog/journald"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+	"go.pedge.io/dlog/syslog"
+)
+
+const (
+	// DefaultSocketPath is the path of journald's native protocol socket.
+	DefaultSocketPath = "/run/systemd/journal/socket"
+
+	maxFieldNameLen = 64
+)
+
+var (
+	// ErrClosed is returned if the Writer is used after Close.
+	ErrClosed = errors.New("dlog_journald: writer is closed")
+
+	reservedFieldNames = map[string]bool{
+		"MESSAGE":           true,
+		"PRIORITY":          true,
+		"CODE_FILE":         true,
+		"CODE_LINE":         true,
+		"SYSLOG_IDENTIFIER": true,
+	}
+)
+
+// Options are the options for a Writer.
+type Options struct {
+	// SocketPath is the path of the journald socket. If empty, DefaultSocketPath is used.
+	SocketPath string
+	// Identifier is the SYSLOG_IDENTIFIER of every entry. If empty, the name of the executable is used.
+	Identifier string
+}
+
+// NewLogger returns a new dlog.Logger that writes to the Writer.
+func NewLogger(writer *Writer) dlog.Logger {
+	return dlog.NewEntryLogger(writer)
+}
+
+// LevelToPriority returns the journald PRIORITY for the dlog.Level,
+// which is the syslog severity.
+func LevelToPriority(level dlog.Level) int {
+	return int(dlog_syslog.LevelToSeverity(level))
+}
+
+// FieldName returns the journal field name for the dlog field key.
+//
+// The key is uppercased, characters other than A-Z, 0-9 and underscore
+// are replaced with underscores, leading underscores are removed, names
+// that would start with a digit are prefixed with "X_", and the name is
+// truncated to 64 characters.
+func FieldName(key string) string {
+	name := strings.TrimLeft(
+		strings.Map(
+			func(r rune) rune {
+				switch {
+				case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+					return r
+				case r >= 'a' && r <= 'z':
+					return r - 'a' + 'A'
+				default:
+					return '_'
+				}
+			},
+			key,
+		),
+		"_",
+	)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "X_" + name
+	}
+	if len(name) > maxFieldNameLen {
+		name = name[:maxFieldNameLen]
+	}
+	return name
+}
+
+func newOptions(options Options) Options {
+	if options.SocketPath == "" {
+		options.SocketPath = DefaultSocketPath
+	}
+	if options.Identifier == "" {
+		options.Identifier = filepath.Base(os.Args[0])
+	}
+	return options
+}
+
+func appendEntry(buffer []byte, identifier string, entry *dlog.Entry) []byte {
+	buffer = appendField(buffer, "MESSAGE", entry.Message)
+	buffer = appendField(buffer, "PRIORITY", strconv.Itoa(LevelToPriority(entry.Level)))
+	if entry.File != "" {
+		buffer = appendField(buffer, "CODE_FILE", entry.File)
+		buffer = appendField(buffer, "CODE_LINE", strconv.Itoa(entry.Line))
+	}
+	buffer = appendField(buffer, "SYSLOG_IDENTIFIER", identifier)
+	for _, key := range dlog_internal.SortedKeys(entry.Fields) {
+		name := FieldName(key)
+		if reservedFieldNames[name] {
+			// the reserved names would result in duplicate fields
+			continue
+		}
+		buffer = appendField(buffer, name, fmt.Sprint(entry.Fields[key]))
+	}
+	return buffer
+}
+
+// appendField appends NAME=value, or the binary-safe form with the
+// length of the value as a little-endian uint64 if the value contains a newline.
+func appendField(buffer []byte, name string, value string) []byte {
+	buffer = append(buffer, name...)
+	if !strings.Contains(value, "\n") {
+		buffer = append(buffer, '=')
+		buffer = append(buffer, value...)
+		return append(buffer, '\n')
+	}
+	buffer = append(buffer, '\n')
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(value)))
+	buffer = append(buffer, length[:]...)
+	buffer = append(buffer, value...)
+	return append(buffer, '\n')
+}
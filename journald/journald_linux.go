@@ -0,0 +1,117 @@
+package dlog_journald
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+
+	"go.pedge.io/dlog"
+	"golang.org/x/sys/unix"
+)
+
+// Writer is a dlog.EntryHandler that writes Entries to journald.
+//
+// Entries too large for a datagram are written to a sealed memfd,
+// or a temporary file if memfd is not supported, which is passed to journald.
+type Writer struct {
+	options    Options
+	socketAddr *net.UnixAddr
+
+	lock   sync.Mutex
+	conn   *net.UnixConn
+	buffer []byte
+	closed bool
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(options Options) (*Writer, error) {
+	options = newOptions(options)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		options:    options,
+		socketAddr: &net.UnixAddr{Name: options.SocketPath, Net: "unixgram"},
+		conn:       conn,
+	}, nil
+}
+
+// Handle writes the Entry.
+func (w *Writer) Handle(entry *dlog.Entry) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.buffer = appendEntry(w.buffer[:0], w.options.Identifier, entry)
+	_, _, err := w.conn.WriteMsgUnix(w.buffer, nil, w.socketAddr)
+	if err == nil || !isTooLarge(err) {
+		return err
+	}
+	file, err := newFile(w.buffer)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	_, _, err = w.conn.WriteMsgUnix(nil, unix.UnixRights(int(file.Fd())), w.socketAddr)
+	return err
+}
+
+// Close closes the socket.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	return w.conn.Close()
+}
+
+// newFile returns a sealed memfd, or an unlinked temporary file if memfd
+// is not supported, containing the data.
+func newFile(data []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("dlog-journald", unix.MFD_ALLOW_SEALING|unix.MFD_CLOEXEC)
+	if err != nil {
+		return newTempFile(data)
+	}
+	file := os.NewFile(uintptr(fd), "dlog-journald")
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func newTempFile(data []byte) (*os.File, error) {
+	file, err := ioutil.TempFile("/dev/shm", "dlog-journald")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func isTooLarge(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if syscallErr, ok := err.(*os.SyscallError); ok {
+		err = syscallErr.Err
+	}
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+// +build !linux
+
+package dlog_journald
+
+import (
+	"errors"
+
+	"go.pedge.io/dlog"
+)
+
+// ErrNotSupported is returned by NewWriter on platforms other than linux.
+var ErrNotSupported = errors.New("dlog_journald: journald is only supported on linux")
+
+// Writer is a dlog.EntryHandler that writes Entries to journald.
+type Writer struct{}
+
+// NewWriter returns ErrNotSupported.
+func NewWriter(options Options) (*Writer, error) {
+	return nil, ErrNotSupported
+}
+
+// Handle returns ErrNotSupported.
+func (w *Writer) Handle(entry *dlog.Entry) error {
+	return ErrNotSupported
+}
+
+// Close returns ErrNotSupported.
+func (w *Writer) Close() error {
+	return ErrNotSupported
+}
@@ -0,0 +1,132 @@
+/*
+Package dlog_klog provides klog functionality for dlog.
+
+https://github.com/kubernetes/klog
+*/
+package dlog_klog // import "go.pedge.io/dlog/klog"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DebugVerbosity is the klog verbosity of dlog.LevelDebug.
+	DebugVerbosity klog.Level = 4
+	// TraceVerbosity is the klog verbosity of dlog.LevelTrace.
+	TraceVerbosity klog.Level = 5
+)
+
+func init() {
+	dlog.RegisterBackend("klog", NewLogger)
+}
+
+// Register registers the klog Logger as the dlog Logger.
+func Register() {
+	dlog.SetLogger(NewLogger())
+}
+
+// NewLogger returns a new dlog.Logger for klog.
+//
+// dlog.LevelDebug is logged with klog.V(DebugVerbosity).InfoS, dlog.LevelTrace with
+// klog.V(TraceVerbosity).InfoS, and dlog.LevelInfo with klog.InfoS, with the fields as
+// key/value pairs. dlog.LevelError and above are logged with klog.ErrorS, with the field
+// "error" as the error. klog has no structured warning, so dlog.LevelWarn is logged with
+// klog.Warning, with the fields appended to the message. dlog.LevelFatal flushes and exits.
+// Custom Levels are logged as dlog.StandardLevel(level).
+//
+// The Logger is not filtered by the dlog level, dlog.LevelDebug and dlog.LevelTrace are
+// enabled if the klog verbosity is at least DebugVerbosity and TraceVerbosity.
+func NewLogger() dlog.Logger {
+	return dlog.NewEntryLogger(&entryHandler{}).AtLevel(dlog.LevelNone)
+}
+
+type entryHandler struct{}
+
+func (h *entryHandler) Enabled(level dlog.Level) bool {
+	switch dlog.StandardLevel(level) {
+	case dlog.LevelTrace:
+		return klog.V(TraceVerbosity).Enabled()
+	case dlog.LevelDebug:
+		return klog.V(DebugVerbosity).Enabled()
+	default:
+		return true
+	}
+}
+
+func (h *entryHandler) Handle(entry *dlog.Entry) error {
+	depth := callerDepth(entry)
+	switch level := dlog.StandardLevel(entry.Level); level {
+	case dlog.LevelTrace:
+		klog.V(TraceVerbosity).InfoSDepth(depth, entry.Message, fieldsToKeysAndValues(entry.Fields, false)...)
+	case dlog.LevelDebug:
+		klog.V(DebugVerbosity).InfoSDepth(depth, entry.Message, fieldsToKeysAndValues(entry.Fields, false)...)
+	case dlog.LevelWarn:
+		klog.WarningDepth(depth, appendFields(entry.Message, entry.Fields))
+	case dlog.LevelError, dlog.LevelFatal, dlog.LevelPanic:
+		var err error
+		switch value := entry.Fields["error"].(type) {
+		case error:
+			err = value
+		case string:
+			// errors are converted to strings in Entries
+			err = errors.New(value)
+		}
+		klog.ErrorSDepth(depth, err, entry.Message, fieldsToKeysAndValues(entry.Fields, err != nil)...)
+		if level == dlog.LevelFatal {
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+	default:
+		klog.InfoSDepth(depth, entry.Message, fieldsToKeysAndValues(entry.Fields, false)...)
+	}
+	return nil
+}
+
+// callerDepth returns the depth of the caller of the Entry from Handle, for the klog
+// functions that take a depth, or 0 if the caller is not on the stack.
+func callerDepth(entry *dlog.Entry) int {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for depth := 0; ; depth++ {
+		frame, more := frames.Next()
+		if frame.File == entry.File && frame.Line == entry.Line {
+			return depth
+		}
+		if !more {
+			return 0
+		}
+	}
+}
+
+// fieldsToKeysAndValues returns the fields sorted by key, without the error if skipError is set.
+func fieldsToKeysAndValues(fields map[string]interface{}, skipError bool) []interface{} {
+	keys := dlog_internal.SortedKeys(fields)
+	keysAndValues := make([]interface{}, 0, len(keys)*2)
+	for _, key := range keys {
+		if skipError && key == "error" {
+			continue
+		}
+		keysAndValues = append(keysAndValues, key, fields[key])
+	}
+	return keysAndValues
+}
+
+// appendFields appends the fields sorted by key to the message, formatted like klog.InfoS.
+func appendFields(message string, fields map[string]interface{}) string {
+	parts := []string{strconv.Quote(message)}
+	for _, key := range dlog_internal.SortedKeys(fields) {
+		if value, ok := fields[key].(string); ok {
+			parts = append(parts, key+"="+strconv.Quote(value))
+		} else {
+			parts = append(parts, key+"="+fmt.Sprint(fields[key]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -10,6 +10,19 @@ import (
 	"go.pedge.io/lion"
 )
 
+var (
+	levelToLionLevel = map[dlog.Level]lion.Level{
+		dlog.LevelNone:  lion.LevelNone,
+		dlog.LevelTrace: lion.LevelDebug,
+		dlog.LevelDebug: lion.LevelDebug,
+		dlog.LevelInfo:  lion.LevelInfo,
+		dlog.LevelWarn:  lion.LevelWarn,
+		dlog.LevelError: lion.LevelError,
+		dlog.LevelFatal: lion.LevelFatal,
+		dlog.LevelPanic: lion.LevelPanic,
+	}
+)
+
 // Register registers the default lion Logger as the dlog Logger.
 func Register() {
 	lion.AddGlobalHook(
@@ -20,29 +33,65 @@ func Register() {
 }
 
 // NewLogger returns a new dlog.Logger for the given lion.Logger.
+//
+// lion has no trace level, so dlog.LevelTrace is logged at lion.LevelDebug.
+// Custom Levels are logged at the lion level for dlog.StandardLevel(level).
+//
+// dlog.Lazy field values implement fmt.Stringer and json.Marshaler, and are
+// evaluated when lion formats them.
+//
+// Enabled returns true until AtLevel is called, since the Level of the
+// lion.Logger is not known.
 func NewLogger(lionLogger lion.Logger) dlog.Logger {
-	return newLogger(lionLogger)
+	return newLogger(lionLogger, nil)
 }
 
 type logger struct {
 	dlog.BaseLogger
 	l lion.Logger
+	// nil until AtLevel is called
+	level *dlog.Level
+}
+
+func newLogger(l lion.Logger, level *dlog.Level) *logger {
+	return &logger{l, l, level}
 }
 
-func newLogger(l lion.Logger) *logger {
-	return &logger{l, l}
+func (l *logger) Enabled(level dlog.Level) bool {
+	if l.level == nil {
+		return true
+	}
+	return levelToLionLevel[dlog.StandardLevel(level)] >= levelToLionLevel[dlog.StandardLevel(*l.level)]
 }
 
 func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
-	// TODO(pedge): don't be lazy, make an actual map between dlog.Level and lion.Level
-	// you just copy/pasted lion_level.go to dlog_level.go
-	return newLogger(l.l.AtLevel(lion.Level(level)))
+	return newLogger(l.l.AtLevel(levelToLionLevel[dlog.StandardLevel(level)]), &level)
 }
 
 func (l *logger) WithField(key string, value interface{}) dlog.Logger {
-	return newLogger(l.l.WithField(key, value))
+	return newLogger(l.l.WithField(key, value), l.level)
 }
 
 func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
-	return newLogger(l.l.WithFields(fields))
+	return newLogger(l.l.WithFields(fields), l.level)
+}
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	return l.WithFields(dlog.FieldsToMap(fields))
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.l.Debugf(format, args...)
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.l.Debugln(args...)
+}
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	dlog.BaseLogf(l.l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	dlog.BaseLogln(l.l, level, args...)
 }
@@ -16,6 +16,7 @@ import (
 var (
 	levelToLog15Level = map[dlog.Level]log15.Lvl{
 		dlog.LevelNone:  log15.LvlInfo,
+		dlog.LevelTrace: log15.LvlDebug,
 		dlog.LevelDebug: log15.LvlDebug,
 		dlog.LevelInfo:  log15.LvlInfo,
 		dlog.LevelWarn:  log15.LvlWarn,
@@ -25,22 +26,51 @@ var (
 	}
 )
 
+func init() {
+	dlog.RegisterBackend(
+		"log15",
+		func() dlog.Logger {
+			return NewLogger(log15.New())
+		},
+	)
+}
+
 // Register registers the default log15 Logger as the dlog Logger.
 func Register() {
 	dlog.SetLogger(NewLogger(log15.Root()))
 }
 
 // NewLogger returns a new dlog.Logger that uses the log15.Logger.
+//
+// log15 has no trace level, so dlog.LevelTrace is logged at log15.LvlDebug.
+// Custom Levels are logged at the log15 level for dlog.StandardLevel(level).
+//
+// dlog.Lazy field values are translated to log15.Lazy values.
+//
+// log15 handlers cannot be queried for their level, so Enabled returns true
+// until AtLevel is called on the dlog.Logger or one of its parents.
 func NewLogger(log15Logger log15.Logger) dlog.Logger {
-	return newLogger(log15Logger)
+	return newLogger(log15Logger, nil)
 }
 
 type logger struct {
-	l log15.Logger
+	l      log15.Logger
+	parent *logger
+	// nil until AtLevel is called
+	level *dlog.Level
 }
 
-func newLogger(l log15.Logger) *logger {
-	return &logger{l}
+func newLogger(l log15.Logger, parent *logger) *logger {
+	return &logger{l, parent, nil}
+}
+
+func (l *logger) Enabled(level dlog.Level) bool {
+	for current := l; current != nil; current = current.parent {
+		if current.level != nil {
+			return levelToLog15Level[dlog.StandardLevel(level)] <= levelToLog15Level[dlog.StandardLevel(*current.level)]
+		}
+	}
+	return true
 }
 
 func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
@@ -49,15 +79,16 @@ func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
 	// TODO(pedge): does not check map, even though we expect coverage
 	l.l.SetHandler(
 		log15.LvlFilterHandler(
-			levelToLog15Level[level],
+			levelToLog15Level[dlog.StandardLevel(level)],
 			log15.StdoutHandler,
 		),
 	)
+	l.level = &level
 	return l
 }
 
 func (l *logger) WithField(key string, value interface{}) dlog.Logger {
-	return newLogger(l.l.New(key, value))
+	return newLogger(l.l.New(key, log15Value(value)), l)
 }
 
 func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
@@ -65,10 +96,27 @@ func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
 	i := 0
 	for key, value := range fields {
 		fieldsSlice[i] = key
-		fieldsSlice[i+1] = value
+		fieldsSlice[i+1] = log15Value(value)
 		i += 2
 	}
-	return newLogger(l.l.New(fieldsSlice...))
+	return newLogger(l.l.New(fieldsSlice...), l)
+}
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	fieldsSlice := make([]interface{}, len(fields)*2)
+	for i, field := range fields {
+		fieldsSlice[2*i] = field.Key
+		fieldsSlice[2*i+1] = log15Value(field.Value())
+	}
+	return newLogger(l.l.New(fieldsSlice...), l)
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.l.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.l.Debug(fmt.Sprint(args...))
 }
 
 func (l *logger) Debugf(format string, args ...interface{}) {
@@ -130,3 +178,18 @@ func (l *logger) Printf(format string, args ...interface{}) {
 func (l *logger) Println(args ...interface{}) {
 	l.l.Info(fmt.Sprint(args...))
 }
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	dlog.BaseLogf(l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	dlog.BaseLogln(l, level, args...)
+}
+
+func log15Value(value interface{}) interface{} {
+	if lazy, ok := value.(dlog.Lazy); ok {
+		return log15.Lazy{Fn: func() interface{} { return lazy() }}
+	}
+	return value
+}
@@ -0,0 +1,183 @@
+/*
+Package dlog_logr provides logr functionality for dlog.
+
+NewLogSink implements a logr.LogSink on a dlog.Logger, so that packages that log with logr,
+such as the Kubernetes client-go and controller-runtime, log to dlog:
+
+	ctrl.SetLogger(logr.New(dlog_logr.NewLogSink(dlog.With())))
+
+NewLogger implements a dlog.Logger on a logr.Logger.
+
+https://github.com/go-logr/logr
+*/
+package dlog_logr // import "go.pedge.io/dlog/logr"
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"go.pedge.io/dlog"
+)
+
+const (
+	// NameKey is the field key of the name of a logr.Logger, from WithName.
+	NameKey = "logger"
+	// NoValue is the value of a key without a value.
+	NoValue = "<no-value>"
+)
+
+func init() {
+	dlog.SkipCallerPackage("github.com/go-logr/logr")
+	dlog.SkipCallerPackage("go.pedge.io/dlog/logr")
+}
+
+// NewLogSink returns a new logr.LogSink that logs to the dlog.Logger.
+//
+// V-level 0 is logged at dlog.LevelInfo, and higher V-levels are logged at dlog.LevelDebug.
+// Errors are logged at dlog.LevelError with the error as the field "error". The names
+// from WithName are joined with "/" as the field "logger".
+func NewLogSink(logger dlog.Logger) logr.LogSink {
+	return &logSink{logger, ""}
+}
+
+type logSink struct {
+	logger dlog.Logger
+	name   string
+}
+
+func (s *logSink) Init(logr.RuntimeInfo) {}
+
+func (s *logSink) Enabled(level int) bool {
+	return s.logger.Enabled(vLevelToLevel(level))
+}
+
+func (s *logSink) Info(level int, message string, keysAndValues ...interface{}) {
+	s.with(keysAndValues).Logln(vLevelToLevel(level), message)
+}
+
+func (s *logSink) Error(err error, message string, keysAndValues ...interface{}) {
+	logger := s.with(keysAndValues)
+	if err != nil {
+		logger = logger.With(dlog.Err(err))
+	}
+	logger.Errorln(message)
+}
+
+func (s *logSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &logSink{s.logger.With(keysAndValuesToFields(keysAndValues)...), s.name}
+}
+
+func (s *logSink) WithName(name string) logr.LogSink {
+	if s.name != "" {
+		name = s.name + "/" + name
+	}
+	return &logSink{s.logger, name}
+}
+
+func (s *logSink) with(keysAndValues []interface{}) dlog.Logger {
+	fields := keysAndValuesToFields(keysAndValues)
+	if s.name != "" {
+		fields = append(fields, dlog.String(NameKey, s.name))
+	}
+	if len(fields) == 0 {
+		return s.logger
+	}
+	return s.logger.With(fields...)
+}
+
+func vLevelToLevel(level int) dlog.Level {
+	if level > 0 {
+		return dlog.LevelDebug
+	}
+	return dlog.LevelInfo
+}
+
+func keysAndValuesToFields(keysAndValues []interface{}) []dlog.Field {
+	fields := make([]dlog.Field, 0, (len(keysAndValues)+1)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		var value interface{} = NoValue
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		if marshaler, ok := value.(logr.Marshaler); ok {
+			value = dlog.Lazy(marshaler.MarshalLog)
+		}
+		fields = append(fields, dlog.Any(key, value))
+	}
+	return fields
+}
+
+// NewLogger returns a new dlog.Logger that logs to the logr.Logger.
+//
+// dlog.LevelTrace is logged at V-level 2, dlog.LevelDebug at V-level 1, and dlog.LevelInfo
+// and dlog.LevelWarn at V-level 0. dlog.LevelError and above are logged with Error, with
+// the field "error" as the error. As with dlog.NewEntryLogger, Fatal exits with
+// os.Exit(1) and Panic panics after logging. Custom Levels are logged as
+// dlog.StandardLevel(level).
+//
+// The Logger is not filtered by the dlog level, a Level is enabled if the
+// logr.Logger is enabled at its V-level.
+func NewLogger(logrLogger logr.Logger) dlog.Logger {
+	return dlog.NewEntryLogger(&entryHandler{logrLogger}).AtLevel(dlog.LevelNone)
+}
+
+type entryHandler struct {
+	logrLogger logr.Logger
+}
+
+func (h *entryHandler) Enabled(level dlog.Level) bool {
+	level = dlog.StandardLevel(level)
+	return level >= dlog.LevelError || h.logrLogger.V(levelToVLevel(level)).Enabled()
+}
+
+func (h *entryHandler) Handle(entry *dlog.Entry) error {
+	level := dlog.StandardLevel(entry.Level)
+	if level >= dlog.LevelError {
+		var err error
+		switch value := entry.Fields["error"].(type) {
+		case error:
+			err = value
+		case string:
+			// errors are converted to strings in Entries
+			err = errors.New(value)
+		}
+		h.logrLogger.Error(err, entry.Message, fieldsToKeysAndValues(entry.Fields, err != nil)...)
+		return nil
+	}
+	h.logrLogger.V(levelToVLevel(level)).Info(entry.Message, fieldsToKeysAndValues(entry.Fields, false)...)
+	return nil
+}
+
+func levelToVLevel(level dlog.Level) int {
+	switch level {
+	case dlog.LevelTrace:
+		return 2
+	case dlog.LevelDebug:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// fieldsToKeysAndValues returns the fields sorted by key, without the error if skipError is set.
+func fieldsToKeysAndValues(fields map[string]interface{}, skipError bool) []interface{} {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if skipError && key == "error" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	keysAndValues := make([]interface{}, 0, len(keys)*2)
+	for _, key := range keys {
+		keysAndValues = append(keysAndValues, key, fields[key])
+	}
+	return keysAndValues
+}
@@ -14,6 +14,7 @@ import (
 var (
 	levelToLogrusLevel = map[dlog.Level]logrus.Level{
 		dlog.LevelNone:  logrus.InfoLevel,
+		dlog.LevelTrace: logrus.DebugLevel,
 		dlog.LevelDebug: logrus.DebugLevel,
 		dlog.LevelInfo:  logrus.InfoLevel,
 		dlog.LevelWarn:  logrus.WarnLevel,
@@ -23,12 +24,27 @@ var (
 	}
 )
 
+func init() {
+	dlog.RegisterBackend(
+		"logrus",
+		func() dlog.Logger {
+			return NewLogger(logrus.New())
+		},
+	)
+}
+
 // Register registers the default logrus Logger as the dlog Logger.
 func Register() {
 	dlog.SetLogger(NewLogger(logrus.StandardLogger()))
 }
 
 // NewLogger returns a new dlog.Logger that uses the logrus.Logger.
+//
+// logrus has no trace level, so dlog.LevelTrace is logged at logrus.DebugLevel.
+// Custom Levels are logged at the logrus level for dlog.StandardLevel(level).
+//
+// dlog.Lazy field values implement fmt.Stringer and json.Marshaler, so the logrus
+// formatters only evaluate them when formatting an entry that is logged.
 func NewLogger(logrusLogger *logrus.Logger) dlog.Logger {
 	return newLogger(&loggerLogrusLogger{logrusLogger})
 }
@@ -38,6 +54,7 @@ type logrusLogger interface {
 	WithField(key string, value interface{}) *logrus.Entry
 	WithFields(fields logrus.Fields) *logrus.Entry
 	SetLevel(level dlog.Level)
+	Enabled(level dlog.Level) bool
 }
 
 type loggerLogrusLogger struct {
@@ -45,7 +62,11 @@ type loggerLogrusLogger struct {
 }
 
 func (l *loggerLogrusLogger) SetLevel(level dlog.Level) {
-	l.Logger.Level = levelToLogrusLevel[level]
+	l.Logger.Level = levelToLogrusLevel[dlog.StandardLevel(level)]
+}
+
+func (l *loggerLogrusLogger) Enabled(level dlog.Level) bool {
+	return levelToLogrusLevel[dlog.StandardLevel(level)] <= l.Logger.Level
 }
 
 type entryLogrusLogger struct {
@@ -53,7 +74,11 @@ type entryLogrusLogger struct {
 }
 
 func (l *entryLogrusLogger) SetLevel(level dlog.Level) {
-	l.Entry.Level = levelToLogrusLevel[level]
+	l.Entry.Level = levelToLogrusLevel[dlog.StandardLevel(level)]
+}
+
+func (l *entryLogrusLogger) Enabled(level dlog.Level) bool {
+	return levelToLogrusLevel[dlog.StandardLevel(level)] <= l.Entry.Logger.Level
 }
 
 type logger struct {
@@ -65,6 +90,10 @@ func newLogger(l logrusLogger) *logger {
 	return &logger{l, l}
 }
 
+func (l *logger) Enabled(level dlog.Level) bool {
+	return l.l.Enabled(level)
+}
+
 func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
 	// TODO(pedge): not thread safe, tradeoff here
 	// TODO(pedge): neither implementation checks map, even though we expect coverage
@@ -79,3 +108,23 @@ func (l *logger) WithField(key string, value interface{}) dlog.Logger {
 func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
 	return newLogger(&entryLogrusLogger{l.l.WithFields(fields)})
 }
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	return l.WithFields(dlog.FieldsToMap(fields))
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.l.Debugf(format, args...)
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.l.Debugln(args...)
+}
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	dlog.BaseLogf(l.l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	dlog.BaseLogln(l.l, level, args...)
+}
@@ -0,0 +1,409 @@
+/*
+Package dlog_loki provides a Grafana Loki backend for dlog.
+
+Entries are batched and pushed to Loki's push API:
+
+	writer, err := dlog_loki.NewWriter(
+		dlog_loki.Options{
+			URL:       "http://loki:3100",
+			Labels:    map[string]string{"app": "api"},
+			LabelKeys: []string{dlog_loki.LevelKey, "component"},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = writer.Close() }()
+	dlog.SetLogger(dlog_loki.NewLogger(writer))
+
+Fields with keys in Options.LabelKeys are promoted to stream labels, and the
+other fields are encoded in the line with Options.Encoder.
+
+Entries are kept in memory until Options.BufferLimit is reached, including
+while a batch is retried, after which Entries are dropped and Handle returns
+ErrBufferFull.
+*/
+package dlog_loki // import "go.pedge.io/dlog/loki"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+)
+
+const (
+	// EncodingProtobuf pushes snappy-compressed protobuf.
+	EncodingProtobuf Encoding = iota
+	// EncodingJSON pushes JSON.
+	EncodingJSON
+)
+
+const (
+	// LevelKey is the key in Options.LabelKeys that promotes the Level of each Entry to a label.
+	LevelKey = "level"
+	// PushPath is the path of the push API.
+	PushPath = "/loki/api/v1/push"
+
+	// DefaultBatchSize is the number of Entries after which a batch is pushed if Options.BatchSize is not set.
+	DefaultBatchSize = 1024
+	// DefaultBufferLimit is the number of Entries to buffer if Options.BufferLimit is not set.
+	DefaultBufferLimit = 16 * DefaultBatchSize
+	// DefaultBatchWait is the interval at which batches are pushed if Options.BatchWait is not set.
+	DefaultBatchWait = time.Second
+	// DefaultMinBackoff is the first backoff if Options.MinBackoff is not set.
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the maximum backoff if Options.MaxBackoff is not set.
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultMaxRetries is the number of retries for a batch if Options.MaxRetries is not set.
+	DefaultMaxRetries = 10
+)
+
+var (
+	// ErrClosed is returned if the Writer is used after Close.
+	ErrClosed = errors.New("dlog_loki: writer is closed")
+	// ErrBufferFull is returned by Handle if Options.BufferLimit is reached.
+	ErrBufferFull = errors.New("dlog_loki: buffer is full")
+)
+
+// Encoding is the encoding of push requests.
+type Encoding int
+
+// Options are the options for a Writer.
+type Options struct {
+	// URL is the base URL of Loki, to which PushPath is appended.
+	URL string
+	// Encoding is the encoding of push requests, by default EncodingProtobuf.
+	Encoding Encoding
+	// Labels are added to every stream.
+	Labels map[string]string
+	// LabelKeys are the field keys that are promoted to stream labels.
+	// LevelKey promotes the Level of each Entry.
+	LabelKeys []string
+	// Encoder encodes the line of each Entry, without the promoted fields.
+	// If nil, dlog.NewLogfmtEncoder() is used.
+	Encoder dlog.Encoder
+	// TenantID is sent as the X-Scope-OrgID header if set.
+	TenantID string
+	// BatchSize is the number of Entries after which a batch is pushed.
+	// If 0, DefaultBatchSize is used.
+	BatchSize int
+	// BatchWait is the interval at which batches are pushed.
+	// If 0, DefaultBatchWait is used.
+	BatchWait time.Duration
+	// BufferLimit is the number of Entries to buffer, including the batch being pushed.
+	// If 0, DefaultBufferLimit is used.
+	BufferLimit int
+	// MinBackoff is the backoff after the first failed push, which is doubled after every failure.
+	// If 0, DefaultMinBackoff is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum backoff.
+	// If 0, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+	// MaxRetries is the number of times a batch is retried after 429 and 5xx responses
+	// and network errors before it is dropped. If 0, DefaultMaxRetries is used.
+	MaxRetries int
+	// Client is the HTTP client. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Writer is a dlog.EntryHandler that pushes Entries to Loki.
+//
+// Entries are pushed in the background. Errors while pushing in the
+// background are printed to stderr.
+type Writer struct {
+	options   Options
+	url       string
+	labelKeys map[string]bool
+	batcher   *dlog_internal.Batcher
+}
+
+type stream struct {
+	labels  map[string]string
+	entries []*entry
+}
+
+type entry struct {
+	key    string
+	labels map[string]string
+	time   time.Time
+	line   string
+}
+
+// PushError is returned if a push fails with an HTTP error status.
+type PushError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements error.
+func (e *PushError) Error() string {
+	return fmt.Sprintf("dlog_loki: push failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(options Options) (*Writer, error) {
+	if options.URL == "" {
+		return nil, errors.New("dlog_loki: no url")
+	}
+	switch options.Encoding {
+	case EncodingProtobuf, EncodingJSON:
+	default:
+		return nil, fmt.Errorf("dlog_loki: unknown encoding: %d", options.Encoding)
+	}
+	if options.Encoder == nil {
+		options.Encoder = dlog.NewLogfmtEncoder()
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.BatchWait == 0 {
+		options.BatchWait = DefaultBatchWait
+	}
+	if options.BufferLimit == 0 {
+		options.BufferLimit = DefaultBufferLimit
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = DefaultMaxRetries
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	labelKeys := make(map[string]bool, len(options.LabelKeys))
+	for _, labelKey := range options.LabelKeys {
+		labelKeys[labelKey] = true
+	}
+	w := &Writer{
+		options:   options,
+		url:       strings.TrimSuffix(options.URL, "/") + PushPath,
+		labelKeys: labelKeys,
+	}
+	w.batcher = dlog_internal.NewBatcher(
+		dlog_internal.BatcherOptions{
+			BatchSize:     options.BatchSize,
+			FlushInterval: options.BatchWait,
+			BufferLimit:   options.BufferLimit,
+			MinBackoff:    options.MinBackoff,
+			MaxBackoff:    options.MaxBackoff,
+			MaxRetries:    options.MaxRetries,
+			ErrClosed:     ErrClosed,
+			ErrBufferFull: ErrBufferFull,
+			ErrorMessage:  "dlog_loki: could not push entries",
+		},
+		w.send,
+	)
+	return w, nil
+}
+
+// NewLogger returns a new dlog.Logger that writes to the Writer.
+func NewLogger(writer *Writer) dlog.Logger {
+	return dlog.NewEntryLogger(writer)
+}
+
+// Handle adds the Entry to the batch to be pushed, and returns
+// ErrBufferFull if Options.BufferLimit is reached.
+func (w *Writer) Handle(dlogEntry *dlog.Entry) error {
+	labels := make(map[string]string, len(w.options.Labels)+len(w.labelKeys))
+	for key, value := range w.options.Labels {
+		labels[labelName(key)] = value
+	}
+	fields := make(map[string]interface{}, len(dlogEntry.Fields))
+	for key, value := range dlogEntry.Fields {
+		if w.labelKeys[key] {
+			labels[labelName(key)] = fmt.Sprint(value)
+			continue
+		}
+		fields[key] = value
+	}
+	if w.labelKeys[LevelKey] && dlogEntry.Level != dlog.LevelNone {
+		labels[LevelKey] = strings.ToLower(dlogEntry.Level.String())
+	}
+	line, err := w.options.Encoder.Encode(
+		&dlog.Entry{
+			Time:    dlogEntry.Time,
+			Level:   dlogEntry.Level,
+			Message: dlogEntry.Message,
+			Fields:  fields,
+			File:    dlogEntry.File,
+			Line:    dlogEntry.Line,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return w.batcher.Add(&entry{labelsString(labels), labels, dlogEntry.Time, string(line)})
+}
+
+// Flush pushes the batch, retrying with backoff after 429 and 5xx
+// responses and network errors, and returns the last error if the
+// batch was dropped.
+func (w *Writer) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close pushes the batch and stops pushing in the background.
+func (w *Writer) Close() error {
+	return w.batcher.Close()
+}
+
+func (w *Writer) send(items []interface{}) error {
+	batch := make(map[string]*stream)
+	for _, item := range items {
+		entry := item.(*entry)
+		s, ok := batch[entry.key]
+		if !ok {
+			s = &stream{labels: entry.labels}
+			batch[entry.key] = s
+		}
+		s.entries = append(s.entries, entry)
+	}
+	body, contentType, err := w.encode(batch)
+	if err != nil {
+		return err
+	}
+	w.batcher.Retry(
+		func() bool {
+			err = w.push(body, contentType)
+			return err != nil && retryable(err)
+		},
+	)
+	return err
+}
+
+func (w *Writer) push(body []byte, contentType string) error {
+	request, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	if w.options.TenantID != "" {
+		request.Header.Set("X-Scope-OrgID", w.options.TenantID)
+	}
+	response, err := w.options.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode/100 == 2 {
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return &PushError{response.StatusCode, strings.TrimSpace(string(data))}
+}
+
+func (w *Writer) encode(batch map[string]*stream) ([]byte, string, error) {
+	keys := make([]string, 0, len(batch))
+	for key := range batch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if w.options.Encoding == EncodingJSON {
+		data, err := encodeJSON(keys, batch)
+		return data, "application/json", err
+	}
+	return snappy.Encode(nil, encodeProtobuf(keys, batch)), "application/x-protobuf", nil
+}
+
+// {"streams": [{"stream": {"label": "value"}, "values": [["unix nanoseconds", "line"]]}]}
+func encodeJSON(keys []string, batch map[string]*stream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := make([]*jsonStream, 0, len(keys))
+	for _, key := range keys {
+		s := batch[key]
+		values := make([][2]string, 0, len(s.entries))
+		for _, entry := range s.entries {
+			values = append(values, [2]string{strconv.FormatInt(entry.time.UnixNano(), 10), entry.line})
+		}
+		streams = append(streams, &jsonStream{s.labels, values})
+	}
+	return json.Marshal(map[string]interface{}{"streams": streams})
+}
+
+// encodeProtobuf encodes a logproto.PushRequest, which has repeated streams
+// with the field number 1, which have labels (1) and repeated entries (2),
+// which have a google.protobuf.Timestamp timestamp (1) and a line (2).
+func encodeProtobuf(keys []string, batch map[string]*stream) []byte {
+	var request []byte
+	var streamBuffer []byte
+	var entryBuffer []byte
+	var timestampBuffer []byte
+	for _, key := range keys {
+		streamBuffer = dlog_internal.AppendProtobufBytes(streamBuffer[:0], 1, []byte(key))
+		for _, entry := range batch[key].entries {
+			timestampBuffer = timestampBuffer[:0]
+			if seconds := entry.time.Unix(); seconds != 0 {
+				timestampBuffer = dlog_internal.AppendProtobufVarint(timestampBuffer, 1, uint64(seconds))
+			}
+			if nanos := entry.time.Nanosecond(); nanos != 0 {
+				timestampBuffer = dlog_internal.AppendProtobufVarint(timestampBuffer, 2, uint64(nanos))
+			}
+			entryBuffer = dlog_internal.AppendProtobufBytes(entryBuffer[:0], 1, timestampBuffer)
+			entryBuffer = dlog_internal.AppendProtobufBytes(entryBuffer, 2, []byte(entry.line))
+			streamBuffer = dlog_internal.AppendProtobufBytes(streamBuffer, 2, entryBuffer)
+		}
+		request = dlog_internal.AppendProtobufBytes(request, 1, streamBuffer)
+	}
+	return request
+}
+
+// retryable returns true for network errors and 429 and 5xx responses.
+func retryable(err error) bool {
+	pushError, ok := err.(*PushError)
+	return !ok || pushError.StatusCode == http.StatusTooManyRequests || pushError.StatusCode/100 == 5
+}
+
+// labelsString returns the labels as {key="value", ...}, sorted by key.
+func labelsString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buffer := bytes.NewBufferString("{")
+	for i, key := range keys {
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(key)
+		buffer.WriteByte('=')
+		buffer.WriteString(strconv.Quote(labels[key]))
+	}
+	buffer.WriteByte('}')
+	return buffer.String()
+}
+
+// labelName returns the key with the characters not allowed in
+// Prometheus label names replaced with underscores.
+func labelName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
@@ -0,0 +1,121 @@
+package dlog_otel
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.pedge.io/dlog"
+)
+
+const (
+	// SpanEventName is the name of the span events recorded for log calls.
+	SpanEventName = "log"
+	// SpanEventSeverityKey is the attribute key of the Level of a span event.
+	SpanEventSeverityKey = "log.severity"
+	// SpanEventMessageKey is the attribute key of the message of a span event.
+	SpanEventMessageKey = "log.message"
+)
+
+// ContextHookOptions are the options for a ContextHook.
+type ContextHookOptions struct {
+	// SpanEvents records each log call as an event on the span in the context,
+	// if the span is recording.
+	SpanEvents bool
+}
+
+// NewContextHook returns a new dlog.ContextHook that adds the TraceIDKey, SpanIDKey,
+// and TraceFlagsKey fields of the span in the context.
+func NewContextHook(options ContextHookOptions) dlog.ContextHook {
+	return &contextHook{options}
+}
+
+type contextHook struct {
+	options ContextHookOptions
+}
+
+func (h *contextHook) Fields(ctx context.Context) []dlog.Field {
+	return spanFields(ctx)
+}
+
+func (h *contextHook) Log(ctx context.Context, level dlog.Level, message string, fields []dlog.Field) {
+	if !h.options.SpanEvents {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	attributes := make([]attribute.KeyValue, 0, len(fields)+2)
+	if level != dlog.LevelNone {
+		attributes = append(attributes, attribute.String(SpanEventSeverityKey, strings.ToLower(level.String())))
+	}
+	attributes = append(attributes, attribute.String(SpanEventMessageKey, strings.TrimSpace(message)))
+	for _, field := range fields {
+		switch field.Key {
+		case TraceIDKey, SpanIDKey, TraceFlagsKey:
+			// the span event is already in the trace
+			continue
+		}
+		attributes = append(attributes, newAttribute(field))
+	}
+	span.AddEvent(SpanEventName, trace.WithAttributes(attributes...))
+}
+
+// spanFields returns the TraceIDKey, SpanIDKey, and TraceFlagsKey fields of the
+// span in the context, or nil if there is no valid span.
+func spanFields(ctx context.Context) []dlog.Field {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return []dlog.Field{
+		dlog.String(TraceIDKey, spanContext.TraceID().String()),
+		dlog.String(SpanIDKey, spanContext.SpanID().String()),
+		dlog.String(TraceFlagsKey, spanContext.TraceFlags().String()),
+	}
+}
+
+func newAttribute(field dlog.Field) attribute.KeyValue {
+	switch field.Type {
+	case dlog.FieldTypeString:
+		return attribute.String(field.Key, field.String)
+	case dlog.FieldTypeInt:
+		return attribute.Int64(field.Key, field.Integer)
+	case dlog.FieldTypeDuration:
+		return attribute.String(field.Key, time.Duration(field.Integer).String())
+	case dlog.FieldTypeError:
+		if err, ok := field.Interface.(error); ok && err != nil {
+			return attribute.String(field.Key, err.Error())
+		}
+		return attribute.String(field.Key, "<nil>")
+	}
+	value := field.Interface
+	if lazy, ok := value.(dlog.Lazy); ok {
+		value = lazy()
+	}
+	switch value := value.(type) {
+	case string:
+		return attribute.String(field.Key, value)
+	case bool:
+		return attribute.Bool(field.Key, value)
+	case error:
+		return attribute.String(field.Key, value.Error())
+	case fmt.Stringer:
+		return attribute.String(field.Key, value.String())
+	}
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return attribute.Int64(field.Key, reflectValue.Int())
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return attribute.Int64(field.Key, int64(reflectValue.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return attribute.Float64(field.Key, reflectValue.Float())
+	}
+	return attribute.String(field.Key, fmt.Sprint(value))
+}
@@ -0,0 +1,638 @@
+/*
+Package dlog_otel provides an OpenTelemetry logs backend for dlog.
+
+Entries are mapped to OpenTelemetry LogRecords, batched, and exported with OTLP/HTTP:
+
+	writer, err := dlog_otel.NewWriter(
+		dlog_otel.Options{
+			URL:         "http://otel-collector:4318",
+			ServiceName: "api",
+		},
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = writer.Close() }()
+	dlog.SetLogger(dlog_otel.NewLogger(writer))
+
+The SeverityNumber of a LogRecord is derived from the Level with SeverityNumber,
+the body is the message, and the fields are attributes. The fields with the keys
+TraceIDKey, SpanIDKey, and TraceFlagsKey set the trace context of the LogRecord
+instead, and are added from the span in a context with WithContext:
+
+	dlog_otel.WithContext(ctx, logger).Infoln("handled request")
+
+To add the fields for the Loggers created with dlog.WithContext, whatever the backend,
+and optionally record each log call as an event on the span, register a ContextHook:
+
+	dlog.RegisterContextHook(dlog_otel.NewContextHook(dlog_otel.ContextHookOptions{SpanEvents: true}))
+	dlog.WithContext(ctx).Infoln("handled request")
+
+Entries are kept in memory until Options.BufferLimit is reached, including
+while a batch is retried, after which Entries are dropped and Handle returns
+ErrBufferFull.
+*/
+package dlog_otel // import "go.pedge.io/dlog/otel"
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+)
+
+const (
+	// EncodingProtobuf exports protobuf.
+	EncodingProtobuf Encoding = iota
+	// EncodingJSON exports JSON.
+	EncodingJSON
+)
+
+const (
+	// TraceIDKey is the field key of the hex-encoded trace ID.
+	TraceIDKey = "trace_id"
+	// SpanIDKey is the field key of the hex-encoded span ID.
+	SpanIDKey = "span_id"
+	// TraceFlagsKey is the field key of the hex-encoded trace flags.
+	TraceFlagsKey = "trace_flags"
+	// LogsPath is the path of the OTLP/HTTP logs endpoint.
+	LogsPath = "/v1/logs"
+	// ScopeName is the name of the instrumentation scope of every LogRecord.
+	ScopeName = "go.pedge.io/dlog"
+
+	// DefaultBatchSize is the number of Entries after which a batch is exported if Options.BatchSize is not set.
+	DefaultBatchSize = 512
+	// DefaultBufferLimit is the number of Entries to buffer if Options.BufferLimit is not set.
+	DefaultBufferLimit = 16 * DefaultBatchSize
+	// DefaultFlushInterval is the interval at which batches are exported if Options.FlushInterval is not set.
+	DefaultFlushInterval = time.Second
+	// DefaultMinBackoff is the first backoff if Options.MinBackoff is not set.
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the maximum backoff if Options.MaxBackoff is not set.
+	DefaultMaxBackoff = time.Minute
+	// DefaultMaxRetries is the number of retries for a batch if Options.MaxRetries is not set.
+	DefaultMaxRetries = 10
+)
+
+var (
+	// ErrClosed is returned if the Writer is used after Close.
+	ErrClosed = errors.New("dlog_otel: writer is closed")
+	// ErrBufferFull is returned by Handle if Options.BufferLimit is reached.
+	ErrBufferFull = errors.New("dlog_otel: buffer is full")
+
+	levelToSeverityNumber = map[dlog.Level]int{
+		dlog.LevelNone:  0,
+		dlog.LevelTrace: 1,
+		dlog.LevelDebug: 5,
+		dlog.LevelInfo:  9,
+		dlog.LevelWarn:  13,
+		dlog.LevelError: 17,
+		dlog.LevelFatal: 21,
+		dlog.LevelPanic: 24,
+	}
+)
+
+// Encoding is the encoding of export requests.
+type Encoding int
+
+// Options are the options for a Writer.
+type Options struct {
+	// URL is the base URL of the OTLP/HTTP receiver, to which LogsPath is appended.
+	URL string
+	// Encoding is the encoding of export requests, by default EncodingProtobuf.
+	Encoding Encoding
+	// ServiceName is the service.name resource attribute if set.
+	ServiceName string
+	// ResourceAttributes are the other resource attributes.
+	ResourceAttributes map[string]interface{}
+	// Headers are added to every request, for example for authentication.
+	Headers map[string]string
+	// BatchSize is the number of Entries after which a batch is exported.
+	// If 0, DefaultBatchSize is used.
+	BatchSize int
+	// FlushInterval is the interval at which batches are exported.
+	// If 0, DefaultFlushInterval is used.
+	FlushInterval time.Duration
+	// BufferLimit is the number of Entries to buffer, including the batch being exported.
+	// If 0, DefaultBufferLimit is used.
+	BufferLimit int
+	// MinBackoff is the backoff after the first failed export, which is doubled after every failure.
+	// If 0, DefaultMinBackoff is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum backoff.
+	// If 0, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+	// MaxRetries is the number of times a batch is retried after retryable responses
+	// and network errors before it is dropped. If 0, DefaultMaxRetries is used.
+	MaxRetries int
+	// Client is the HTTP client. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Writer is a dlog.EntryHandler that exports Entries with OTLP/HTTP.
+//
+// Entries are exported in the background. Errors while exporting in the
+// background are printed to stderr.
+type Writer struct {
+	options  Options
+	url      string
+	resource []*keyValue
+	batcher  *dlog_internal.Batcher
+}
+
+// ExportError is returned if an export fails with an HTTP error status.
+type ExportError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements error.
+func (e *ExportError) Error() string {
+	return fmt.Sprintf("dlog_otel: export failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(options Options) (*Writer, error) {
+	if options.URL == "" {
+		return nil, errors.New("dlog_otel: no url")
+	}
+	switch options.Encoding {
+	case EncodingProtobuf, EncodingJSON:
+	default:
+		return nil, fmt.Errorf("dlog_otel: unknown encoding: %d", options.Encoding)
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.FlushInterval == 0 {
+		options.FlushInterval = DefaultFlushInterval
+	}
+	if options.BufferLimit == 0 {
+		options.BufferLimit = DefaultBufferLimit
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = DefaultMaxRetries
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	resourceAttributes := make(map[string]interface{}, len(options.ResourceAttributes)+1)
+	for key, value := range options.ResourceAttributes {
+		resourceAttributes[key] = value
+	}
+	if options.ServiceName != "" {
+		resourceAttributes["service.name"] = options.ServiceName
+	}
+	w := &Writer{
+		options:  options,
+		url:      strings.TrimSuffix(options.URL, "/") + LogsPath,
+		resource: newKeyValues(resourceAttributes),
+	}
+	w.batcher = dlog_internal.NewBatcher(
+		dlog_internal.BatcherOptions{
+			BatchSize:     options.BatchSize,
+			FlushInterval: options.FlushInterval,
+			BufferLimit:   options.BufferLimit,
+			MinBackoff:    options.MinBackoff,
+			MaxBackoff:    options.MaxBackoff,
+			MaxRetries:    options.MaxRetries,
+			ErrClosed:     ErrClosed,
+			ErrBufferFull: ErrBufferFull,
+			ErrorMessage:  "dlog_otel: could not export entries",
+		},
+		w.send,
+	)
+	return w, nil
+}
+
+// NewLogger returns a new dlog.Logger that writes to the Writer.
+func NewLogger(writer *Writer) dlog.Logger {
+	return dlog.NewEntryLogger(writer)
+}
+
+// WithContext returns the Logger with the TraceIDKey, SpanIDKey, and TraceFlagsKey
+// fields of the span in the context, or the Logger if there is no valid span.
+//
+// To add the fields for every backend with dlog.WithContext, register a ContextHook.
+func WithContext(ctx context.Context, logger dlog.Logger) dlog.Logger {
+	fields := spanFields(ctx)
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
+}
+
+// SeverityNumber returns the OpenTelemetry SeverityNumber for the Level.
+//
+// Custom Levels between the built-in Levels map to the SeverityNumbers
+// between the SeverityNumbers of the built-in Levels.
+func SeverityNumber(level dlog.Level) int {
+	standardLevel := dlog.StandardLevel(level)
+	severityNumber := levelToSeverityNumber[standardLevel]
+	if offset := int(level-standardLevel) * 4 / 10; offset > 0 {
+		severityNumber += offset
+		if severityNumber > 24 {
+			severityNumber = 24
+		}
+	}
+	return severityNumber
+}
+
+// Handle adds the Entry to the batch to be exported, and returns
+// ErrBufferFull if Options.BufferLimit is reached.
+func (w *Writer) Handle(entry *dlog.Entry) error {
+	return w.batcher.Add(newLogRecord(entry))
+}
+
+// Flush exports the batch, retrying with backoff after 429, 502, 503, and 504
+// responses and network errors, and returns the last error if the batch was dropped.
+func (w *Writer) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close exports the batch and stops exporting in the background.
+func (w *Writer) Close() error {
+	return w.batcher.Close()
+}
+
+func (w *Writer) send(items []interface{}) error {
+	batch := make([]*logRecord, len(items))
+	for i, item := range items {
+		batch[i] = item.(*logRecord)
+	}
+	body, contentType, err := w.encode(batch)
+	if err != nil {
+		return err
+	}
+	w.batcher.Retry(
+		func() bool {
+			err = w.export(body, contentType)
+			return err != nil && retryable(err)
+		},
+	)
+	return err
+}
+
+func (w *Writer) export(body []byte, contentType string) error {
+	request, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, value := range w.options.Headers {
+		request.Header.Set(key, value)
+	}
+	request.Header.Set("Content-Type", contentType)
+	response, err := w.options.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode/100 == 2 {
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return &ExportError{response.StatusCode, strings.TrimSpace(string(data))}
+}
+
+func (w *Writer) encode(batch []*logRecord) ([]byte, string, error) {
+	if w.options.Encoding == EncodingJSON {
+		data, err := encodeJSON(w.resource, batch)
+		return data, "application/json", err
+	}
+	return encodeProtobuf(w.resource, batch), "application/x-protobuf", nil
+}
+
+// retryable returns true for network errors and 429, 502, 503, and 504 responses.
+func retryable(err error) bool {
+	exportError, ok := err.(*ExportError)
+	if !ok {
+		return true
+	}
+	switch exportError.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+type logRecord struct {
+	time           time.Time
+	observedTime   time.Time
+	severityNumber int
+	severityText   string
+	body           string
+	attributes     []*keyValue
+	traceID        []byte
+	spanID         []byte
+	flags          uint32
+}
+
+type keyValue struct {
+	key   string
+	value *anyValue
+}
+
+// anyValue is an AnyValue, with one of the fields set.
+type anyValue struct {
+	stringValue *string
+	boolValue   *bool
+	intValue    *int64
+	doubleValue *float64
+	bytesValue  []byte
+	arrayValue  []*anyValue
+	kvlistValue []*keyValue
+}
+
+func newLogRecord(entry *dlog.Entry) *logRecord {
+	record := &logRecord{
+		time:           entry.Time,
+		observedTime:   time.Now(),
+		severityNumber: SeverityNumber(entry.Level),
+		body:           entry.Message,
+	}
+	if entry.Level != dlog.LevelNone {
+		record.severityText = entry.Level.String()
+	}
+	attributes := make(map[string]interface{}, len(entry.Fields)+2)
+	for key, value := range entry.Fields {
+		switch key {
+		case TraceIDKey:
+			if record.traceID = decodeHex(value, 16); record.traceID != nil {
+				continue
+			}
+		case SpanIDKey:
+			if record.spanID = decodeHex(value, 8); record.spanID != nil {
+				continue
+			}
+		case TraceFlagsKey:
+			if flags := decodeHex(value, 1); flags != nil {
+				record.flags = uint32(flags[0])
+				continue
+			}
+		}
+		attributes[key] = value
+	}
+	if entry.File != "" {
+		attributes["code.filepath"] = entry.File
+		attributes["code.lineno"] = entry.Line
+	}
+	record.attributes = newKeyValues(attributes)
+	return record
+}
+
+// decodeHex returns the bytes of a hex string of the length, or nil.
+func decodeHex(value interface{}, length int) []byte {
+	s, ok := value.(string)
+	if !ok || len(s) != 2*length {
+		return nil
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func newKeyValues(attributes map[string]interface{}) []*keyValue {
+	keyValues := make([]*keyValue, 0, len(attributes))
+	for _, key := range dlog_internal.SortedKeys(attributes) {
+		keyValues = append(keyValues, &keyValue{key, newAnyValue(attributes[key])})
+	}
+	return keyValues
+}
+
+func newAnyValue(value interface{}) *anyValue {
+	switch value := value.(type) {
+	case nil:
+		return &anyValue{}
+	case string:
+		return &anyValue{stringValue: &value}
+	case []byte:
+		return &anyValue{bytesValue: value}
+	case error:
+		s := value.Error()
+		return &anyValue{stringValue: &s}
+	case time.Time:
+		s := value.Format(time.RFC3339Nano)
+		return &anyValue{stringValue: &s}
+	case fmt.Stringer:
+		s := value.String()
+		return &anyValue{stringValue: &s}
+	}
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Bool:
+		b := reflectValue.Bool()
+		return &anyValue{boolValue: &b}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := reflectValue.Int()
+		return &anyValue{intValue: &i}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := reflectValue.Uint(); u <= math.MaxInt64 {
+			i := int64(u)
+			return &anyValue{intValue: &i}
+		}
+	case reflect.Float32, reflect.Float64:
+		f := reflectValue.Float()
+		return &anyValue{doubleValue: &f}
+	case reflect.Slice, reflect.Array:
+		values := make([]*anyValue, reflectValue.Len())
+		for i := range values {
+			values[i] = newAnyValue(reflectValue.Index(i).Interface())
+		}
+		return &anyValue{arrayValue: values}
+	case reflect.Map:
+		if reflectValue.Type().Key().Kind() == reflect.String {
+			attributes := make(map[string]interface{}, reflectValue.Len())
+			for _, key := range reflectValue.MapKeys() {
+				attributes[key.String()] = reflectValue.MapIndex(key).Interface()
+			}
+			return &anyValue{kvlistValue: newKeyValues(attributes)}
+		}
+	}
+	s := fmt.Sprint(value)
+	return &anyValue{stringValue: &s}
+}
+
+// encodeProtobuf encodes an ExportLogsServiceRequest with a single ResourceLogs
+// with a single ScopeLogs.
+func encodeProtobuf(resource []*keyValue, batch []*logRecord) []byte {
+	var resourceBuffer []byte
+	for _, kv := range resource {
+		resourceBuffer = dlog_internal.AppendProtobufBytes(resourceBuffer, 1, encodeProtobufKeyValue(kv))
+	}
+	scopeLogs := dlog_internal.AppendProtobufBytes(nil, 1, dlog_internal.AppendProtobufBytes(nil, 1, []byte(ScopeName)))
+	for _, record := range batch {
+		scopeLogs = dlog_internal.AppendProtobufBytes(scopeLogs, 2, encodeProtobufLogRecord(record))
+	}
+	resourceLogs := dlog_internal.AppendProtobufBytes(nil, 1, resourceBuffer)
+	resourceLogs = dlog_internal.AppendProtobufBytes(resourceLogs, 2, scopeLogs)
+	return dlog_internal.AppendProtobufBytes(nil, 1, resourceLogs)
+}
+
+func encodeProtobufLogRecord(record *logRecord) []byte {
+	var buffer []byte
+	buffer = dlog_internal.AppendProtobufFixed64(buffer, 1, uint64(record.time.UnixNano()))
+	if record.severityNumber != 0 {
+		buffer = dlog_internal.AppendProtobufVarint(buffer, 2, uint64(record.severityNumber))
+	}
+	if record.severityText != "" {
+		buffer = dlog_internal.AppendProtobufBytes(buffer, 3, []byte(record.severityText))
+	}
+	buffer = dlog_internal.AppendProtobufBytes(buffer, 5, encodeProtobufAnyValue(&anyValue{stringValue: &record.body}))
+	for _, kv := range record.attributes {
+		buffer = dlog_internal.AppendProtobufBytes(buffer, 6, encodeProtobufKeyValue(kv))
+	}
+	if record.flags != 0 {
+		buffer = dlog_internal.AppendProtobufFixed32(buffer, 8, record.flags)
+	}
+	if record.traceID != nil {
+		buffer = dlog_internal.AppendProtobufBytes(buffer, 9, record.traceID)
+	}
+	if record.spanID != nil {
+		buffer = dlog_internal.AppendProtobufBytes(buffer, 10, record.spanID)
+	}
+	return dlog_internal.AppendProtobufFixed64(buffer, 11, uint64(record.observedTime.UnixNano()))
+}
+
+func encodeProtobufKeyValue(kv *keyValue) []byte {
+	buffer := dlog_internal.AppendProtobufBytes(nil, 1, []byte(kv.key))
+	return dlog_internal.AppendProtobufBytes(buffer, 2, encodeProtobufAnyValue(kv.value))
+}
+
+func encodeProtobufAnyValue(value *anyValue) []byte {
+	switch {
+	case value.stringValue != nil:
+		return dlog_internal.AppendProtobufBytes(nil, 1, []byte(*value.stringValue))
+	case value.boolValue != nil:
+		var b uint64
+		if *value.boolValue {
+			b = 1
+		}
+		return dlog_internal.AppendProtobufVarint(nil, 2, b)
+	case value.intValue != nil:
+		return dlog_internal.AppendProtobufVarint(nil, 3, uint64(*value.intValue))
+	case value.doubleValue != nil:
+		return dlog_internal.AppendProtobufFixed64(nil, 4, math.Float64bits(*value.doubleValue))
+	case value.arrayValue != nil:
+		var array []byte
+		for _, element := range value.arrayValue {
+			array = dlog_internal.AppendProtobufBytes(array, 1, encodeProtobufAnyValue(element))
+		}
+		return dlog_internal.AppendProtobufBytes(nil, 5, array)
+	case value.kvlistValue != nil:
+		var kvlist []byte
+		for _, kv := range value.kvlistValue {
+			kvlist = dlog_internal.AppendProtobufBytes(kvlist, 1, encodeProtobufKeyValue(kv))
+		}
+		return dlog_internal.AppendProtobufBytes(nil, 6, kvlist)
+	case value.bytesValue != nil:
+		return dlog_internal.AppendProtobufBytes(nil, 7, value.bytesValue)
+	default:
+		return nil
+	}
+}
+
+// encodeJSON encodes an ExportLogsServiceRequest with the OTLP JSON mapping,
+// in which 64-bit integers are strings and IDs are hex strings.
+func encodeJSON(resource []*keyValue, batch []*logRecord) ([]byte, error) {
+	logRecords := make([]map[string]interface{}, 0, len(batch))
+	for _, record := range batch {
+		logRecord := map[string]interface{}{
+			"timeUnixNano":         strconv.FormatInt(record.time.UnixNano(), 10),
+			"observedTimeUnixNano": strconv.FormatInt(record.observedTime.UnixNano(), 10),
+			"body":                 jsonAnyValue(&anyValue{stringValue: &record.body}),
+			"attributes":           jsonKeyValues(record.attributes),
+		}
+		if record.severityNumber != 0 {
+			logRecord["severityNumber"] = record.severityNumber
+		}
+		if record.severityText != "" {
+			logRecord["severityText"] = record.severityText
+		}
+		if record.flags != 0 {
+			logRecord["flags"] = record.flags
+		}
+		if record.traceID != nil {
+			logRecord["traceId"] = hex.EncodeToString(record.traceID)
+		}
+		if record.spanID != nil {
+			logRecord["spanId"] = hex.EncodeToString(record.spanID)
+		}
+		logRecords = append(logRecords, logRecord)
+	}
+	return json.Marshal(
+		map[string]interface{}{
+			"resourceLogs": []interface{}{
+				map[string]interface{}{
+					"resource": map[string]interface{}{"attributes": jsonKeyValues(resource)},
+					"scopeLogs": []interface{}{
+						map[string]interface{}{
+							"scope":      map[string]string{"name": ScopeName},
+							"logRecords": logRecords,
+						},
+					},
+				},
+			},
+		},
+	)
+}
+
+func jsonKeyValues(keyValues []*keyValue) []interface{} {
+	values := make([]interface{}, 0, len(keyValues))
+	for _, kv := range keyValues {
+		values = append(values, map[string]interface{}{"key": kv.key, "value": jsonAnyValue(kv.value)})
+	}
+	return values
+}
+
+func jsonAnyValue(value *anyValue) map[string]interface{} {
+	switch {
+	case value.stringValue != nil:
+		return map[string]interface{}{"stringValue": *value.stringValue}
+	case value.boolValue != nil:
+		return map[string]interface{}{"boolValue": *value.boolValue}
+	case value.intValue != nil:
+		return map[string]interface{}{"intValue": strconv.FormatInt(*value.intValue, 10)}
+	case value.doubleValue != nil:
+		// NaN and infinities are not valid JSON numbers
+		if math.IsNaN(*value.doubleValue) || math.IsInf(*value.doubleValue, 0) {
+			return map[string]interface{}{"stringValue": strconv.FormatFloat(*value.doubleValue, 'g', -1, 64)}
+		}
+		return map[string]interface{}{"doubleValue": *value.doubleValue}
+	case value.arrayValue != nil:
+		values := make([]interface{}, 0, len(value.arrayValue))
+		for _, element := range value.arrayValue {
+			values = append(values, jsonAnyValue(element))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case value.kvlistValue != nil:
+		return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": jsonKeyValues(value.kvlistValue)}}
+	case value.bytesValue != nil:
+		// bytes are base64, as with encoding/json
+		return map[string]interface{}{"bytesValue": value.bytesValue}
+	default:
+		return map[string]interface{}{}
+	}
+}
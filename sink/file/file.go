@@ -0,0 +1,432 @@
+/*
+Package dlog_file provides a file writer with size- and time-based rotation.
+
+The Writer is an io.WriteCloser, so it can be used with dlog.NewStdLogger
+or dlog.NewEncoderLogger:
+
+	writer, err := dlog_file.NewWriter(
+		"/var/log/app/app.log",
+		dlog_file.Options{
+			MaxSize:        100 << 20,
+			Interval:       dlog_file.IntervalDaily,
+			MaxBackups:     7,
+			Compress:       true,
+			ReopenOnSIGHUP: true,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	dlog.SetLogger(dlog.NewEncoderLogger(writer, dlog.NewJSONEncoder()))
+
+Rotated files are renamed to the path with the rotation time appended,
+for example app.log.2006-01-02T15-04-05.000000000, and have ".gz" appended
+if compressed.
+*/
+package dlog_file // import "go.pedge.io/dlog/sink/file"
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// IntervalNone does not rotate on time boundaries.
+	IntervalNone Interval = iota
+	// IntervalHourly rotates at the start of every hour.
+	IntervalHourly
+	// IntervalDaily rotates at midnight.
+	IntervalDaily
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000000000"
+	compressSuffix   = ".gz"
+)
+
+// Interval is a time boundary to rotate on.
+type Interval int
+
+// Options are the options for a Writer.
+type Options struct {
+	// MaxSize is the size in bytes after which the file is rotated.
+	// If 0, the file is not rotated by size.
+	MaxSize int64
+	// Interval is the time boundary to rotate on, in the local time zone.
+	Interval Interval
+	// MaxBackups is the number of rotated files to keep.
+	// If 0, all rotated files are kept.
+	MaxBackups int
+	// Compress gzips rotated files.
+	Compress bool
+	// ReopenOnSIGHUP reopens the file when the process receives SIGHUP,
+	// so that the Writer can be used with an external rotator such as logrotate.
+	ReopenOnSIGHUP bool
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// Writer is an io.WriteCloser that writes to a file and rotates it.
+//
+// Rotated files are compressed and pruned in the background. Errors
+// while compressing or pruning in the background are ignored, and
+// Close waits for this to finish and returns any error.
+type Writer struct {
+	path    string
+	options Options
+
+	lock         sync.Mutex
+	file         *os.File
+	size         int64
+	nextRotation time.Time
+	closed       bool
+
+	cleanupC chan struct{}
+	signalC  chan os.Signal
+	doneC    chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewWriter opens the file at path for appending, creating the file and
+// its directory if necessary, and returns a new Writer for it.
+func NewWriter(path string, options Options) (*Writer, error) {
+	if options.MaxSize < 0 {
+		return nil, fmt.Errorf("dlog_file: MaxSize must not be negative: %d", options.MaxSize)
+	}
+	if options.MaxBackups < 0 {
+		return nil, fmt.Errorf("dlog_file: MaxBackups must not be negative: %d", options.MaxBackups)
+	}
+	switch options.Interval {
+	case IntervalNone, IntervalHourly, IntervalDaily:
+	default:
+		return nil, fmt.Errorf("dlog_file: unknown Interval: %d", options.Interval)
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	w := &Writer{
+		path:     path,
+		options:  options,
+		cleanupC: make(chan struct{}, 1),
+		doneC:    make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	if options.ReopenOnSIGHUP {
+		w.signalC = make(chan os.Signal, 1)
+		signal.Notify(w.signalC, syscall.SIGHUP)
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Write writes p to the file, rotating the file first if p would
+// exceed Options.MaxSize or an Options.Interval boundary has passed.
+//
+// If the file cannot be rotated, p is still written to the current file and
+// the rotation error is returned. Rotation by Options.MaxSize is retried on
+// the next Write, and rotation by Options.Interval at the next boundary.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if w.shouldRotate(int64(len(p))) {
+		if rotateErr = w.rotate(); rotateErr != nil && !w.nextRotation.IsZero() {
+			w.nextRotation = nextRotation(w.options.Now(), w.options.Interval)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Rotate rotates the file regardless of Options.MaxSize and Options.Interval.
+func (w *Writer) Rotate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen reopens the file at the path and closes the previous file, for use
+// after the file was moved by an external rotator. If the file cannot be
+// reopened, the Writer keeps writing to the previous file.
+func (w *Writer) Reopen() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.open()
+}
+
+// Close closes the file and waits for rotated files to be compressed and pruned.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return os.ErrClosed
+	}
+	w.closed = true
+	err := w.file.Close()
+	w.lock.Unlock()
+	if w.signalC != nil {
+		signal.Stop(w.signalC)
+	}
+	close(w.doneC)
+	w.wg.Wait()
+	if cleanupErr := w.cleanup(); err == nil {
+		err = cleanupErr
+	}
+	return err
+}
+
+func (w *Writer) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.cleanupC:
+			_ = w.cleanup()
+		case <-w.signalC:
+			_ = w.Reopen()
+		case <-w.doneC:
+			return
+		}
+	}
+}
+
+func (w *Writer) shouldRotate(size int64) bool {
+	if w.options.MaxSize > 0 && w.size > 0 && w.size+size > w.options.MaxSize {
+		return true
+	}
+	return !w.nextRotation.IsZero() && !w.options.Now().Before(w.nextRotation)
+}
+
+// rotate must be called with the lock held.
+//
+// If the file cannot be rotated, the current file stays open at the path.
+func (w *Writer) rotate() error {
+	backupPath, err := w.backupPath(w.options.Now())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(w.path, backupPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		// put the current file back so that the next rotation starts from the path
+		_ = os.Rename(backupPath, w.path)
+		return err
+	}
+	select {
+	case w.cleanupC <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// open opens the file at the path and then closes the previous file, if any.
+//
+// open must be called with the lock held or before the Writer is returned.
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	previousFile := w.file
+	w.file = file
+	w.size = fileInfo.Size()
+	start := w.options.Now()
+	if w.size > 0 {
+		// an existing file is rotated at the boundary after it was last written to
+		start = fileInfo.ModTime()
+	}
+	w.nextRotation = nextRotation(start, w.options.Interval)
+	if previousFile != nil {
+		return previousFile.Close()
+	}
+	return nil
+}
+
+// backupPath returns the path of a backup rotated at the time, with an index
+// greater than those of the backups with the same time, so that the backups
+// sort in the order they were rotated even after older ones were pruned.
+func (w *Writer) backupPath(t time.Time) (string, error) {
+	backups, err := w.backups()
+	if err != nil {
+		return "", err
+	}
+	index := -1
+	for _, backup := range backups {
+		if backup.time.Equal(t) && backup.index > index {
+			index = backup.index
+		}
+	}
+	if index < 0 {
+		return w.path + "." + t.Format(backupTimeFormat), nil
+	}
+	return fmt.Sprintf("%s.%s-%d", w.path, t.Format(backupTimeFormat), index+1), nil
+}
+
+// cleanup compresses and prunes the rotated files.
+func (w *Writer) cleanup() error {
+	backups, err := w.backupPaths()
+	if err != nil {
+		return err
+	}
+	if w.options.MaxBackups > 0 && len(backups) > w.options.MaxBackups {
+		for _, backup := range backups[:len(backups)-w.options.MaxBackups] {
+			if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		backups = backups[len(backups)-w.options.MaxBackups:]
+	}
+	if w.options.Compress {
+		for _, backup := range backups {
+			if !strings.HasSuffix(backup, compressSuffix) {
+				if err := compress(backup); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// backupPaths returns the paths of the rotated files, oldest first.
+func (w *Writer) backupPaths() ([]string, error) {
+	backups, err := w.backups()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(backups))
+	for i, backup := range backups {
+		paths[i] = backup.path
+	}
+	return paths, nil
+}
+
+// backups returns the rotated files, oldest first.
+func (w *Writer) backups() ([]backup, error) {
+	fileInfos, err := ioutil.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(w.path) + "."
+	var backups []backup
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressSuffix)
+		if len(timestamp) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, timestamp[:len(backupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		// allow the suffix added by backupPath for duplicate timestamps
+		index := 0
+		if suffix := timestamp[len(backupTimeFormat):]; suffix != "" {
+			if !strings.HasPrefix(suffix, "-") {
+				continue
+			}
+			if index, err = strconv.Atoi(suffix[1:]); err != nil || index < 1 {
+				continue
+			}
+		}
+		backups = append(backups, backup{filepath.Join(filepath.Dir(w.path), name), t, index})
+	}
+	sort.Slice(
+		backups,
+		func(i int, j int) bool {
+			if !backups[i].time.Equal(backups[j].time) {
+				return backups[i].time.Before(backups[j].time)
+			}
+			return backups[i].index < backups[j].index
+		},
+	)
+	return backups, nil
+}
+
+type backup struct {
+	path  string
+	time  time.Time
+	index int
+}
+
+func compress(path string) (retErr error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+	tmpPath := path + compressSuffix + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gzipWriter := gzip.NewWriter(tmpFile)
+	_, err = io.Copy(gzipWriter, file)
+	if closeErr := gzipWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path+compressSuffix); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func nextRotation(t time.Time, interval Interval) time.Time {
+	switch interval {
+	case IntervalHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+	case IntervalDaily:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
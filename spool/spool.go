@@ -0,0 +1,586 @@
+/*
+Package dlog_spool provides a disk-backed buffer for network backends.
+
+A Spool is a dlog.EntryHandler that appends Entries to segment files in
+a directory, and sends them to another dlog.EntryHandler in the background,
+retrying with backoff until they are accepted:
+
+	writer, err := dlog_fluent.NewWriter(options)
+	if err != nil {
+		return err
+	}
+	spool, err := dlog_spool.NewSpool("/var/spool/app", writer, dlog_spool.Options{})
+	if err != nil {
+		return err
+	}
+	dlog.SetLogger(dlog.NewEntryLogger(spool))
+
+Entries that were not sent when the process exits are sent after the Spool is
+created again with the same directory. Entries are sent at least once: after
+a failure or a restart, Entries that were already sent may be sent again.
+
+If the downstream EntryHandler implements Flusher, Flush is called after each
+batch of Entries, and the batch is only considered sent if Flush succeeds.
+
+Fields are stored as JSON, so field values are sent as the types that
+encoding/json decodes to, for example float64 for numbers.
+*/
+package dlog_spool // import "go.pedge.io/dlog/spool"
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+const (
+	// DefaultSegmentSize is the size of a segment if Options.SegmentSize is not set.
+	DefaultSegmentSize = 16 << 20
+	// DefaultMaxDiskSize is the maximum size of all segments if Options.MaxDiskSize is not set.
+	DefaultMaxDiskSize = 1 << 30
+	// DefaultBatchSize is the number of Entries sent between checkpoints if Options.BatchSize is not set.
+	DefaultBatchSize = 256
+	// DefaultMinBackoff is the first backoff if Options.MinBackoff is not set.
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the maximum backoff if Options.MaxBackoff is not set.
+	DefaultMaxBackoff = time.Minute
+
+	segmentSuffix  = ".seg"
+	checkpointName = "checkpoint"
+	headerLen      = 8
+	pollInterval   = time.Second
+)
+
+var (
+	// ErrClosed is returned if the Spool is used after Close.
+	ErrClosed = errors.New("dlog_spool: spool is closed")
+
+	errCorrupt = errors.New("dlog_spool: corrupt record")
+)
+
+// Flusher is implemented by EntryHandlers that buffer Entries.
+type Flusher interface {
+	Flush() error
+}
+
+// Options are the options for a Spool.
+type Options struct {
+	// SegmentSize is the size after which a new segment file is started.
+	// If 0, DefaultSegmentSize is used.
+	SegmentSize int64
+	// MaxDiskSize is the maximum size of all segment files. If exceeded,
+	// the oldest segments are deleted, even if their Entries were not sent.
+	// If 0, DefaultMaxDiskSize is used.
+	MaxDiskSize int64
+	// BatchSize is the number of Entries sent between checkpoints.
+	// If 0, DefaultBatchSize is used.
+	BatchSize int
+	// MinBackoff is the backoff after the first failure, which is doubled after every failure.
+	// If 0, DefaultMinBackoff is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum backoff.
+	// If 0, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+	// Sync syncs the segment file after every Entry, so that Entries are not
+	// lost if the machine crashes. Without Sync, Entries are only not lost if
+	// the process crashes.
+	Sync bool
+}
+
+// Spool is a dlog.EntryHandler that spools Entries to disk and sends
+// them to another dlog.EntryHandler.
+//
+// Errors while sending in the background are printed to stderr.
+type Spool struct {
+	dir        string
+	downstream dlog.EntryHandler
+	options    Options
+
+	lock      sync.Mutex
+	segments  []*segment
+	file      *os.File
+	totalSize int64
+	// the position of the next Entry to send
+	readID     uint64
+	readOffset int64
+	closed     bool
+
+	notifyC chan struct{}
+	doneC   chan struct{}
+	wg      sync.WaitGroup
+}
+
+type segment struct {
+	id   uint64
+	size int64
+}
+
+// record is the stored form of an Entry.
+type record struct {
+	Time    time.Time              `json:"time"`
+	Level   int32                  `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	File    string                 `json:"file,omitempty"`
+	Line    int                    `json:"line,omitempty"`
+}
+
+// NewSpool returns a new Spool that stores Entries in the directory and
+// sends them to the downstream dlog.EntryHandler.
+//
+// Entries left in the directory by a previous Spool are sent first.
+func NewSpool(dir string, downstream dlog.EntryHandler, options Options) (*Spool, error) {
+	if options.SegmentSize == 0 {
+		options.SegmentSize = DefaultSegmentSize
+	}
+	if options.MaxDiskSize == 0 {
+		options.MaxDiskSize = DefaultMaxDiskSize
+	}
+	if options.MaxDiskSize < options.SegmentSize {
+		return nil, fmt.Errorf("dlog_spool: MaxDiskSize %d is less than SegmentSize %d", options.MaxDiskSize, options.SegmentSize)
+	}
+	if options.BatchSize == 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+	s := &Spool{
+		dir:        dir,
+		downstream: downstream,
+		options:    options,
+		notifyC:    make(chan struct{}, 1),
+		doneC:      make(chan struct{}),
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// Handle appends the Entry to the current segment.
+func (s *Spool) Handle(entry *dlog.Entry) error {
+	payload, err := encodeRecord(entry)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, headerLen+len(payload))
+	binary.BigEndian.PutUint32(data, uint32(len(payload)))
+	binary.BigEndian.PutUint32(data[4:], crc32.ChecksumIEEE(payload))
+	copy(data[headerLen:], payload)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	current := s.segments[len(s.segments)-1]
+	if current.size > 0 && current.size+int64(len(data)) > s.options.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		current = s.segments[len(s.segments)-1]
+	}
+	if _, err := s.file.Write(data); err != nil {
+		// remove any partial record
+		_ = s.file.Truncate(current.size)
+		return err
+	}
+	// the record is counted even if it cannot be synced, so that the offsets of the next records are correct
+	current.size += int64(len(data))
+	s.totalSize += int64(len(data))
+	s.evict()
+	select {
+	case s.notifyC <- struct{}{}:
+	default:
+	}
+	if s.options.Sync {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+func encodeRecord(entry *dlog.Entry) ([]byte, error) {
+	r := &record{
+		Time:    entry.Time,
+		Level:   int32(entry.Level),
+		Message: entry.Message,
+		Fields:  entry.Fields,
+		File:    entry.File,
+		Line:    entry.Line,
+	}
+	data, err := json.Marshal(r)
+	if err == nil {
+		return data, nil
+	}
+	// fall back to strings for the values that cannot be encoded
+	r.Fields = make(map[string]interface{}, len(entry.Fields))
+	for key, value := range entry.Fields {
+		if _, err := json.Marshal(value); err != nil {
+			value = fmt.Sprint(value)
+		}
+		r.Fields[key] = value
+	}
+	return json.Marshal(r)
+}
+
+// Close stops sending Entries and closes the current segment.
+//
+// Entries that were not sent are sent by the next Spool created with the directory.
+func (s *Spool) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	s.lock.Unlock()
+	close(s.doneC)
+	s.wg.Wait()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+func (s *Spool) run() {
+	defer s.wg.Done()
+	backoff := s.options.MinBackoff
+	for {
+		sent, err := s.send()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dlog_spool: could not send entries: %v\n", err)
+			if !s.wait(backoff, nil) {
+				return
+			}
+			if backoff *= 2; backoff > s.options.MaxBackoff {
+				backoff = s.options.MaxBackoff
+			}
+			continue
+		}
+		backoff = s.options.MinBackoff
+		if sent == 0 && !s.wait(pollInterval, s.notifyC) {
+			return
+		}
+		select {
+		case <-s.doneC:
+			return
+		default:
+		}
+	}
+}
+
+// wait waits for the duration or the channel, and returns false if the Spool was closed.
+func (s *Spool) wait(d time.Duration, c <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c:
+	case <-s.doneC:
+		return false
+	}
+	return true
+}
+
+// send sends a batch of Entries, and returns the number of Entries sent.
+func (s *Spool) send() (int, error) {
+	for {
+		id, offset, size, last := s.readPosition()
+		if offset < size {
+			entries, nextOffset, err := s.read(id, offset, size)
+			if err != nil {
+				return 0, err
+			}
+			for _, entry := range entries {
+				if err := s.downstream.Handle(entry); err != nil {
+					return 0, err
+				}
+			}
+			if flusher, ok := s.downstream.(Flusher); ok {
+				if err := flusher.Flush(); err != nil {
+					return 0, err
+				}
+			}
+			return len(entries), s.checkpoint(id, offset, nextOffset)
+		}
+		if last {
+			return 0, nil
+		}
+		// the segment was sent and a newer segment exists
+		if err := s.finishSegment(id); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readPosition returns the segment and offset to read from, the size of
+// the segment, and whether it is the current segment.
+func (s *Spool) readPosition() (uint64, int64, int64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, segment := range s.segments {
+		if segment.id == s.readID {
+			return segment.id, s.readOffset, segment.size, i == len(s.segments)-1
+		}
+		if segment.id > s.readID {
+			// the segment being read was evicted
+			s.readID = segment.id
+			s.readOffset = 0
+			return segment.id, 0, segment.size, i == len(s.segments)-1
+		}
+	}
+	// not reached, as the current segment is never evicted
+	current := s.segments[len(s.segments)-1]
+	return current.id, current.size, current.size, true
+}
+
+// read reads up to Options.BatchSize Entries from the segment between
+// the offset and size, and returns the offset after the Entries.
+//
+// A corrupt record skips the rest of the segment.
+func (s *Spool) read(id uint64, offset int64, size int64) ([]*dlog.Entry, int64, error) {
+	file, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// the segment was evicted while reading
+			return nil, offset, nil
+		}
+		return nil, 0, err
+	}
+	defer func() { _ = file.Close() }()
+	var entries []*dlog.Entry
+	header := make([]byte, headerLen)
+	for offset < size && len(entries) < s.options.BatchSize {
+		entry, n, err := readRecord(file, header, offset, size)
+		if err != nil {
+			if err != errCorrupt {
+				return nil, 0, err
+			}
+			fmt.Fprintf(os.Stderr, "dlog_spool: skipping rest of segment %d after corrupt record at offset %d\n", id, offset)
+			return entries, size, nil
+		}
+		entries = append(entries, entry)
+		offset += n
+	}
+	return entries, offset, nil
+}
+
+// checkpoint stores the read position after a batch was sent, unless
+// the segment was evicted while sending.
+func (s *Spool) checkpoint(id uint64, offset int64, nextOffset int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.readID != id || s.readOffset != offset {
+		return nil
+	}
+	s.readOffset = nextOffset
+	return s.writeCheckpoint()
+}
+
+// finishSegment deletes the segment after it was sent, and moves the read
+// position to the next segment.
+func (s *Spool) finishSegment(id uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.segments) < 2 || s.segments[0].id != id {
+		return nil
+	}
+	if err := os.Remove(s.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.totalSize -= s.segments[0].size
+	s.segments = s.segments[1:]
+	s.readID = s.segments[0].id
+	s.readOffset = 0
+	return s.writeCheckpoint()
+}
+
+// rotate must be called with the lock held.
+//
+// If the next segment cannot be opened, the current segment is kept, and
+// the next Entry tries to rotate again.
+func (s *Spool) rotate() error {
+	id := s.segments[len(s.segments)-1].id + 1
+	file, err := os.OpenFile(s.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	previousFile := s.file
+	s.file = file
+	s.segments = append(s.segments, &segment{id: id})
+	return previousFile.Close()
+}
+
+// evict must be called with the lock held.
+func (s *Spool) evict() {
+	for s.totalSize > s.options.MaxDiskSize && len(s.segments) > 1 {
+		evicted := s.segments[0]
+		if err := os.Remove(s.segmentPath(evicted.id)); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "dlog_spool: could not delete segment %d: %v\n", evicted.id, err)
+			return
+		}
+		s.totalSize -= evicted.size
+		s.segments = s.segments[1:]
+		if evicted.id >= s.readID {
+			fmt.Fprintf(os.Stderr, "dlog_spool: disk size exceeded, dropped unsent entries in segment %d\n", evicted.id)
+		}
+	}
+}
+
+// open loads the segments and checkpoint in the directory.
+func (s *Spool) open() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	fileInfos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		if fileInfo.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, &segment{id, fileInfo.Size()})
+	}
+	sort.Slice(s.segments, func(i int, j int) bool { return s.segments[i].id < s.segments[j].id })
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, &segment{id: 1})
+	}
+	current := s.segments[len(s.segments)-1]
+	file, err := os.OpenFile(s.segmentPath(current.id), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	// truncate a partial record written before a crash
+	validSize, err := validSize(file, current.size)
+	if err == nil && validSize < current.size {
+		err = file.Truncate(validSize)
+		current.size = validSize
+	}
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	s.file = file
+	for _, segment := range s.segments {
+		s.totalSize += segment.size
+	}
+	s.readID, s.readOffset = s.segments[0].id, 0
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, checkpointName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		_ = file.Close()
+		return err
+	}
+	var id uint64
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &id, &offset); err != nil {
+		fmt.Fprintf(os.Stderr, "dlog_spool: ignoring corrupt checkpoint: %v\n", err)
+		return nil
+	}
+	for len(s.segments) > 1 && s.segments[0].id < id {
+		// the segment was sent before it could be deleted
+		if err := os.Remove(s.segmentPath(s.segments[0].id)); err != nil && !os.IsNotExist(err) {
+			_ = file.Close()
+			return err
+		}
+		s.totalSize -= s.segments[0].size
+		s.segments = s.segments[1:]
+	}
+	if segment := s.segments[0]; segment.id == id {
+		if offset > segment.size {
+			offset = segment.size
+		}
+		s.readID, s.readOffset = id, offset
+	} else {
+		s.readID = segment.id
+	}
+	return nil
+}
+
+// writeCheckpoint must be called with the lock held.
+func (s *Spool) writeCheckpoint() error {
+	path := filepath.Join(s.dir, checkpointName)
+	if err := ioutil.WriteFile(path+".tmp", []byte(fmt.Sprintf("%d %d\n", s.readID, s.readOffset)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// readRecord reads the record at the offset, and returns the Entry and the size of the record.
+func readRecord(readerAt io.ReaderAt, header []byte, offset int64, size int64) (*dlog.Entry, int64, error) {
+	if offset+headerLen > size {
+		return nil, 0, errCorrupt
+	}
+	if _, err := readerAt.ReadAt(header, offset); err != nil {
+		return nil, 0, err
+	}
+	length := int64(binary.BigEndian.Uint32(header))
+	if offset+headerLen+length > size {
+		return nil, 0, errCorrupt
+	}
+	payload := make([]byte, length)
+	if _, err := readerAt.ReadAt(payload, offset+headerLen); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, errCorrupt
+	}
+	r := &record{}
+	if err := json.Unmarshal(payload, r); err != nil {
+		return nil, 0, errCorrupt
+	}
+	return &dlog.Entry{
+		Time:    r.Time,
+		Level:   dlog.Level(r.Level),
+		Message: r.Message,
+		Fields:  r.Fields,
+		File:    r.File,
+		Line:    r.Line,
+	}, headerLen + length, nil
+}
+
+// validSize returns the size of the complete records in the segment.
+func validSize(readerAt io.ReaderAt, size int64) (int64, error) {
+	header := make([]byte, headerLen)
+	var offset int64
+	for offset < size {
+		_, n, err := readRecord(readerAt, header, offset, size)
+		if err != nil {
+			if err == errCorrupt {
+				return offset, nil
+			}
+			return 0, err
+		}
+		offset += n
+	}
+	return offset, nil
+}
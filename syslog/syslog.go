@@ -0,0 +1,486 @@
+/*
+Package dlog_syslog provides a syslog backend for dlog.
+
+Entries are written in RFC 5424 or RFC 3164 format over a unix socket, UDP, TCP, or TLS:
+
+	writer, err := dlog_syslog.NewWriter(
+		dlog_syslog.Options{
+			Network: "tls",
+			Address: "logs.example.com:6514",
+		},
+	)
+	if err != nil {
+		return err
+	}
+	dlog.SetLogger(dlog_syslog.NewLogger(writer))
+
+If Options.Network is empty, the local syslog daemon is used, with RFC 3164
+messages terminated by newlines as the local daemons expect.
+*/
+package dlog_syslog // import "go.pedge.io/dlog/syslog"
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/internal"
+)
+
+const (
+	// FormatDefault is FormatRFC3164 for the local syslog daemon, and FormatRFC5424 otherwise.
+	FormatDefault Format = iota
+	// FormatRFC5424 is the format described in RFC 5424, with fields as structured data.
+	FormatRFC5424
+	// FormatRFC3164 is the BSD format described in RFC 3164, with fields appended to the message.
+	FormatRFC3164
+)
+
+const (
+	// FramingDefault is FramingNonTransparent for the local syslog daemon, and FramingOctetCounting otherwise.
+	FramingDefault Framing = iota
+	// FramingOctetCounting prefixes each message with its length, as described in RFC 6587.
+	FramingOctetCounting
+	// FramingNonTransparent terminates each message with a newline, as described in RFC 6587.
+	FramingNonTransparent
+)
+
+// Facilities are the syslog facilities.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	_
+	_
+	_
+	_
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Severities are the syslog severities.
+const (
+	SeverityEmergency Severity = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInformational
+	SeverityDebug
+)
+
+const (
+	// DefaultStructuredDataID is the SD-ID used for fields if Options.StructuredDataID is not set.
+	//
+	// 32473 is the private enterprise number reserved for documentation in RFC 5612.
+	DefaultStructuredDataID = "dlog@32473"
+
+	nilValue          = "-"
+	maxParamNameLen   = 32
+	maxHostnameLen    = 255
+	maxAppNameLen     = 48
+	rfc5424TimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+	rfc3164TimeFormat = "Jan _2 15:04:05"
+)
+
+var (
+	// ErrClosed is returned if the Writer is used after Close.
+	ErrClosed = errors.New("dlog_syslog: writer is closed")
+
+	levelToSeverity = map[dlog.Level]Severity{
+		dlog.LevelNone:  SeverityInformational,
+		dlog.LevelTrace: SeverityDebug,
+		dlog.LevelDebug: SeverityDebug,
+		dlog.LevelInfo:  SeverityInformational,
+		dlog.LevelWarn:  SeverityWarning,
+		dlog.LevelError: SeverityError,
+		dlog.LevelFatal: SeverityCritical,
+		dlog.LevelPanic: SeverityAlert,
+	}
+
+	localNetworks  = []string{"unixgram", "unix"}
+	localAddresses = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+)
+
+// Format is a syslog message format.
+type Format int
+
+// Framing is how messages are delimited on stream transports.
+type Framing int
+
+// Facility is a syslog facility.
+type Facility int
+
+// Severity is a syslog severity.
+type Severity int
+
+// LevelToSeverity returns the Severity for the dlog.Level.
+//
+// Custom Levels have the Severity of dlog.StandardLevel(level).
+func LevelToSeverity(level dlog.Level) Severity {
+	return levelToSeverity[dlog.StandardLevel(level)]
+}
+
+// Options are the options for a Writer.
+type Options struct {
+	// Network is "unixgram", "unix", "udp", "tcp", or "tls".
+	// If empty, the local syslog daemon is used.
+	Network string
+	// Address is the address to connect to, either a socket path or a host:port.
+	// If Network is empty, Address is the socket path of the local syslog daemon,
+	// and if also empty, the usual socket paths such as /dev/log are tried.
+	Address string
+	// TLSConfig is the configuration used for the "tls" Network.
+	TLSConfig *tls.Config
+	// Format is the message format, by default FormatDefault.
+	Format Format
+	// Framing is the framing used on stream transports, by default FramingDefault.
+	// Messages sent over datagram transports are never framed.
+	Framing Framing
+	// Facility is the facility of every message. If 0, FacilityUser is used,
+	// as FacilityKern is reserved for the kernel.
+	Facility Facility
+	// Hostname is the hostname of every message. If empty, os.Hostname is used.
+	Hostname string
+	// AppName is the application name of every message. If empty, the name of the executable is used.
+	AppName string
+	// StructuredDataID is the SD-ID used for fields. If empty, DefaultStructuredDataID is used.
+	StructuredDataID string
+	// Timeout is the timeout for connecting and for each write. If 0, there is no timeout.
+	Timeout time.Duration
+}
+
+// Writer is a dlog.EntryHandler that writes Entries to syslog.
+//
+// The connection is made on the first write, and if a write fails the
+// Writer reconnects and retries the write once.
+type Writer struct {
+	options Options
+	pid     string
+
+	lock   sync.Mutex
+	conn   net.Conn
+	stream bool
+	buffer []byte
+	closed bool
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(options Options) (*Writer, error) {
+	switch options.Network {
+	case "", "unixgram", "unix", "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "tls":
+	default:
+		return nil, fmt.Errorf("dlog_syslog: unknown network: %s", options.Network)
+	}
+	if options.Network != "" && options.Address == "" {
+		return nil, fmt.Errorf("dlog_syslog: no address for network: %s", options.Network)
+	}
+	switch options.Format {
+	case FormatDefault:
+		// rsyslog, journald, and the standard library read RFC 3164 on the local socket
+		options.Format = FormatRFC5424
+		if options.Network == "" {
+			options.Format = FormatRFC3164
+		}
+	case FormatRFC5424, FormatRFC3164:
+	default:
+		return nil, fmt.Errorf("dlog_syslog: unknown format: %d", options.Format)
+	}
+	switch options.Framing {
+	case FramingDefault:
+		options.Framing = FramingOctetCounting
+		if options.Network == "" {
+			options.Framing = FramingNonTransparent
+		}
+	case FramingOctetCounting, FramingNonTransparent:
+	default:
+		return nil, fmt.Errorf("dlog_syslog: unknown framing: %d", options.Framing)
+	}
+	if options.Facility < FacilityKern || options.Facility > FacilityLocal7 {
+		return nil, fmt.Errorf("dlog_syslog: unknown facility: %d", options.Facility)
+	}
+	if options.Facility == FacilityKern {
+		options.Facility = FacilityUser
+	}
+	if options.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		options.Hostname = hostname
+	}
+	if options.AppName == "" {
+		options.AppName = filepath.Base(os.Args[0])
+	}
+	if options.StructuredDataID == "" {
+		options.StructuredDataID = DefaultStructuredDataID
+	}
+	options.Hostname = printASCII(options.Hostname, maxHostnameLen)
+	options.AppName = printASCII(options.AppName, maxAppNameLen)
+	options.StructuredDataID = paramName(options.StructuredDataID)
+	return &Writer{
+		options: options,
+		pid:     strconv.Itoa(os.Getpid()),
+	}, nil
+}
+
+// NewLogger returns a new dlog.Logger that writes to the Writer.
+func NewLogger(writer *Writer) dlog.Logger {
+	return dlog.NewEntryLogger(writer)
+}
+
+// Handle writes the Entry.
+func (w *Writer) Handle(entry *dlog.Entry) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	w.buffer = w.appendMessage(w.buffer[:0], entry)
+	if err := w.write(w.buffer); err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+		if err := w.connect(); err != nil {
+			return err
+		}
+		return w.write(w.buffer)
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// connect must be called with the lock held.
+func (w *Writer) connect() error {
+	if w.options.Network == "" {
+		addresses := localAddresses
+		if w.options.Address != "" {
+			addresses = []string{w.options.Address}
+		}
+		var err error
+		for _, network := range localNetworks {
+			for _, address := range addresses {
+				if w.conn, err = net.DialTimeout(network, address, w.options.Timeout); err == nil {
+					w.stream = network == "unix"
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("dlog_syslog: could not connect to local syslog: %v", err)
+	}
+	var err error
+	switch w.options.Network {
+	case "tls":
+		w.conn, err = tls.DialWithDialer(&net.Dialer{Timeout: w.options.Timeout}, "tcp", w.options.Address, w.options.TLSConfig)
+	default:
+		w.conn, err = net.DialTimeout(w.options.Network, w.options.Address, w.options.Timeout)
+	}
+	if err != nil {
+		return err
+	}
+	switch w.options.Network {
+	case "unix", "tcp", "tcp4", "tcp6", "tls":
+		w.stream = true
+	default:
+		w.stream = false
+	}
+	return nil
+}
+
+// write must be called with the lock held.
+func (w *Writer) write(message []byte) error {
+	if w.options.Timeout > 0 {
+		if err := w.conn.SetWriteDeadline(time.Now().Add(w.options.Timeout)); err != nil {
+			return err
+		}
+	}
+	if !w.stream {
+		_, err := w.conn.Write(message)
+		return err
+	}
+	var frame []byte
+	switch w.options.Framing {
+	case FramingNonTransparent:
+		frame = append(message, '\n')
+	default:
+		frame = make([]byte, 0, len(message)+8)
+		frame = strconv.AppendInt(frame, int64(len(message)), 10)
+		frame = append(frame, ' ')
+		frame = append(frame, message...)
+	}
+	_, err := w.conn.Write(frame)
+	return err
+}
+
+func (w *Writer) appendMessage(buffer []byte, entry *dlog.Entry) []byte {
+	buffer = append(buffer, '<')
+	buffer = strconv.AppendInt(buffer, int64(int(w.options.Facility)*8+int(LevelToSeverity(entry.Level))), 10)
+	buffer = append(buffer, '>')
+	if w.options.Format == FormatRFC3164 {
+		return w.appendRFC3164(buffer, entry)
+	}
+	return w.appendRFC5424(buffer, entry)
+}
+
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (w *Writer) appendRFC5424(buffer []byte, entry *dlog.Entry) []byte {
+	buffer = append(buffer, "1 "...)
+	buffer = entry.Time.AppendFormat(buffer, rfc5424TimeFormat)
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, w.options.Hostname...)
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, w.options.AppName...)
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, w.pid...)
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, nilValue...)
+	buffer = append(buffer, ' ')
+	if len(entry.Fields) == 0 {
+		buffer = append(buffer, nilValue...)
+	} else {
+		buffer = append(buffer, '[')
+		buffer = append(buffer, w.options.StructuredDataID...)
+		for _, key := range dlog_internal.SortedKeys(entry.Fields) {
+			buffer = append(buffer, ' ')
+			buffer = append(buffer, paramName(key)...)
+			buffer = append(buffer, `="`...)
+			buffer = appendParamValue(buffer, fmt.Sprint(entry.Fields[key]))
+			buffer = append(buffer, '"')
+		}
+		buffer = append(buffer, ']')
+	}
+	if entry.Message != "" {
+		buffer = append(buffer, ' ')
+		buffer = append(buffer, entry.Message...)
+	}
+	return buffer
+}
+
+// <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG key=value
+func (w *Writer) appendRFC3164(buffer []byte, entry *dlog.Entry) []byte {
+	buffer = entry.Time.AppendFormat(buffer, rfc3164TimeFormat)
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, w.options.Hostname...)
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, w.options.AppName...)
+	buffer = append(buffer, '[')
+	buffer = append(buffer, w.pid...)
+	buffer = append(buffer, "]: "...)
+	buffer = append(buffer, entry.Message...)
+	for _, key := range dlog_internal.SortedKeys(entry.Fields) {
+		buffer = append(buffer, ' ')
+		buffer = append(buffer, key...)
+		buffer = append(buffer, '=')
+		value := fmt.Sprint(entry.Fields[key])
+		if value == "" || strings.ContainsAny(value, " =\"") {
+			value = strconv.Quote(value)
+		}
+		buffer = append(buffer, value...)
+	}
+	return buffer
+}
+
+// paramName returns the name with the characters not allowed in an
+// RFC 5424 SD-NAME replaced with underscores, truncated to 32 characters.
+func paramName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, len(name)))
+	for i := 0; i < len(name) && buffer.Len() < maxParamNameLen; i++ {
+		switch c := name[i]; {
+		case c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"':
+			buffer.WriteByte('_')
+		default:
+			buffer.WriteByte(c)
+		}
+	}
+	return buffer.String()
+}
+
+// appendParamValue appends the value with '"', '\' and ']' escaped
+// as required for an RFC 5424 PARAM-VALUE.
+func appendParamValue(buffer []byte, value string) []byte {
+	for len(value) > 0 {
+		r, size := utf8.DecodeRuneInString(value)
+		switch r {
+		case '"', '\\', ']':
+			buffer = append(buffer, '\\', byte(r))
+		case utf8.RuneError:
+			if size == 1 {
+				buffer = append(buffer, string(utf8.RuneError)...)
+			} else {
+				buffer = append(buffer, value[:size]...)
+			}
+		default:
+			buffer = append(buffer, value[:size]...)
+		}
+		value = value[size:]
+	}
+	return buffer
+}
+
+// printASCII returns the value with the characters that are not printable
+// US-ASCII replaced with underscores, truncated to maxLen, or "-" if empty.
+func printASCII(value string, maxLen int) string {
+	if value == "" {
+		return nilValue
+	}
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	return strings.Map(
+		func(r rune) rune {
+			if r <= ' ' || r > '~' {
+				return '_'
+			}
+			return r
+		},
+		value,
+	)
+}
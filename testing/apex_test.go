@@ -0,0 +1,43 @@
+package dlog_testing
+
+import (
+	"testing"
+
+	apexlog "github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/apex"
+)
+
+func TestApex(t *testing.T) {
+	handler := memory.New()
+	logger := dlog_apex.NewLogger(&apexlog.Logger{Handler: handler, Level: apexlog.InfoLevel}).WithField("service", "api")
+	debugLogger := logger.AtLevel(dlog.LevelDebug)
+	logger.Debugln("dropped")
+	debugLogger.With(dlog.Int("count", 2)).Tracef("trace %d", 1)
+	logger.WithFields(map[string]interface{}{"error": "test error"}).Errorln("failed")
+	if logger.Enabled(dlog.LevelDebug) || !debugLogger.Enabled(dlog.LevelDebug) {
+		t.Error("expected AtLevel to leave the parent level unchanged")
+	}
+	if len(handler.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(handler.Entries))
+	}
+	for i, expected := range []struct {
+		level   apexlog.Level
+		message string
+		fields  map[string]interface{}
+	}{
+		{apexlog.DebugLevel, "trace 1", map[string]interface{}{"service": "api", "count": int64(2)}},
+		{apexlog.ErrorLevel, "failed", map[string]interface{}{"service": "api", "error": "test error"}},
+	} {
+		entry := handler.Entries[i]
+		if entry.Level != expected.level || entry.Message != expected.message || len(entry.Fields) != len(expected.fields) {
+			t.Errorf("unexpected entry %d: %v %s %v", i, entry.Level, entry.Message, entry.Fields)
+		}
+		for key, value := range expected.fields {
+			if entry.Fields[key] != value {
+				t.Errorf("expected %v for %s, got %v", value, key, entry.Fields[key])
+			}
+		}
+	}
+}
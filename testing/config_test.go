@@ -0,0 +1,144 @@
+package dlog_testing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.pedge.io/dlog"
+)
+
+func TestConfigBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log.json")
+	config := &dlog.Config{}
+	if err := json.Unmarshal([]byte(`{
+		"level": "warn",
+		"components": {"db": "debug"},
+		"outputs": [{"path": "`+path+`", "encoder": "json"}],
+		"fields": {"service": "api"}
+	}`), config); err != nil {
+		t.Fatal(err)
+	}
+	logger, closer, err := config.BuildWithCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = closer.Close() }()
+	logger.Infoln("dropped")
+	logger.Warnln("kept")
+	logger.WithField(dlog.ComponentKey, "db").Debugln("db debug")
+	logger.WithField(dlog.ComponentKey, "http").Debugln("dropped")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %s", len(lines), string(data))
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["message"] != "db debug" || entry["level"] != "DEBUG" || entry["service"] != "api" || entry["component"] != "db" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, testCase := range []struct {
+		config *dlog.Config
+		key    string
+	}{
+		{&dlog.Config{Backend: "unknown"}, "backend"},
+		{&dlog.Config{Level: "loud"}, "level"},
+		{&dlog.Config{Components: map[string]string{"db": "loud"}}, "components.db"},
+		{&dlog.Config{Outputs: []dlog.OutputConfig{{Path: "stderr"}, {Path: "stdout", Encoder: "xml"}}}, "outputs[1].encoder"},
+		{&dlog.Config{Outputs: []dlog.OutputConfig{{Encoder: "json"}}}, "outputs[0].path"},
+		{&dlog.Config{Sampling: &dlog.SamplingConfig{Thereafter: -1}}, "sampling.thereafter"},
+		{&dlog.Config{Sampling: &dlog.SamplingConfig{}}, "sampling"},
+	} {
+		err := testCase.config.Validate()
+		configErr, ok := err.(*dlog.ConfigError)
+		if !ok {
+			t.Errorf("expected *dlog.ConfigError for %s, got %v", testCase.key, err)
+			continue
+		}
+		if configErr.Key != testCase.key {
+			t.Errorf("expected key %s, got %s", testCase.key, configErr.Key)
+		}
+	}
+}
+
+func TestConfigSampling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log.txt")
+	logger, closer, err := (&dlog.Config{
+		Outputs:  []dlog.OutputConfig{{Path: path}},
+		Sampling: &dlog.SamplingConfig{Initial: 2, Thereafter: 3},
+	}).BuildWithCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = closer.Close() }()
+	for i := 0; i < 8; i++ {
+		logger.Infof("sampled %d", i)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1, 2 initial, then 5 and 8
+	if count := strings.Count(string(data), "sampled"); count != 4 {
+		t.Errorf("expected 4 lines, got %d: %s", count, string(data))
+	}
+}
+
+func TestConfigDisabledLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	logger, closer, err := (&dlog.Config{
+		Level:    "warn",
+		Outputs:  []dlog.OutputConfig{{Path: filepath.Join(dir, "log.txt")}},
+		Sampling: &dlog.SamplingConfig{Initial: 1},
+	}).BuildWithCloser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	logger.Debugln(stringerFunc(func() string {
+		calls++
+		return "formatted"
+	}))
+	if calls != 0 {
+		t.Errorf("expected disabled levels to not be formatted, got %d calls", calls)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the output file is already closed
+	if err := closer.Close(); err == nil {
+		t.Error("expected an error closing twice")
+	}
+}
+
+type stringerFunc func() string
+
+func (f stringerFunc) String() string {
+	return f()
+}
@@ -0,0 +1,113 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.pedge.io/dlog"
+)
+
+var (
+	testContextHookInstance = &testContextHook{}
+	testContextHookOnce     sync.Once
+)
+
+type testContextKey struct{}
+
+func TestContextLogger(t *testing.T) {
+	registerTestContextHook()
+	ctx := context.WithValue(context.Background(), testContextKey{}, "abc")
+	handler := &testEntryHandler{}
+	logger := dlog.NewContextLogger(ctx, dlog.NewEntryLogger(handler).AtLevel(dlog.LevelInfo))
+	logger.WithField("count", 1).Infof("hello %s", "world")
+	logger.Debugln("dropped")
+	entries := handler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Message != "hello world" || entry.Fields["request_id"] != "abc" || entry.Fields["count"] != int64(1) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if filepath.Base(entry.File) != "context_test.go" || entry.Line != 26 {
+		t.Errorf("expected caller context_test.go:26, got %s:%d", entry.File, entry.Line)
+	}
+	calls := testContextHookInstance.Calls(ctx)
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 hook call, got %d", len(calls))
+	}
+	if calls[0].level != dlog.LevelInfo || calls[0].message != "hello world" || calls[0].fields != "request_id count" {
+		t.Errorf("unexpected hook call: %+v", calls[0])
+	}
+}
+
+func TestContextLoggerEncoder(t *testing.T) {
+	registerTestContextHook()
+	ctx := context.WithValue(context.Background(), testContextKey{}, "def")
+	buffer := &bytes.Buffer{}
+	logger := dlog.NewContextLogger(ctx, dlog.NewEncoderLogger(buffer, dlog.NewLogfmtEncoder()))
+	logger.Warnln("hello")
+	if output := buffer.String(); !strings.Contains(output, "msg=hello request_id=def") {
+		t.Errorf("expected the context field, got %s", output)
+	}
+	// without a value in the context, the hook adds no fields
+	buffer.Reset()
+	dlog.NewContextLogger(context.Background(), dlog.NewEncoderLogger(buffer, dlog.NewLogfmtEncoder())).Warnln("hello")
+	if output := buffer.String(); strings.Contains(output, "request_id") {
+		t.Errorf("expected no context field, got %s", output)
+	}
+}
+
+type testContextHookCall struct {
+	level   dlog.Level
+	message string
+	fields  string
+}
+
+// testContextHook adds the request_id field from testContextKey, and records the log calls by request ID.
+type testContextHook struct {
+	calls map[string][]*testContextHookCall
+	lock  sync.Mutex
+}
+
+func (h *testContextHook) Fields(ctx context.Context) []dlog.Field {
+	if requestID, ok := ctx.Value(testContextKey{}).(string); ok {
+		return []dlog.Field{dlog.String("request_id", requestID)}
+	}
+	return nil
+}
+
+func (h *testContextHook) Log(ctx context.Context, level dlog.Level, message string, fields []dlog.Field) {
+	requestID, ok := ctx.Value(testContextKey{}).(string)
+	if !ok {
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		keys = append(keys, field.Key)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.calls == nil {
+		h.calls = make(map[string][]*testContextHookCall)
+	}
+	h.calls[requestID] = append(h.calls[requestID], &testContextHookCall{level, message, strings.Join(keys, " ")})
+}
+
+func (h *testContextHook) Calls(ctx context.Context) []*testContextHookCall {
+	requestID, _ := ctx.Value(testContextKey{}).(string)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	calls := h.calls[requestID]
+	delete(h.calls, requestID)
+	return calls
+}
+
+// registerTestContextHook registers the test ContextHook once, as ContextHooks cannot be unregistered.
+func registerTestContextHook() {
+	testContextHookOnce.Do(func() { dlog.RegisterContextHook(testContextHookInstance) })
+}
@@ -0,0 +1,271 @@
+package dlog_testing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/elastic"
+)
+
+func TestElastic(t *testing.T) {
+	server := newTestElasticServer(t, nil)
+	defer server.Close()
+	writer := newTestElasticWriter(t, server.URL)
+	logger := dlog_elastic.NewLogger(writer)
+	logger.WithField("component", "db").WithField("message", "dropped").Infoln("one")
+	if err := writer.Handle(
+		&dlog.Entry{
+			Time:    time.Date(2017, 1, 2, 23, 4, 5, 6, time.FixedZone("", -3600)),
+			Level:   dlog.LevelError,
+			Message: "two",
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	request := requests[0]
+	if request.contentType != "application/x-ndjson" || request.username != "user" || request.password != "secret" {
+		t.Errorf("unexpected headers: %+v", request)
+	}
+	if len(request.items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(request.items))
+	}
+	first := request.items[0]
+	if first.index != "logs-"+time.Now().UTC().Format("2006.01.02") {
+		t.Errorf("unexpected index: %s", first.index)
+	}
+	if first.document["message"] != "one" || first.document["level"] != "info" || first.document["component"] != "db" || first.document["caller"] == nil {
+		t.Errorf("unexpected document: %v", first.document)
+	}
+	second := request.items[1]
+	if second.index != "logs-2017.01.03" {
+		t.Errorf("expected the index of the UTC date, got %s", second.index)
+	}
+	if second.document["@timestamp"] != "2017-01-02T23:04:05.000000006-01:00" || second.document["level"] != "error" {
+		t.Errorf("unexpected document: %v", second.document)
+	}
+}
+
+func TestElasticRetryItems(t *testing.T) {
+	server := newTestElasticServer(
+		t,
+		[][]int{
+			{201, 429, 400, 503},
+			{201, 201},
+		},
+	)
+	defer server.Close()
+	writer := newTestElasticWriter(t, server.URL)
+	defer func() { _ = writer.Close() }()
+	logger := dlog_elastic.NewLogger(writer)
+	for i := 0; i < 4; i++ {
+		logger.Infof("message %d", i)
+	}
+	err := writer.Flush()
+	itemErrors, ok := err.(dlog_elastic.ItemErrors)
+	if !ok || len(itemErrors) != 1 || itemErrors[0].Status != 400 || itemErrors[0].Type != "mapper_parsing_exception" {
+		t.Fatalf("expected the rejected item to be dropped, got %v", err)
+	}
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	var messages []interface{}
+	for _, item := range requests[1].items {
+		messages = append(messages, item.document["message"])
+	}
+	if len(messages) != 2 || messages[0] != "message 1" || messages[1] != "message 3" {
+		t.Errorf("expected only the failed items to be retried, got %v", messages)
+	}
+}
+
+func TestElasticBufferFull(t *testing.T) {
+	server := newTestElasticServer(t, nil)
+	defer server.Close()
+	writer, err := dlog_elastic.NewWriter(
+		dlog_elastic.Options{
+			URL:           server.URL,
+			FlushInterval: time.Hour,
+			BufferLimit:   1,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = writer.Close() }()
+	entry := &dlog.Entry{Time: time.Now(), Level: dlog.LevelInfo, Message: "hello"}
+	if err := writer.Handle(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Handle(entry); err != dlog_elastic.ErrBufferFull {
+		t.Fatalf("expected ErrBufferFull, got %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Handle(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestElasticRetryRequest(t *testing.T) {
+	server := newTestElasticServer(t, nil)
+	server.statusCodes = []int{http.StatusServiceUnavailable, http.StatusBadRequest}
+	defer server.Close()
+	writer := newTestElasticWriter(t, server.URL)
+	defer func() { _ = writer.Close() }()
+	dlog_elastic.NewLogger(writer).Infoln("hello")
+	err := writer.Flush()
+	responseError, ok := err.(*dlog_elastic.ResponseError)
+	if !ok || responseError.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request ResponseError, got %v", err)
+	}
+	if requests := server.Requests(); len(requests) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(requests))
+	}
+}
+
+type testElasticServer struct {
+	*httptest.Server
+	// statusCodes are the statuses of the requests
+	statusCodes []int
+	// itemStatuses are the statuses of the items of the requests
+	itemStatuses [][]int
+	requests     []*testElasticRequest
+	lock         sync.Mutex
+}
+
+type testElasticRequest struct {
+	contentType string
+	username    string
+	password    string
+	items       []*testElasticItem
+}
+
+type testElasticItem struct {
+	index    string
+	document map[string]interface{}
+}
+
+// newTestElasticServer returns a new test server that responds with the item
+// statuses in order, and then with 201 for every item.
+func newTestElasticServer(t *testing.T, itemStatuses [][]int) *testElasticServer {
+	server := &testElasticServer{itemStatuses: itemStatuses}
+	server.Server = httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				if request.URL.Path != dlog_elastic.BulkPath {
+					http.NotFound(responseWriter, request)
+					return
+				}
+				body, err := ioutil.ReadAll(request.Body)
+				if err != nil {
+					http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				items, err := readTestElasticItems(body)
+				if err != nil {
+					http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+					return
+				}
+				username, password, _ := request.BasicAuth()
+				server.lock.Lock()
+				defer server.lock.Unlock()
+				server.requests = append(
+					server.requests,
+					&testElasticRequest{request.Header.Get("Content-Type"), username, password, items},
+				)
+				if len(server.statusCodes) > 0 {
+					statusCode := server.statusCodes[0]
+					server.statusCodes = server.statusCodes[1:]
+					http.Error(responseWriter, http.StatusText(statusCode), statusCode)
+					return
+				}
+				var statuses []int
+				if len(server.itemStatuses) > 0 {
+					statuses = server.itemStatuses[0]
+					server.itemStatuses = server.itemStatuses[1:]
+				}
+				responseItems := make([]interface{}, len(items))
+				hasErrors := false
+				for i, item := range items {
+					status := http.StatusCreated
+					if i < len(statuses) {
+						status = statuses[i]
+					}
+					result := map[string]interface{}{"_index": item.index, "status": status}
+					switch {
+					case status == http.StatusBadRequest:
+						result["error"] = map[string]string{"type": "mapper_parsing_exception", "reason": "failed to parse"}
+					case status/100 != 2:
+						result["error"] = map[string]string{"type": "es_rejected_execution_exception", "reason": "rejected"}
+					}
+					hasErrors = hasErrors || status/100 != 2
+					responseItems[i] = map[string]interface{}{"create": result}
+				}
+				responseWriter.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(responseWriter).Encode(map[string]interface{}{"took": 1, "errors": hasErrors, "items": responseItems})
+			},
+		),
+	)
+	return server
+}
+
+func (s *testElasticServer) Requests() []*testElasticRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*testElasticRequest(nil), s.requests...)
+}
+
+// readTestElasticItems reads the create actions and documents of a bulk request.
+func readTestElasticItems(body []byte) ([]*testElasticItem, error) {
+	var items []*testElasticItem
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			return nil, err
+		}
+		create, ok := action["create"]
+		if !ok || !scanner.Scan() {
+			return nil, fmt.Errorf("unexpected action: %v", action)
+		}
+		item := &testElasticItem{index: create["_index"]}
+		if err := json.Unmarshal(scanner.Bytes(), &item.document); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+func newTestElasticWriter(t *testing.T, url string) *dlog_elastic.Writer {
+	writer, err := dlog_elastic.NewWriter(
+		dlog_elastic.Options{
+			URL:           url,
+			Username:      "user",
+			Password:      "secret",
+			FlushInterval: time.Hour,
+			MinBackoff:    time.Millisecond,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
@@ -0,0 +1,118 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+func TestWith(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	logger := dlog.NewEncoderLogger(buffer, dlog.NewJSONEncoder()).AtLevel(dlog.LevelInfo)
+	logger.With(
+		dlog.String("string", "a \"quoted\"\nvalue"),
+		dlog.Int("int", 1),
+		dlog.Duration("duration", 1500*time.Millisecond),
+		dlog.Err(errTest),
+		dlog.Any("any", []int{1, 2}),
+	).WithField("int", 2).Infoln("message")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buffer.String())
+	}
+	for key, expected := range map[string]interface{}{
+		"message":  "message",
+		"level":    "INFO",
+		"string":   "a \"quoted\"\nvalue",
+		"int":      float64(2),
+		"duration": "1.5s",
+		"error":    "test error",
+	} {
+		if entry[key] != expected {
+			t.Errorf("expected %v for %s, got %v", expected, key, entry[key])
+		}
+	}
+}
+
+func TestEncoderReservedKeys(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	dlog.NewEncoderLogger(buffer, dlog.NewJSONEncoder()).AtLevel(dlog.LevelInfo).With(
+		dlog.String("time", "t"),
+		dlog.String("level", "l"),
+		dlog.String("message", "m"),
+	).Infoln("message")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buffer.String())
+	}
+	for key, expected := range map[string]interface{}{
+		"level":          "INFO",
+		"message":        "message",
+		"fields.time":    "t",
+		"fields.level":   "l",
+		"fields.message": "m",
+	} {
+		if entry[key] != expected {
+			t.Errorf("expected %v for %s, got %v", expected, key, entry[key])
+		}
+	}
+	buffer.Reset()
+	dlog.NewEncoderLogger(buffer, dlog.NewLogfmtEncoder()).AtLevel(dlog.LevelInfo).With(
+		dlog.String("level", "l"),
+		dlog.String("msg", "m"),
+		dlog.String("a key=\"b\"", "value"),
+	).Infoln("message")
+	if expected := ` level=info msg=message fields.level=l fields.msg=m a_key__b_=value` + "\n"; !strings.HasSuffix(buffer.String(), expected) {
+		t.Errorf("expected suffix %q, got %q", expected, buffer.String())
+	}
+}
+
+func TestWithDuration(t *testing.T) {
+	for _, duration := range []time.Duration{
+		0,
+		1,
+		-1500,
+		999 * time.Microsecond,
+		1500 * time.Microsecond,
+		time.Second,
+		90 * time.Minute,
+		-(25*time.Hour + 100*time.Millisecond),
+		1<<63 - 1,
+	} {
+		buffer := bytes.NewBuffer(nil)
+		dlog.NewEncoderLogger(buffer, dlog.NewLogfmtEncoder()).AtLevel(dlog.LevelInfo).With(dlog.Duration("duration", duration)).Infoln("message")
+		if !strings.HasSuffix(buffer.String(), " duration="+duration.String()+"\n") {
+			t.Errorf("expected %s, got %s", duration.String(), buffer.String())
+		}
+	}
+}
+
+func TestWithAllocs(t *testing.T) {
+	logger := dlog.NewEncoderLogger(ioutil.Discard, dlog.NewJSONEncoder()).AtLevel(dlog.LevelInfo).With(
+		dlog.String("string", "value"),
+		dlog.Int("int", 1),
+		dlog.Duration("duration", time.Second),
+		dlog.Err(errTest),
+	)
+	// warm up the buffer pool
+	logger.Infof("message")
+	// the only allocation should be the message from fmt.Sprintf
+	if allocs := testing.AllocsPerRun(100, func() { logger.Infof("message") }); allocs > 1 {
+		t.Errorf("expected at most 1 allocation, got %v", allocs)
+	}
+}
+
+func TestDisabledLevelAllocs(t *testing.T) {
+	logger := dlog.NewEncoderLogger(ioutil.Discard, dlog.NewJSONEncoder()).AtLevel(dlog.LevelInfo)
+	if allocs := testing.AllocsPerRun(100, func() {
+		logger.Debugf("message %s", "value")
+		logger.Debugln("message", "value")
+	}); allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
@@ -0,0 +1,299 @@
+package dlog_testing
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/sink/file"
+)
+
+func TestFileWriterMaxSize(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log", "app.log")
+	writer, err := dlog_file.NewWriter(path, dlog_file.Options{MaxSize: 20, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := dlog.NewEncoderLogger(writer, &messageEncoder{})
+	for _, message := range []string{"aaaaaaaaa", "bbbbbbbbb", "ccccccccc", "ddddddddd", "eeeeeeeee", "fffffffff", "ggggggggg"} {
+		logger.Infoln(message)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, "ggggggggg\n")
+	backups := testBackups(t, path)
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+	checkFile(t, backups[0], "ccccccccc\nddddddddd\n")
+	checkFile(t, backups[1], "eeeeeeeee\nfffffffff\n")
+}
+
+func TestFileWriterInterval(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app.log")
+	clock := &testClock{now: time.Date(2017, 1, 1, 23, 30, 0, 0, time.Local)}
+	writer, err := dlog_file.NewWriter(path, dlog_file.Options{Interval: dlog_file.IntervalDaily, Now: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, writer, "one\n")
+	clock.Add(29 * time.Minute)
+	write(t, writer, "two\n")
+	clock.Add(time.Minute)
+	write(t, writer, "three\n")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, "three\n")
+	backups := testBackups(t, path)
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %v", backups)
+	}
+	if !strings.HasSuffix(backups[0], ".2017-01-02T00-00-00.000000000") {
+		t.Errorf("expected backup at midnight, got %s", backups[0])
+	}
+	checkFile(t, backups[0], "one\ntwo\n")
+}
+
+func TestFileWriterCompress(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app.log")
+	writer, err := dlog_file.NewWriter(path, dlog_file.Options{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, writer, "one\n")
+	if err := writer.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, writer, "two\n")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	backups := testBackups(t, path)
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], ".gz") {
+		t.Fatalf("expected 1 compressed backup, got %v", backups)
+	}
+	file, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\n" {
+		t.Errorf("expected %q, got %q", "one\n", string(data))
+	}
+	checkFile(t, path, "two\n")
+}
+
+func TestFileWriterReopenOnSIGHUP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not supported on windows")
+	}
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app.log")
+	writer, err := dlog_file.NewWriter(path, dlog_file.Options{ReopenOnSIGHUP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = writer.Close() }()
+	write(t, writer, "one\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; !exists(path); i++ {
+		if i == 100 {
+			t.Fatal("file was not reopened after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	write(t, writer, "two\n")
+	checkFile(t, path+".1", "one\n")
+	checkFile(t, path, "two\n")
+}
+
+func TestFileWriterMaxBackupsSameTime(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app.log")
+	clock := &testClock{now: time.Date(2017, 1, 1, 0, 0, 0, 0, time.Local)}
+	writer, err := dlog_file.NewWriter(path, dlog_file.Options{MaxBackups: 3, Now: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// backups with the same time get the suffixes -1 to -11
+	for i := 0; i < 12; i++ {
+		write(t, writer, strconv.Itoa(i)+"\n")
+		if err := writer.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	prefix := path + ".2017-01-01T00-00-00.000000000"
+	for suffix, expected := range map[string]string{"-9": "9\n", "-10": "10\n", "-11": "11\n"} {
+		checkFile(t, prefix+suffix, expected)
+	}
+	if backups := testBackups(t, path); len(backups) != 3 {
+		t.Errorf("expected 3 backups, got %v", backups)
+	}
+}
+
+func TestFileWriterReopenError(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "app.log")
+	writer, err := dlog_file.NewWriter(path, dlog_file.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = writer.Close() }()
+	write(t, writer, "one\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	// the path cannot be opened as a file
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Reopen(); err == nil {
+		t.Fatal("expected an error reopening a directory")
+	}
+	write(t, writer, "two\n")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, writer, "three\n")
+	checkFile(t, path+".1", "one\ntwo\n")
+	checkFile(t, path, "three\n")
+}
+
+func TestFileWriterRotateError(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log", "app.log")
+	clock := &testClock{now: time.Date(2017, 1, 1, 23, 30, 0, 0, time.Local)}
+	writer, err := dlog_file.NewWriter(path, dlog_file.Options{Interval: dlog_file.IntervalDaily, Now: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, writer, "one\n")
+	// the backups cannot be listed while the directory is moved
+	if err := os.Rename(filepath.Dir(path), filepath.Join(dir, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(30 * time.Minute)
+	if n, err := writer.Write([]byte("two\n")); n != 4 || err == nil {
+		t.Fatalf("expected the write to succeed with a rotation error, got %d %v", n, err)
+	}
+	// the rotation is retried at the next boundary
+	write(t, writer, "three\n")
+	if err := os.Rename(filepath.Join(dir, "moved"), filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(24 * time.Hour)
+	write(t, writer, "four\n")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, "four\n")
+	backups := testBackups(t, path)
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %v", backups)
+	}
+	checkFile(t, backups[0], "one\ntwo\nthree\n")
+}
+
+type messageEncoder struct{}
+
+func (e *messageEncoder) Encode(entry *dlog.Entry) ([]byte, error) {
+	return []byte(entry.Message), nil
+}
+
+type testClock struct {
+	now  time.Time
+	lock sync.Mutex
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func testTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func testBackups(t *testing.T, path string) []string {
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backups
+}
+
+func write(t *testing.T, writer *dlog_file.Writer, s string) {
+	if _, err := writer.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkFile(t *testing.T, path string, expected string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("%s: expected %q, got %q", path, expected, string(data))
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,226 @@
+package dlog_testing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/fluent"
+)
+
+func TestFluent(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	writer := newTestFluentWriter(t, dlog_fluent.Options{Network: "tcp", Address: listener.Addr().String(), RequireAck: true})
+	logger := dlog_fluent.NewLogger(writer).AtLevel(dlog.LevelInfo)
+	logger.WithField("count", 1).WithField("message", "dropped").Infoln("one")
+	logger.WithField("duration", time.Second).Warnln("two")
+	forwardC := make(chan *testForward, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		forward, err := readTestForward(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		if err := msgpack.NewEncoder(conn).Encode(map[string]string{"ack": forward.chunk}); err != nil {
+			return
+		}
+		forwardC <- forward
+	}()
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var forward *testForward
+	select {
+	case forward = <-forwardC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	if forward.tag != "app" || forward.size != 2 || forward.chunk == "" || len(forward.records) != 2 {
+		t.Fatalf("unexpected forward: %+v", forward)
+	}
+	for i, expected := range []map[string]interface{}{
+		{"message": "one", "level": "INFO", "count": int64(1)},
+		{"message": "two", "level": "WARN", "duration": "1s"},
+	} {
+		record := forward.records[i]
+		if len(record) != len(expected) {
+			t.Errorf("expected %v, got %v", expected, record)
+		}
+		for key, value := range expected {
+			if record[key] != value {
+				t.Errorf("%s: expected %v, got %v", key, value, record[key])
+			}
+		}
+		if since := time.Since(forward.times[i]); since < 0 || since > time.Minute {
+			t.Errorf("unexpected time: %v", forward.times[i])
+		}
+	}
+}
+
+func TestFluentRetry(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	writer := newTestFluentWriter(t, dlog_fluent.Options{Network: "tcp", Address: listener.Addr().String(), RequireAck: true})
+	defer func() { _ = writer.Close() }()
+	dlog_fluent.NewLogger(writer).Infoln("hello")
+	chunkC := make(chan string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			forward, err := readTestForward(bufio.NewReader(conn))
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+			chunkC <- forward.chunk
+			// the first batch is not acknowledged
+			if i == 1 {
+				_ = msgpack.NewEncoder(conn).Encode(map[string]string{"ack": forward.chunk})
+			}
+			_ = conn.Close()
+		}
+	}()
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if first, second := <-chunkC, <-chunkC; first != second {
+		t.Errorf("expected the same chunk to be resent, got %s and %s", first, second)
+	}
+}
+
+func TestFluentBufferFull(t *testing.T) {
+	writer := newTestFluentWriter(t, dlog_fluent.Options{Network: "tcp", Address: "127.0.0.1:0", BufferLimit: 1})
+	defer func() { _ = writer.Close() }()
+	if err := writer.Handle(&dlog.Entry{Message: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Handle(&dlog.Entry{Message: "two"}); err != dlog_fluent.ErrBufferFull {
+		t.Errorf("expected ErrBufferFull, got %v", err)
+	}
+}
+
+func TestFluentUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on windows")
+	}
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "fluent.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	forwardC := make(chan *testForward, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		if forward, err := readTestForward(bufio.NewReader(conn)); err == nil {
+			forwardC <- forward
+		}
+	}()
+	writer := newTestFluentWriter(t, dlog_fluent.Options{Network: "unix", Address: path, BatchSize: 1})
+	defer func() { _ = writer.Close() }()
+	dlog_fluent.NewLogger(writer).Errorln("hello")
+	select {
+	case forward := <-forwardC:
+		if forward.chunk != "" || len(forward.records) != 1 || forward.records[0]["message"] != "hello" {
+			t.Errorf("unexpected forward: %+v", forward)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not sent after BatchSize entries")
+	}
+}
+
+type testForward struct {
+	tag     string
+	size    int
+	chunk   string
+	times   []time.Time
+	records []map[string]interface{}
+}
+
+func newTestFluentWriter(t *testing.T, options dlog_fluent.Options) *dlog_fluent.Writer {
+	options.Tag = "app"
+	options.FlushInterval = time.Hour
+	options.Timeout = 5 * time.Second
+	options.MinBackoff = time.Millisecond
+	options.MaxRetries = 2
+	writer, err := dlog_fluent.NewWriter(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
+
+// readTestForward reads a PackedForward message.
+func readTestForward(reader *bufio.Reader) (*testForward, error) {
+	decoder := msgpack.NewDecoder(reader)
+	if _, err := decoder.DecodeArrayLen(); err != nil {
+		return nil, err
+	}
+	forward := &testForward{}
+	var err error
+	if forward.tag, err = decoder.DecodeString(); err != nil {
+		return nil, err
+	}
+	entries, err := decoder.DecodeBytes()
+	if err != nil {
+		return nil, err
+	}
+	option := make(map[string]interface{})
+	if err := decoder.Decode(&option); err != nil {
+		return nil, err
+	}
+	size, _ := option["size"].(int64)
+	forward.size = int(size)
+	forward.chunk, _ = option["chunk"].(string)
+	entriesReader := bytes.NewReader(entries)
+	entriesDecoder := msgpack.NewDecoder(entriesReader)
+	for entriesReader.Len() > 0 {
+		if _, err := entriesDecoder.DecodeArrayLen(); err != nil {
+			return nil, err
+		}
+		// the EventTime is fixext8 with type 0, which is read directly
+		eventTime := make([]byte, 10)
+		if _, err := io.ReadFull(entriesReader, eventTime); err != nil {
+			return nil, err
+		}
+		forward.times = append(
+			forward.times,
+			time.Unix(int64(binary.BigEndian.Uint32(eventTime[2:])), int64(binary.BigEndian.Uint32(eventTime[6:]))),
+		)
+		record := make(map[string]interface{})
+		if err := entriesDecoder.Decode(&record); err != nil {
+			return nil, err
+		}
+		forward.records = append(forward.records, record)
+	}
+	return forward, nil
+}
@@ -0,0 +1,206 @@
+package dlog_testing
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/gelf"
+)
+
+func TestGELFUDPGzip(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	writer := newTestGELFWriter(t, dlog_gelf.Options{Network: "udp", Address: conn.LocalAddr().String()})
+	defer func() { _ = writer.Close() }()
+	if err := writer.Handle(
+		&dlog.Entry{
+			Time:    time.Unix(1483326245, 6000000),
+			Level:   dlog.LevelError,
+			Message: "hello",
+			File:    "main.go",
+			Line:    10,
+			Fields: map[string]interface{}{
+				"count":        1,
+				"key with.dot": "value",
+				"id":           "dropped",
+				"stack":        "goroutine 1\nmain.main()",
+				"file":         "upload.txt",
+				"line":         3,
+			},
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	message := decodeGELF(t, readGzip(t, []byte(readPacket(t, conn))))
+	checkGELFMessage(
+		t,
+		message,
+		map[string]interface{}{
+			"version":       "1.1",
+			"host":          "host",
+			"short_message": "hello",
+			"full_message":  "goroutine 1\nmain.main()",
+			"timestamp":     1483326245.006,
+			"level":         float64(3),
+			"_count":        float64(1),
+			"_key_with.dot": "value",
+			"_file":         "main.go",
+			"_line":         float64(10),
+			"_field_file":   "upload.txt",
+			"_field_line":   float64(3),
+		},
+	)
+}
+
+func TestGELFUDPChunkedZlib(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	writer := newTestGELFWriter(
+		t,
+		dlog_gelf.Options{
+			Network:     "udp",
+			Address:     conn.LocalAddr().String(),
+			Compression: dlog_gelf.CompressionZlib,
+			ChunkSize:   100,
+		},
+	)
+	defer func() { _ = writer.Close() }()
+	// enough fields that the compressed message needs multiple chunks
+	fields := make(map[string]interface{})
+	for i := 0; i < 50; i++ {
+		fields[string(rune('a'+i%26))+strings.Repeat("x", i)] = time.Duration(i*7919) * time.Microsecond
+	}
+	dlog_gelf.NewLogger(writer).WithFields(fields).Warnln("first\nsecond")
+	var id []byte
+	var chunks [][]byte
+	for {
+		packet := []byte(readPacket(t, conn))
+		if len(packet) > 100 || !bytes.HasPrefix(packet, []byte{0x1e, 0x0f}) {
+			t.Fatalf("unexpected chunk: %q", packet)
+		}
+		if id == nil {
+			id = packet[2:10]
+			chunks = make([][]byte, packet[11])
+		}
+		if !bytes.Equal(id, packet[2:10]) {
+			t.Fatalf("unexpected message id: %v", packet[2:10])
+		}
+		chunks[packet[10]] = packet[12:]
+		if len(chunks) < 2 {
+			t.Fatalf("expected multiple chunks, got %d", len(chunks))
+		}
+		if packet[10] == byte(len(chunks)-1) {
+			break
+		}
+	}
+	zlibReader, err := zlib.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zlibReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := decodeGELF(t, data)
+	checkGELFMessage(
+		t,
+		message,
+		map[string]interface{}{
+			"short_message": "first",
+			"full_message":  "first\nsecond",
+			"level":         float64(4),
+			"_a":            "0s",
+			"_bx":           "7.919ms",
+		},
+	)
+	if !strings.HasSuffix(message["_file"].(string), "gelf_test.go") {
+		t.Errorf("unexpected _file: %v", message["_file"])
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	writer := newTestGELFWriter(t, dlog_gelf.Options{Network: "tcp", Address: listener.Addr().String()})
+	defer func() { _ = writer.Close() }()
+	logger := dlog_gelf.NewLogger(writer)
+	logger.Infoln("one")
+	logger.Infoln("two")
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"one", "two"} {
+		data, err := reader.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGELFMessage(
+			t,
+			decodeGELF(t, bytes.TrimSuffix(data, []byte{0})),
+			map[string]interface{}{"short_message": expected, "level": float64(6)},
+		)
+	}
+}
+
+func newTestGELFWriter(t *testing.T, options dlog_gelf.Options) *dlog_gelf.Writer {
+	options.Host = "host"
+	options.Timeout = 5 * time.Second
+	writer, err := dlog_gelf.NewWriter(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
+
+func readGzip(t *testing.T, data []byte) []byte {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadAll(gzipReader)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func decodeGELF(t *testing.T, data []byte) map[string]interface{} {
+	message := make(map[string]interface{})
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func checkGELFMessage(t *testing.T, message map[string]interface{}, expected map[string]interface{}) {
+	for key, value := range expected {
+		if message[key] != value {
+			t.Errorf("%s: expected %v, got %v", key, value, message[key])
+		}
+	}
+	if _, ok := message["_id"]; ok {
+		t.Error("expected no _id")
+	}
+}
@@ -0,0 +1,29 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"testing"
+
+	gokitlog "github.com/go-kit/log"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/gokit"
+)
+
+func TestGokit(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	logger := dlog_gokit.NewLogger(gokitlog.NewLogfmtLogger(buffer)).WithField("service", "api")
+	infoLogger := logger.AtLevel(dlog.LevelInfo)
+	infoLogger.Debugln("dropped")
+	infoLogger.With(dlog.Int("count", 2)).Warnf("warning %d", 1)
+	logger.Logln(dlog.LevelTrace, "trace")
+	infoLogger.With(dlog.Err(errTest)).Errorln("failed")
+	if !logger.Enabled(dlog.LevelTrace) || infoLogger.Enabled(dlog.LevelDebug) || !infoLogger.Enabled(dlog.LevelWarn) {
+		t.Error("expected AtLevel to leave the parent level unchanged")
+	}
+	expected := "service=api count=2 level=warn msg=\"warning 1\"\n" +
+		"level=debug service=api msg=trace\n" +
+		"service=api error=\"test error\" level=error msg=failed\n"
+	if buffer.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buffer.String())
+	}
+}
@@ -0,0 +1,283 @@
+package dlog_testing
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/dloggrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCUnary(t *testing.T) {
+	serverHandler := &testEntryHandler{}
+	clientHandler := &testEntryHandler{}
+	clientConn, cleanup := newTestGRPCClient(t, serverHandler, clientHandler)
+	defer cleanup()
+	client := grpc_health_v1.NewHealthClient(clientConn)
+	ctx := dlog.NewRequestIDContext(context.Background(), "abc")
+	var header metadata.MD
+	if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "ok"}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if values := header.Get(dloggrpc.RequestIDMetadataKey); len(values) != 1 || values[0] != "abc" {
+		t.Errorf("expected the request ID header, got %v", header)
+	}
+	if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "internal"}); status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal, got %v", err)
+	}
+	entries := serverHandler.Entries()
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 server entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Fields[dlog.RequestIDKey] != "abc" || entry.Fields["method"] != "/grpc.health.v1.Health/Check" || entry.Fields["peer"] == nil {
+			t.Errorf("unexpected fields: %v", entry.Fields)
+		}
+	}
+	if entries[0].Message != "checking ok" {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+	checkGRPCEntry(t, entries[1], dloggrpc.ServerMessage, dlog.LevelInfo, codes.OK)
+	checkGRPCEntry(t, entries[2], dloggrpc.ServerMessage, dlog.LevelInfo, codes.NotFound)
+	checkGRPCEntry(t, entries[3], dloggrpc.ServerMessage, dlog.LevelError, codes.Internal)
+	entries = clientHandler.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 client entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Fields[dlog.RequestIDKey] != "abc" || entry.Fields["target"] != "passthrough:///bufnet" {
+			t.Errorf("unexpected fields: %v", entry.Fields)
+		}
+	}
+	checkGRPCEntry(t, entries[0], dloggrpc.ClientMessage, dlog.LevelInfo, codes.OK)
+	checkGRPCEntry(t, entries[2], dloggrpc.ClientMessage, dlog.LevelError, codes.Internal)
+}
+
+func TestGRPCStream(t *testing.T) {
+	serverHandler := &testEntryHandler{}
+	clientHandler := &testEntryHandler{}
+	clientConn, cleanup := newTestGRPCClient(t, serverHandler, clientHandler)
+	defer cleanup()
+	client := grpc_health_v1.NewHealthClient(clientConn)
+	// without a request ID in the context, the server creates one
+	stream, err := client.Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := header.Get(dloggrpc.RequestIDMetadataKey)
+	if len(values) != 1 || len(values[0]) != 32 {
+		t.Fatalf("expected a new request ID, got %v", header)
+	}
+	entries := serverHandler.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 server entries, got %d", len(entries))
+	}
+	if entries[0].Message != "watching ok" || entries[0].Fields[dlog.RequestIDKey] != values[0] {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+	checkGRPCEntry(t, entries[1], dloggrpc.ServerMessage, dlog.LevelInfo, codes.OK)
+	entries = clientHandler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 client entry, got %d", len(entries))
+	}
+	checkGRPCEntry(t, entries[0], dloggrpc.ClientMessage, dlog.LevelInfo, codes.OK)
+	if entries[0].Fields["method"] != "/grpc.health.v1.Health/Watch" {
+		t.Errorf("unexpected fields: %v", entries[0].Fields)
+	}
+}
+
+func TestGRPCStreamCancel(t *testing.T) {
+	clientHandler := &testEntryHandler{}
+	clientConn, cleanup := newTestGRPCClient(t, &testEntryHandler{}, clientHandler)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := grpc_health_v1.NewHealthClient(clientConn).Watch(ctx, &grpc_health_v1.HealthCheckRequest{Service: "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// the stream is abandoned without a final Recv
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); len(clientHandler.Entries()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the cancelled call to be logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	entries := clientHandler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 client entry, got %d", len(entries))
+	}
+	checkGRPCEntry(t, entries[0], dloggrpc.ClientMessage, dlog.LevelInfo, codes.Canceled)
+}
+
+func TestGRPCClientStream(t *testing.T) {
+	clientHandler := &testEntryHandler{}
+	clientConn, cleanup := newTestGRPCClient(t, &testEntryHandler{}, clientHandler)
+	defer cleanup()
+	stream, err := clientConn.NewStream(context.Background(), &testCountServiceDesc.Streams[0], "/dlog.testing.Count/Count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := stream.SendMsg(&grpc_health_v1.HealthCheckRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	// as with CloseAndRecv, the response is the last message
+	response := &grpc_health_v1.HealthCheckResponse{}
+	if err := stream.RecvMsg(response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != 3 {
+		t.Errorf("expected a count of 3, got %d", response.Status)
+	}
+	entries := clientHandler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 client entry, got %d", len(entries))
+	}
+	checkGRPCEntry(t, entries[0], dloggrpc.ClientMessage, dlog.LevelInfo, codes.OK)
+	if entries[0].Fields["method"] != "/dlog.testing.Count/Count" {
+		t.Errorf("unexpected fields: %v", entries[0].Fields)
+	}
+}
+
+func TestGRPCDefaultCodeToLevel(t *testing.T) {
+	for code, level := range map[codes.Code]dlog.Level{
+		codes.OK:               dlog.LevelInfo,
+		codes.NotFound:         dlog.LevelInfo,
+		codes.DeadlineExceeded: dlog.LevelWarn,
+		codes.Unavailable:      dlog.LevelWarn,
+		codes.Internal:         dlog.LevelError,
+		codes.Unknown:          dlog.LevelError,
+	} {
+		if actual := dloggrpc.DefaultCodeToLevel(code); actual != level {
+			t.Errorf("expected %v for %v, got %v", level, code, actual)
+		}
+	}
+}
+
+func checkGRPCEntry(t *testing.T, entry *dlog.Entry, message string, level dlog.Level, code codes.Code) {
+	if entry.Message != message || entry.Level != level || entry.Fields["code"] != code.String() {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if duration, ok := entry.Fields["duration"].(time.Duration); !ok || duration <= 0 {
+		t.Errorf("unexpected duration: %v", entry.Fields["duration"])
+	}
+	if (code == codes.OK) != (entry.Fields["error"] == nil) {
+		t.Errorf("unexpected error: %v", entry.Fields["error"])
+	}
+}
+
+func newTestGRPCClient(t *testing.T, serverHandler dlog.EntryHandler, clientHandler dlog.EntryHandler) (*grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1 << 20)
+	serverLogger := dlog.NewEntryLogger(serverHandler).AtLevel(dlog.LevelInfo)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(dloggrpc.UnaryServerInterceptor(serverLogger, dloggrpc.Options{})),
+		grpc.StreamInterceptor(dloggrpc.StreamServerInterceptor(serverLogger, dloggrpc.Options{})),
+	)
+	grpc_health_v1.RegisterHealthServer(server, &testHealthServer{})
+	server.RegisterService(&testCountServiceDesc, &testHealthServer{})
+	go func() { _ = server.Serve(listener) }()
+	clientLogger := dlog.NewEntryLogger(clientHandler).AtLevel(dlog.LevelInfo)
+	clientConn, err := grpc.Dial(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(
+			func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			},
+		),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(dloggrpc.UnaryClientInterceptor(clientLogger, dloggrpc.Options{})),
+		grpc.WithStreamInterceptor(dloggrpc.StreamClientInterceptor(clientLogger, dloggrpc.Options{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientConn, func() {
+		_ = clientConn.Close()
+		server.Stop()
+	}
+}
+
+type testHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (s *testHealthServer) Check(ctx context.Context, request *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	switch request.Service {
+	case "ok":
+		dlog.FromContext(ctx).Infoln("checking ok")
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+	case "internal":
+		return nil, status.Error(codes.Internal, "broken")
+	default:
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+}
+
+func (s *testHealthServer) Watch(request *grpc_health_v1.HealthCheckRequest, server grpc_health_v1.Health_WatchServer) error {
+	dlog.FromContext(server.Context()).Infof("watching %s", request.Service)
+	for i := 0; i < 2; i++ {
+		if err := server.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testCountServiceDesc has a client-streaming method, which the health service does not have.
+var testCountServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dlog.testing.Count",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Count",
+			Handler:       testCount,
+			ClientStreams: true,
+		},
+	},
+}
+
+// testCount responds with the number of requests as the status.
+func testCount(_ interface{}, stream grpc.ServerStream) error {
+	count := 0
+	for {
+		err := stream.RecvMsg(&grpc_health_v1.HealthCheckRequest{})
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		count++
+	}
+	return stream.SendMsg(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_ServingStatus(count)})
+}
@@ -0,0 +1,49 @@
+package dlog_testing
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.pedge.io/dlog"
+)
+
+func TestEntryLogger(t *testing.T) {
+	handler := &testEntryHandler{}
+	logger := dlog.NewEntryLogger(handler).AtLevel(dlog.LevelInfo)
+	logger.WithField("error", errors.New("foo")).WithField("lazy", dlog.Lazy(func() interface{} { return 1 })).Infoln("hello")
+	logger.Debugln("dropped")
+	entries := handler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Level != dlog.LevelInfo || entry.Message != "hello" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if entry.Fields["error"] != "foo" || entry.Fields["lazy"] != 1 {
+		t.Errorf("unexpected fields: %v", entry.Fields)
+	}
+	if filepath.Base(entry.File) != "handler_test.go" || entry.Line != 15 {
+		t.Errorf("expected caller handler_test.go:15, got %s:%d", entry.File, entry.Line)
+	}
+}
+
+type testEntryHandler struct {
+	entries []*dlog.Entry
+	lock    sync.Mutex
+}
+
+func (h *testEntryHandler) Handle(entry *dlog.Entry) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func (h *testEntryHandler) Entries() []*dlog.Entry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]*dlog.Entry(nil), h.entries...)
+}
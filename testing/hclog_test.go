@@ -0,0 +1,44 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/hclog"
+)
+
+func TestHclog(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	hclogLogger := hclog.New(&hclog.LoggerOptions{Output: buffer, Level: hclog.Info, IndependentLevels: true, DisableTime: true})
+	logger := dlog_hclog.NewLogger(hclogLogger)
+	traceLogger := logger.AtLevel(dlog.LevelTrace)
+	logger.Traceln("dropped")
+	traceLogger.WithField(dlog.ComponentKey, "db").WithField("query", "select 1").Logln(dlog.LevelTrace, "trace")
+	logger.With(dlog.Int("count", 2)).Warnf("warning %d", 1)
+	if logger.Enabled(dlog.LevelDebug) || !traceLogger.Enabled(dlog.LevelTrace) {
+		t.Error("expected AtLevel to leave the parent level unchanged")
+	}
+	expected := "[TRACE] db: trace: query=\"select 1\"\n[WARN]  warning 1: count=2\n"
+	if buffer.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buffer.String())
+	}
+}
+
+func TestHclogRegister(t *testing.T) {
+	defer dlog.Register()
+	dlog_hclog.Register()
+	errorLogger := dlog.With().AtLevel(dlog.LevelError)
+	if errorLogger.Enabled(dlog.LevelInfo) || !dlog.Enabled(dlog.LevelInfo) {
+		t.Error("expected AtLevel to leave the level of the global Logger unchanged")
+	}
+	logger, err := (&dlog.Config{Backend: "hclog", Level: "info"}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorLogger = logger.AtLevel(dlog.LevelError)
+	if errorLogger.Enabled(dlog.LevelInfo) || !logger.Enabled(dlog.LevelInfo) {
+		t.Error("expected AtLevel to leave the level of the backend Logger unchanged")
+	}
+}
@@ -0,0 +1,287 @@
+package dlog_testing
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/dloghttp"
+)
+
+func TestMiddleware(t *testing.T) {
+	handler := &testEntryHandler{}
+	server := newTestMiddlewareServer(
+		handler,
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				dlog.FromContext(request.Context()).Infoln("handling")
+				if requestID := dlog.RequestIDFromContext(request.Context()); requestID != "abc" {
+					t.Errorf("unexpected request ID in context: %s", requestID)
+				}
+				responseWriter.WriteHeader(http.StatusCreated)
+				_, _ = fmt.Fprint(responseWriter, "hello")
+			},
+		),
+	)
+	defer server.Close()
+	request, err := http.NewRequest("POST", server.URL+"/things?secret=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set(dloghttp.RequestIDHeader, "abc")
+	response := doTestRequest(t, request)
+	if response.StatusCode != http.StatusCreated || response.Header.Get(dloghttp.RequestIDHeader) != "abc" {
+		t.Errorf("unexpected response: %d %v", response.StatusCode, response.Header)
+	}
+	entries := handler.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Fields[dlog.RequestIDKey] != "abc" || entry.Fields["method"] != "POST" || entry.Fields["path"] != "/things" || entry.Fields["remote"] == "" {
+			t.Errorf("unexpected fields: %v", entry.Fields)
+		}
+	}
+	if entries[0].Message != "handling" {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+	access := entries[1]
+	if access.Message != dloghttp.AccessMessage || access.Level != dlog.LevelInfo {
+		t.Errorf("unexpected access entry: %+v", access)
+	}
+	if access.Fields["status"] != int64(http.StatusCreated) || access.Fields["bytes"] != int64(5) {
+		t.Errorf("unexpected access fields: %v", access.Fields)
+	}
+	if duration, ok := access.Fields["duration"].(time.Duration); !ok || duration <= 0 {
+		t.Errorf("unexpected duration: %v", access.Fields["duration"])
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	handler := &testEntryHandler{}
+	server := newTestMiddlewareServer(handler, http.NotFoundHandler())
+	defer server.Close()
+	// the trace ID of a traceparent is the request ID
+	request, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set(dloghttp.TraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	response := doTestRequest(t, request)
+	if requestID := response.Header.Get(dloghttp.RequestIDHeader); requestID != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected the trace ID as request ID, got %s", requestID)
+	}
+	// invalid request IDs are replaced
+	request.Header.Del(dloghttp.TraceparentHeader)
+	request.Header.Set(dloghttp.RequestIDHeader, "forged id")
+	response = doTestRequest(t, request)
+	if requestID := response.Header.Get(dloghttp.RequestIDHeader); len(requestID) != 32 {
+		t.Errorf("expected a new request ID, got %q", requestID)
+	}
+	entries := handler.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Fields[dloghttp.TraceIDKey] != "0af7651916cd43dd8448eb211c80319c" || entries[1].Fields[dloghttp.TraceIDKey] != nil {
+		t.Errorf("unexpected trace IDs: %v %v", entries[0].Fields, entries[1].Fields)
+	}
+	if entries[0].Fields["status"] != int64(http.StatusNotFound) || entries[0].Level != dlog.LevelInfo {
+		t.Errorf("unexpected access entry: %+v", entries[0])
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	handler := &testEntryHandler{}
+	server := newTestMiddlewareServer(
+		handler,
+		http.HandlerFunc(
+			func(http.ResponseWriter, *http.Request) {
+				panic("boom")
+			},
+		),
+	)
+	defer server.Close()
+	request, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := doTestRequest(t, request); response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", response.StatusCode)
+	}
+	entries := handler.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Level != dlog.LevelError || entries[0].Message != "panic: boom" || entries[0].Fields["stack"] == nil {
+		t.Errorf("unexpected panic entry: %+v", entries[0])
+	}
+	if entries[1].Level != dlog.LevelError || entries[1].Fields["status"] != int64(http.StatusInternalServerError) {
+		t.Errorf("unexpected access entry: %+v", entries[1])
+	}
+}
+
+func newTestMiddlewareServer(entryHandler dlog.EntryHandler, handler http.Handler) *httptest.Server {
+	logger := dlog.NewEntryLogger(entryHandler).AtLevel(dlog.LevelInfo)
+	return httptest.NewServer(dloghttp.Middleware(logger, dloghttp.MiddlewareOptions{})(handler))
+}
+
+func doTestRequest(t *testing.T, request *http.Request) *http.Response {
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	return response
+}
+
+func TestTransport(t *testing.T) {
+	headerC := make(chan http.Header, 1)
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				headerC <- request.Header
+				body, _ := ioutil.ReadAll(request.Body)
+				_, _ = fmt.Fprintf(responseWriter, "echo %s", body)
+			},
+		),
+	)
+	defer server.Close()
+	handler := &testEntryHandler{}
+	client := &http.Client{
+		Transport: &dloghttp.Transport{
+			Logger:      dlog.NewEntryLogger(handler).AtLevel(dlog.LevelDebug),
+			QueryParams: []string{"page"},
+			MaxBodySize: 8,
+		},
+	}
+	ctx := dloghttp.NewAttemptContext(dlog.NewRequestIDContext(context.Background(), "abc"), 2)
+	request, err := http.NewRequest("POST", server.URL+"/things?token=secret&page=2", strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "echo hello world" {
+		t.Errorf("expected the whole body after dumping, got %s", body)
+	}
+	if header := <-headerC; header.Get(dloghttp.RequestIDHeader) != "abc" {
+		t.Errorf("expected the request ID to be propagated, got %v", header)
+	}
+	if request.Header.Get(dloghttp.RequestIDHeader) != "" {
+		t.Error("expected the request not to be modified")
+	}
+	entries := handler.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.Fields["url"] != server.URL+"/things?page=2&token="+dloghttp.Redacted || entry.Fields["attempt"] != int64(2) || entry.Fields[dlog.RequestIDKey] != "abc" {
+			t.Errorf("unexpected fields: %v", entry.Fields)
+		}
+	}
+	if entries[0].Message != dloghttp.RequestBodyMessage || entries[0].Fields["body"] != "hello wo" || entries[0].Fields["truncated"] != true {
+		t.Errorf("unexpected request body entry: %+v", entries[0])
+	}
+	if entries[1].Message != dloghttp.ClientMessage || entries[1].Level != dlog.LevelInfo || entries[1].Fields["status"] != int64(http.StatusOK) {
+		t.Errorf("unexpected response entry: %+v", entries[1])
+	}
+	if entries[2].Message != dloghttp.ResponseBodyMessage || entries[2].Fields["body"] != "echo hel" {
+		t.Errorf("unexpected response body entry: %+v", entries[2])
+	}
+}
+
+func TestTransportStreaming(t *testing.T) {
+	releaseC := make(chan struct{})
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				_, _ = io.WriteString(responseWriter, "first\n")
+				responseWriter.(http.Flusher).Flush()
+				<-releaseC
+				_, _ = io.WriteString(responseWriter, "second\n")
+			},
+		),
+	)
+	defer server.Close()
+	handler := &testEntryHandler{}
+	client := &http.Client{
+		Transport: &dloghttp.Transport{
+			Logger:      dlog.NewEntryLogger(handler).AtLevel(dlog.LevelDebug),
+			MaxBodySize: 1024,
+		},
+	}
+	responseC := make(chan *http.Response, 1)
+	errC := make(chan error, 1)
+	go func() {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			errC <- err
+			return
+		}
+		responseC <- response
+	}()
+	var response *http.Response
+	select {
+	case response = <-responseC:
+	case err := <-errC:
+		close(releaseC)
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		close(releaseC)
+		t.Fatal("expected the response before the whole body was sent")
+	}
+	reader := bufio.NewReader(response.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "first\n" {
+		close(releaseC)
+		t.Fatalf("expected the first line, got %q %v", line, err)
+	}
+	if entries := handler.Entries(); len(entries) != 1 {
+		close(releaseC)
+		t.Fatalf("expected the body not to be logged before it was read, got %d entries", len(entries))
+	}
+	close(releaseC)
+	if _, err := ioutil.ReadAll(reader); err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	entries := handler.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[1].Message != dloghttp.ResponseBodyMessage || entries[1].Fields["body"] != "first\nsecond\n" || entries[1].Fields["truncated"] != false {
+		t.Errorf("unexpected response body entry: %+v", entries[1])
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	handler := &testEntryHandler{}
+	client := &http.Client{Transport: &dloghttp.Transport{Logger: dlog.NewEntryLogger(handler), MaxBodySize: 8}}
+	if _, err := client.Get(server.URL + "/?password=secret"); err == nil {
+		t.Fatal("expected error")
+	}
+	entries := handler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Level != dlog.LevelError || entry.Fields["error"] == nil || entry.Fields["url"] != server.URL+"/?password="+dloghttp.Redacted {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
@@ -0,0 +1,151 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/journald"
+)
+
+func TestJournald(t *testing.T) {
+	conn, writer, cleanup := newTestJournald(t)
+	defer cleanup()
+	dlog_journald.NewLogger(writer).
+		WithField("request_id", 1234).
+		WithField("multi line", "a\nb").
+		WithField("_hidden", "x").
+		WithField("message", "dropped").
+		Warnln("hello")
+	fields := readJournaldFields(t, conn)
+	for name, expected := range map[string]string{
+		"MESSAGE":           "hello",
+		"PRIORITY":          "4",
+		"CODE_FILE":         "journald_linux_test.go",
+		"SYSLOG_IDENTIFIER": "app",
+		"REQUEST_ID":        "1234",
+		"MULTI_LINE":        "a\nb",
+		"HIDDEN":            "x",
+	} {
+		value := fields[name]
+		if name == "CODE_FILE" {
+			value = filepath.Base(value)
+		}
+		if value != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, value)
+		}
+	}
+	if fields["CODE_LINE"] == "" {
+		t.Error("expected CODE_LINE")
+	}
+}
+
+func TestJournaldLargeEntry(t *testing.T) {
+	conn, writer, cleanup := newTestJournald(t)
+	defer cleanup()
+	message := strings.Repeat("a", 1<<21)
+	dlog_journald.NewLogger(writer).Infoln(message)
+	fields := readJournaldFields(t, conn)
+	if fields["MESSAGE"] != message {
+		t.Errorf("expected message of length %d, got length %d", len(message), len(fields["MESSAGE"]))
+	}
+	if fields["PRIORITY"] != "6" {
+		t.Errorf("expected PRIORITY 6, got %q", fields["PRIORITY"])
+	}
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"foo":                    "FOO",
+		"foo.bar-baz":            "FOO_BAR_BAZ",
+		"__foo":                  "FOO",
+		"1foo":                   "X_1FOO",
+		"":                       "X_",
+		strings.Repeat("a", 100): strings.Repeat("A", 64),
+	} {
+		if name := dlog_journald.FieldName(key); name != expected {
+			t.Errorf("%q: expected %q, got %q", key, expected, name)
+		}
+	}
+}
+
+func newTestJournald(t *testing.T) (*net.UnixConn, *dlog_journald.Writer, func()) {
+	dir := testTempDir(t)
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	writer, err := dlog_journald.NewWriter(dlog_journald.Options{SocketPath: path, Identifier: "app"})
+	if err != nil {
+		_ = conn.Close()
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return conn, writer, func() {
+		_ = writer.Close()
+		_ = conn.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// readJournaldFields reads a datagram like journald, reading the
+// entry from the passed file descriptor if the datagram is empty.
+func readJournaldFields(t *testing.T, conn *net.UnixConn) map[string]string {
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1<<16)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(data, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = data[:n]
+	if oobn > 0 {
+		messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&messages[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := os.NewFile(uintptr(fds[0]), "journald")
+		defer func() { _ = file.Close() }()
+		if _, err := file.Seek(0, 0); err != nil {
+			t.Fatal(err)
+		}
+		if data, err = ioutil.ReadAll(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			t.Fatalf("unterminated field: %q", data)
+		}
+		line := data[:i]
+		data = data[i+1:]
+		if j := bytes.IndexByte(line, '='); j >= 0 {
+			fields[string(line[:j])] = string(line[j+1:])
+			continue
+		}
+		length := int(binary.LittleEndian.Uint64(data[:8]))
+		fields[string(line)] = string(data[8 : 8+length])
+		data = data[8+length+1:]
+	}
+	return fields
+}
+
+var _ dlog.EntryHandler = &dlog_journald.Writer{}
@@ -0,0 +1,99 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/klog"
+	"k8s.io/klog/v2"
+)
+
+func TestKlog(t *testing.T) {
+	buffer := setTestKlogFlags(t, "4", true)
+	logger := dlog_klog.NewLogger().WithField("pod", "web")
+	logger.Debugln("debug")
+	logger.Traceln("dropped")
+	logger.WithField("count", 2).Warnln("warning")
+	logger.With(dlog.Err(errTest)).Errorln("failed")
+	klog.Flush()
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	expected := []string{
+		`"debug" pod="web"`,
+		`"warning" count=2 pod="web"`,
+		`"failed" err="test error" pod="web"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d: %s", len(expected), len(lines), buffer.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Errorf("expected %s, got %s", expected[i], line)
+		}
+	}
+}
+
+func TestKlogVerbosity(t *testing.T) {
+	buffer := setTestKlogFlags(t, "5", true)
+	logger := dlog_klog.NewLogger()
+	if !logger.Enabled(dlog.LevelTrace) {
+		t.Error("expected trace to be enabled at verbosity 5")
+	}
+	logger.Tracef("trace %d", 1)
+	klog.Flush()
+	if !strings.HasSuffix(strings.TrimSpace(buffer.String()), `"trace 1"`) {
+		t.Errorf("expected trace, got %q", buffer.String())
+	}
+	setTestKlogFlags(t, "0", true)
+	if logger.Enabled(dlog.LevelDebug) || !logger.Enabled(dlog.LevelInfo) {
+		t.Error("expected debug to be disabled and info to be enabled at verbosity 0")
+	}
+}
+
+func TestKlogCaller(t *testing.T) {
+	buffer := setTestKlogFlags(t, "4", false)
+	logger := dlog_klog.NewLogger()
+	logger.Infof("info")
+	logger.Debugln("debug")
+	logger.Warnln("warning")
+	logger.Errorln("failed")
+	klog.Flush()
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d: %s", len(lines), buffer.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, " klog_test.go:") {
+			t.Errorf("expected the caller in the header, got %s", line)
+		}
+	}
+}
+
+// setTestKlogFlags sets the klog flags for the test and returns the klog output.
+func setTestKlogFlags(t *testing.T, verbosity string, skipHeaders bool) *bytes.Buffer {
+	flagSet := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flagSet)
+	for key, value := range map[string]string{
+		"logtostderr":  "false",
+		"one_output":   "true",
+		"skip_headers": strconv.FormatBool(skipHeaders),
+		"v":            verbosity,
+	} {
+		if err := flagSet.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buffer := bytes.NewBuffer(nil)
+	klog.SetOutput(buffer)
+	t.Cleanup(func() {
+		klog.SetOutput(os.Stderr)
+		for key, value := range map[string]string{"logtostderr": "true", "one_output": "false", "skip_headers": "false", "v": "0"} {
+			_ = flagSet.Set(key, value)
+		}
+	})
+	return buffer
+}
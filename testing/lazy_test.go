@@ -0,0 +1,107 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	apexlog "github.com/apex/log"
+	"github.com/apex/log/handlers/logfmt"
+	gokitlog "github.com/go-kit/log"
+	"github.com/hashicorp/go-hclog"
+	"github.com/rs/zerolog"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/apex"
+	"go.pedge.io/dlog/gokit"
+	"go.pedge.io/dlog/hclog"
+	"go.pedge.io/dlog/logrus"
+	"go.pedge.io/dlog/zap"
+	"go.pedge.io/dlog/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLazy(t *testing.T) {
+	var values []string
+	printFunc := func(args ...interface{}) { values = append(values, fmt.Sprint(args...)) }
+	testLazy(t, dlog.NewLogger(printFunc, nil).AtLevel(dlog.LevelInfo), func() string { return strings.Join(values, "\n") })
+}
+
+func TestLazyLogrus(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	logrusLogger := logrus.New()
+	logrusLogger.Out = buffer
+	logrusLogger.Formatter = &logrus.JSONFormatter{}
+	testLazy(t, dlog_logrus.NewLogger(logrusLogger).AtLevel(dlog.LevelInfo), buffer.String)
+}
+
+func TestLazyZap(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	zapLogger := zap.New(
+		zapcore.NewCore(
+			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+			zapcore.AddSync(buffer),
+			zapcore.InfoLevel,
+		),
+	)
+	testLazy(t, dlog_zap.NewLogger(zapLogger.Sugar()), buffer.String)
+}
+
+func TestLazyHclog(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	hclogLogger := hclog.New(&hclog.LoggerOptions{Output: buffer, JSONFormat: true, Level: hclog.Info})
+	testLazy(t, dlog_hclog.NewLogger(hclogLogger), buffer.String)
+}
+
+func TestLazyZerolog(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	testLazy(t, dlog_zerolog.NewLogger(zerolog.New(buffer)).AtLevel(dlog.LevelInfo), buffer.String)
+}
+
+func TestLazyGokit(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	testLazy(t, dlog_gokit.NewLogger(gokitlog.NewJSONLogger(buffer)).AtLevel(dlog.LevelInfo), buffer.String)
+}
+
+func TestLazyApex(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	testLazy(t, dlog_apex.NewLogger(&apexlog.Logger{Handler: logfmt.New(buffer), Level: apexlog.InfoLevel}), buffer.String)
+}
+
+func testLazy(t *testing.T, logger dlog.Logger, output func() string) {
+	calls := 0
+	logger = logger.WithField("lazy", dlog.Lazy(func() interface{} {
+		calls++
+		return "evaluated"
+	}))
+	if logger.Enabled(dlog.LevelDebug) {
+		t.Error("expected debug to be disabled")
+	}
+	if !logger.Enabled(dlog.LevelWarn) {
+		t.Error("expected warn to be enabled")
+	}
+	logger.Debugln("dropped")
+	if calls != 0 {
+		t.Errorf("expected no calls, got %d", calls)
+	}
+	logger.Infoln("logged")
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+	s := output()
+	if !strings.Contains(s, "evaluated") || strings.Contains(s, "dropped") {
+		t.Errorf("unexpected output: %s", s)
+	}
+	if strings.Contains(s, "{") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["lazy"] != "evaluated" {
+			t.Errorf("unexpected entry: %v", entry)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package dlog_testing
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"testing"
+
+	"go.pedge.io/dlog"
+)
+
+var (
+	testLevelNotice = dlog.MustRegisterLevel("notice", 35)
+)
+
+func TestNameToLevel(t *testing.T) {
+	for name, expected := range map[string]dlog.Level{
+		"DEBUG":   dlog.LevelDebug,
+		"info":    dlog.LevelInfo,
+		"Warning": dlog.LevelWarn,
+		"err":     dlog.LevelError,
+		"crit":    dlog.LevelFatal,
+		"6":       dlog.LevelPanic,
+	} {
+		level, err := dlog.NameToLevel(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if level != expected {
+			t.Errorf("%s: expected %v, got %v", name, expected, level)
+		}
+	}
+	for _, name := range []string{"loud", "42", ""} {
+		_, err := dlog.NameToLevel(name)
+		if _, ok := err.(*dlog.UnknownLevelError); !ok {
+			t.Errorf("%s: expected *dlog.UnknownLevelError, got %v", name, err)
+		}
+	}
+}
+
+func TestLevelJSON(t *testing.T) {
+	var value struct {
+		Level dlog.Level `json:"level"`
+	}
+	for _, data := range []string{`{"level":"warning"}`, `{"level":3}`} {
+		if err := json.Unmarshal([]byte(data), &value); err != nil {
+			t.Fatal(err)
+		}
+		if value.Level != dlog.LevelWarn {
+			t.Errorf("%s: expected WARN, got %v", data, value.Level)
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"level":"WARN"}` {
+		t.Errorf("unexpected JSON: %s", string(data))
+	}
+}
+
+func TestLevelFlagAndFormat(t *testing.T) {
+	level := dlog.LevelInfo
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.Var(&level, "level", "the log level")
+	if err := flagSet.Parse([]string{"-level", "error"}); err != nil {
+		t.Fatal(err)
+	}
+	if level != dlog.LevelError {
+		t.Errorf("expected ERROR, got %v", level)
+	}
+	if s := fmt.Sprintf("%v %d %q %-6s|", level, level, level, level); s != `ERROR 50 "ERROR" ERROR |` {
+		t.Errorf("unexpected format: %s", s)
+	}
+}
+
+func TestRegisterLevel(t *testing.T) {
+	if _, err := dlog.RegisterLevel("NOTICE", 36); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+	if _, err := dlog.RegisterLevel("OTHER", 35); err == nil {
+		t.Error("expected error for duplicate severity")
+	}
+	if _, err := dlog.RegisterLevel("OTHER", 3); err == nil {
+		t.Error("expected error for reserved severity")
+	}
+	for name, expected := range map[string]dlog.Level{"3": dlog.LevelWarn, "40": dlog.LevelWarn, "10": dlog.LevelTrace, "35": testLevelNotice} {
+		if level, err := dlog.NameToLevel(name); err != nil || level != expected {
+			t.Errorf("expected %v for %s, got %v %v", expected, name, level, err)
+		}
+	}
+	if s := fmt.Sprintf("%d %d %d", dlog.LevelTrace, dlog.LevelDebug, testLevelNotice); s != "10 20 35" {
+		t.Errorf("unexpected format: %s", s)
+	}
+	if level, err := dlog.NameToLevel("Notice"); err != nil || level != testLevelNotice {
+		t.Errorf("expected NOTICE, got %v %v", level, err)
+	}
+	if standardLevel := dlog.StandardLevel(testLevelNotice); standardLevel != dlog.LevelInfo {
+		t.Errorf("expected INFO, got %v", standardLevel)
+	}
+	var values []string
+	printFunc := func(args ...interface{}) { values = append(values, fmt.Sprint(args...)) }
+	logger := dlog.NewLogger(printFunc, nil).AtLevel(testLevelNotice)
+	logger.Infoln("dropped")
+	logger.Logln(testLevelNotice, "notice")
+	logger.Warnln("warn")
+	logger.AtLevel(dlog.LevelTrace).Traceln("trace")
+	if len(values) != 3 || values[0] != "notice" || values[1] != "warn" || values[2] != "trace" {
+		t.Errorf("unexpected values: %v", values)
+	}
+	if s := testLevelNotice.String(); s != "NOTICE" {
+		t.Errorf("expected NOTICE, got %s", s)
+	}
+}
@@ -0,0 +1,108 @@
+package dlog_testing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/logr"
+)
+
+func TestLogSink(t *testing.T) {
+	handler := &testEntryHandler{}
+	logrLogger := logr.New(dlog_logr.NewLogSink(dlog.NewEntryLogger(handler).AtLevel(dlog.LevelInfo)))
+	logrLogger = logrLogger.WithName("controller").WithName("reconciler").WithValues("kind", "Pod")
+	logrLogger.Info("reconciling", "name", "web", 1, "bad key", "missing")
+	logrLogger.V(1).Info("dropped")
+	logrLogger.Error(errors.New("boom"), "failed")
+	if logrLogger.V(1).Enabled() {
+		t.Error("expected V-level 1 to be disabled")
+	}
+	entries := handler.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Message != "reconciling" || entry.Level != dlog.LevelInfo {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if entry.Fields[dlog_logr.NameKey] != "controller/reconciler" || entry.Fields["kind"] != "Pod" || entry.Fields["name"] != "web" ||
+		entry.Fields["1"] != "bad key" || entry.Fields["missing"] != dlog_logr.NoValue {
+		t.Errorf("unexpected fields: %v", entry.Fields)
+	}
+	if filepath.Base(entry.File) != "logr_test.go" || entry.Line != 22 {
+		t.Errorf("expected caller logr_test.go:22, got %s:%d", entry.File, entry.Line)
+	}
+	entry = entries[1]
+	if entry.Message != "failed" || entry.Level != dlog.LevelError || entry.Fields["error"] == nil || entry.Fields["kind"] != "Pod" {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestLogrLogger(t *testing.T) {
+	var lines []string
+	logrLogger := funcr.New(
+		func(prefix string, args string) {
+			lines = append(lines, args)
+		},
+		funcr.Options{Verbosity: 1},
+	)
+	logger := dlog_logr.NewLogger(logrLogger)
+	if !logger.Enabled(dlog.LevelDebug) || logger.Enabled(dlog.LevelTrace) {
+		t.Error("expected the levels to be enabled by the verbosity of the logr.Logger")
+	}
+	logger.WithField("b", 2).WithField("a", "x").Infoln("hello")
+	logger.Debugln("debug")
+	logger.Traceln("dropped")
+	logger.With(dlog.Err(errors.New("boom"))).Errorln("failed")
+	expected := []string{
+		`"level"=0 "msg"="hello" "a"="x" "b"=2`,
+		`"level"=1 "msg"="debug"`,
+		`"msg"="failed" "error"="boom"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d: %v", len(expected), len(lines), lines)
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], line)
+		}
+	}
+}
+
+func TestLogrLoggerPanic(t *testing.T) {
+	var lines []string
+	logger := dlog_logr.NewLogger(funcr.New(func(prefix string, args string) { lines = append(lines, args) }, funcr.Options{}))
+	defer func() {
+		if recovered := recover(); recovered != "boom" {
+			t.Errorf("expected panic, got %v", recovered)
+		}
+		if len(lines) != 1 || lines[0] != `"msg"="boom" "error"=null` {
+			t.Errorf("unexpected lines: %v", lines)
+		}
+	}()
+	logger.Panicln("boom")
+}
+
+func TestLogrLoggerFatal(t *testing.T) {
+	if os.Getenv("DLOG_TEST_LOGR_FATAL") == "1" {
+		dlog_logr.NewLogger(funcr.New(func(prefix string, args string) { fmt.Println(args) }, funcr.Options{})).Fatalln("fatal")
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLogrLoggerFatal$")
+	cmd.Env = append(os.Environ(), "DLOG_TEST_LOGR_FATAL=1")
+	output, err := cmd.Output()
+	if exitError, ok := err.(*exec.ExitError); !ok || exitError.ExitCode() != 1 {
+		t.Fatalf("expected exit status 1, got %v", err)
+	}
+	if !strings.Contains(string(output), `"msg"="fatal"`) {
+		t.Errorf("expected the entry to be logged before exiting, got %s", output)
+	}
+}
@@ -0,0 +1,290 @@
+package dlog_testing
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/loki"
+)
+
+func TestLokiJSON(t *testing.T) {
+	server := newTestLokiServer(t, nil)
+	defer server.Close()
+	writer := newTestLokiWriter(t, server.URL, dlog_loki.EncodingJSON)
+	logger := dlog_loki.NewLogger(writer)
+	logger.WithField("component", "db").WithField("query", "select 1").Infoln("one")
+	logger.WithField("component", "http").Warnln("two")
+	logger.WithField("component", "db").Infoln("three")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	request := requests[0]
+	if request.contentType != "application/json" || request.tenantID != "tenant" {
+		t.Errorf("unexpected headers: %s %s", request.contentType, request.tenantID)
+	}
+	var body struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(request.body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Streams) != 2 {
+		t.Fatalf("expected 2 streams, got %+v", body.Streams)
+	}
+	checkLokiStream(
+		t,
+		body.Streams[0].Stream,
+		map[string]string{"app": "api", "component": "db", "level": "info"},
+		[]string{body.Streams[0].Values[0][1], body.Streams[0].Values[1][1]},
+		[]string{"level=info msg=one query=\"select 1\"", "level=info msg=three"},
+	)
+	checkLokiStream(
+		t,
+		body.Streams[1].Stream,
+		map[string]string{"app": "api", "component": "http", "level": "warn"},
+		[]string{body.Streams[1].Values[0][1]},
+		[]string{"level=warn msg=two"},
+	)
+}
+
+func TestLokiProtobuf(t *testing.T) {
+	server := newTestLokiServer(t, nil)
+	defer server.Close()
+	writer := newTestLokiWriter(t, server.URL, dlog_loki.EncodingProtobuf)
+	if err := writer.Handle(
+		&dlog.Entry{
+			Time:    time.Unix(1483326245, 6).UTC(),
+			Level:   dlog.LevelError,
+			Message: "hello",
+			Fields:  map[string]interface{}{"component": "db"},
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0].contentType != "application/x-protobuf" {
+		t.Errorf("unexpected content type: %s", requests[0].contentType)
+	}
+	data, err := snappy.Decode(nil, requests[0].body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := decodeTestProtobuf(t, data)[1]
+	if len(streams) != 1 {
+		t.Fatalf("expected 1 stream, got %d", len(streams))
+	}
+	stream := decodeTestProtobuf(t, streams[0])
+	if labels := string(stream[1][0]); labels != `{app="api", component="db", level="error"}` {
+		t.Errorf("unexpected labels: %s", labels)
+	}
+	if len(stream[2]) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(stream[2]))
+	}
+	entry := decodeTestProtobuf(t, stream[2][0])
+	timestamp := decodeTestProtobuf(t, entry[1][0])
+	seconds, _ := binary.Uvarint(timestamp[1][0])
+	nanos, _ := binary.Uvarint(timestamp[2][0])
+	if seconds != 1483326245 || nanos != 6 {
+		t.Errorf("unexpected timestamp: %d.%09d", seconds, nanos)
+	}
+	if line := string(entry[2][0]); line != "time=2017-01-02T03:04:05Z level=error msg=hello" {
+		t.Errorf("unexpected line: %s", line)
+	}
+}
+
+func TestLokiRetry(t *testing.T) {
+	statusCodes := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+	server := newTestLokiServer(t, statusCodes)
+	defer server.Close()
+	writer := newTestLokiWriter(t, server.URL, dlog_loki.EncodingJSON)
+	defer func() { _ = writer.Close() }()
+	dlog_loki.NewLogger(writer).Infoln("hello")
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if requests := server.Requests(); len(requests) != 3 {
+		t.Errorf("expected 3 requests, got %d", len(requests))
+	}
+}
+
+func TestLokiNoRetry(t *testing.T) {
+	server := newTestLokiServer(t, []int{http.StatusBadRequest})
+	defer server.Close()
+	writer := newTestLokiWriter(t, server.URL, dlog_loki.EncodingJSON)
+	defer func() { _ = writer.Close() }()
+	dlog_loki.NewLogger(writer).Infoln("hello")
+	err := writer.Flush()
+	pushError, ok := err.(*dlog_loki.PushError)
+	if !ok || pushError.StatusCode != http.StatusBadRequest || pushError.Body != "Bad Request" {
+		t.Fatalf("expected bad request PushError, got %v", err)
+	}
+	if requests := server.Requests(); len(requests) != 1 {
+		t.Errorf("expected 1 request, got %d", len(requests))
+	}
+}
+
+func TestLokiBufferFull(t *testing.T) {
+	receivedC := make(chan struct{}, 1)
+	releaseC := make(chan struct{})
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				receivedC <- struct{}{}
+				<-releaseC
+				responseWriter.WriteHeader(http.StatusNoContent)
+			},
+		),
+	)
+	defer server.Close()
+	writer, err := dlog_loki.NewWriter(
+		dlog_loki.Options{
+			URL:         server.URL,
+			BatchWait:   time.Hour,
+			BufferLimit: 2,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = writer.Close() }()
+	entry := &dlog.Entry{Time: time.Now(), Level: dlog.LevelInfo, Message: "hello"}
+	for i := 0; i < 2; i++ {
+		if err := writer.Handle(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Handle(entry); err != dlog_loki.ErrBufferFull {
+		t.Fatalf("expected ErrBufferFull, got %v", err)
+	}
+	errC := make(chan error, 1)
+	go func() { errC <- writer.Flush() }()
+	<-receivedC
+	// the batch being pushed still counts against the limit
+	if err := writer.Handle(entry); err != dlog_loki.ErrBufferFull {
+		t.Fatalf("expected ErrBufferFull while pushing, got %v", err)
+	}
+	close(releaseC)
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Handle(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testLokiServer struct {
+	*httptest.Server
+	statusCodes []int
+	requests    []*testLokiRequest
+	lock        sync.Mutex
+}
+
+type testLokiRequest struct {
+	contentType string
+	tenantID    string
+	body        []byte
+}
+
+// newTestLokiServer returns a new test server that responds with the
+// status codes in order, and then with 204.
+func newTestLokiServer(t *testing.T, statusCodes []int) *testLokiServer {
+	server := &testLokiServer{statusCodes: statusCodes}
+	server.Server = httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				if request.URL.Path != dlog_loki.PushPath {
+					http.NotFound(responseWriter, request)
+					return
+				}
+				body, err := ioutil.ReadAll(request.Body)
+				if err != nil {
+					http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				server.lock.Lock()
+				defer server.lock.Unlock()
+				server.requests = append(
+					server.requests,
+					&testLokiRequest{request.Header.Get("Content-Type"), request.Header.Get("X-Scope-OrgID"), body},
+				)
+				if len(server.statusCodes) == 0 {
+					responseWriter.WriteHeader(http.StatusNoContent)
+					return
+				}
+				statusCode := server.statusCodes[0]
+				server.statusCodes = server.statusCodes[1:]
+				http.Error(responseWriter, http.StatusText(statusCode), statusCode)
+			},
+		),
+	)
+	return server
+}
+
+func (s *testLokiServer) Requests() []*testLokiRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*testLokiRequest(nil), s.requests...)
+}
+
+func newTestLokiWriter(t *testing.T, url string, encoding dlog_loki.Encoding) *dlog_loki.Writer {
+	writer, err := dlog_loki.NewWriter(
+		dlog_loki.Options{
+			URL:        url,
+			Encoding:   encoding,
+			Labels:     map[string]string{"app": "api"},
+			LabelKeys:  []string{dlog_loki.LevelKey, "component"},
+			TenantID:   "tenant",
+			BatchWait:  time.Hour,
+			MinBackoff: time.Millisecond,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
+
+func checkLokiStream(t *testing.T, labels map[string]string, expectedLabels map[string]string, lines []string, expectedLines []string) {
+	if len(labels) != len(expectedLabels) {
+		t.Errorf("expected labels %v, got %v", expectedLabels, labels)
+	}
+	for key, value := range expectedLabels {
+		if labels[key] != value {
+			t.Errorf("%s: expected %s, got %s", key, value, labels[key])
+		}
+	}
+	if len(lines) != len(expectedLines) {
+		t.Fatalf("expected lines %v, got %v", expectedLines, lines)
+	}
+	for i, line := range lines {
+		// the time of Entries logged with a Logger is not known
+		if j := strings.IndexByte(line, ' '); strings.HasPrefix(line, "time=") && j >= 0 {
+			line = line[j+1:]
+		}
+		if line != expectedLines[i] {
+			t.Errorf("expected line %q, got %q", expectedLines[i], line)
+		}
+	}
+}
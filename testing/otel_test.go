@@ -0,0 +1,378 @@
+package dlog_testing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/otel"
+)
+
+var testOtelContextHookOnce sync.Once
+
+func TestOtelProtobuf(t *testing.T) {
+	server := newTestOtelServer(nil)
+	defer server.Close()
+	writer := newTestOtelWriter(t, server.URL, dlog_otel.EncodingProtobuf)
+	logger := dlog_otel.WithContext(newTestSpanContext(), dlog_otel.NewLogger(writer))
+	logger.WithField("count", 2).WithField("ok", true).Warnln("hello")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0].contentType != "application/x-protobuf" || requests[0].authorization != "Bearer token" {
+		t.Errorf("unexpected headers: %+v", requests[0])
+	}
+	resourceLogs := decodeTestProtobuf(t, decodeTestProtobuf(t, requests[0].body)[1][0])
+	resource := decodeTestProtobuf(t, resourceLogs[1][0])
+	serviceName := decodeTestProtobuf(t, resource[1][0])
+	if string(serviceName[1][0]) != "service.name" || string(decodeTestProtobuf(t, serviceName[2][0])[1][0]) != "api" {
+		t.Errorf("unexpected resource attribute: %q", serviceName)
+	}
+	scopeLogs := decodeTestProtobuf(t, resourceLogs[2][0])
+	if scope := decodeTestProtobuf(t, scopeLogs[1][0]); string(scope[1][0]) != dlog_otel.ScopeName {
+		t.Errorf("unexpected scope: %q", scope[1][0])
+	}
+	if len(scopeLogs[2]) != 1 {
+		t.Fatalf("expected 1 log record, got %d", len(scopeLogs[2]))
+	}
+	record := decodeTestProtobuf(t, scopeLogs[2][0])
+	if since := time.Since(time.Unix(0, int64(binary.LittleEndian.Uint64(record[1][0])))); since < 0 || since > time.Minute {
+		t.Errorf("unexpected time: %v", since)
+	}
+	if severityNumber, _ := binary.Uvarint(record[2][0]); severityNumber != 13 || string(record[3][0]) != "WARN" {
+		t.Errorf("unexpected severity: %d %s", severityNumber, record[3][0])
+	}
+	if body := decodeTestProtobuf(t, record[5][0]); string(body[1][0]) != "hello" {
+		t.Errorf("unexpected body: %q", body[1][0])
+	}
+	attributes := make(map[string]map[int][][]byte)
+	for _, attribute := range record[6] {
+		kv := decodeTestProtobuf(t, attribute)
+		attributes[string(kv[1][0])] = decodeTestProtobuf(t, kv[2][0])
+	}
+	if len(attributes) != 4 || attributes["code.filepath"] == nil || attributes["code.lineno"] == nil {
+		t.Errorf("unexpected attributes: %v", attributes)
+	}
+	if count, _ := binary.Uvarint(attributes["count"][3][0]); count != 2 {
+		t.Errorf("unexpected count: %d", count)
+	}
+	if ok, _ := binary.Uvarint(attributes["ok"][2][0]); ok != 1 {
+		t.Errorf("unexpected ok: %d", ok)
+	}
+	if flags := binary.LittleEndian.Uint32(record[8][0]); flags != 1 {
+		t.Errorf("unexpected flags: %d", flags)
+	}
+	if traceID := hex.EncodeToString(record[9][0]); traceID != "0102030405060708090a0b0c0d0e0f10" {
+		t.Errorf("unexpected trace ID: %s", traceID)
+	}
+	if spanID := hex.EncodeToString(record[10][0]); spanID != "0102030405060708" {
+		t.Errorf("unexpected span ID: %s", spanID)
+	}
+}
+
+func TestOtelJSON(t *testing.T) {
+	server := newTestOtelServer(nil)
+	defer server.Close()
+	writer := newTestOtelWriter(t, server.URL, dlog_otel.EncodingJSON)
+	logger := dlog_otel.WithContext(newTestSpanContext(), dlog_otel.NewLogger(writer))
+	logger.WithField("tags", []string{"a", "b"}).Errorln("hello")
+	// the fields are attributes if there is no span
+	dlog_otel.WithContext(context.Background(), dlog_otel.NewLogger(writer)).WithField(dlog_otel.SpanIDKey, "invalid").Infoln("world")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests) != 1 || requests[0].contentType != "application/json" {
+		t.Fatalf("unexpected requests: %+v", requests)
+	}
+	var body struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string `json:"timeUnixNano"`
+					SeverityNumber int    `json:"severityNumber"`
+					SeverityText   string `json:"severityText"`
+					Body           struct {
+						StringValue string `json:"stringValue"`
+					} `json:"body"`
+					Attributes []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+					TraceID string `json:"traceId"`
+					SpanID  string `json:"spanId"`
+					Flags   int    `json:"flags"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(requests[0].body, &body); err != nil {
+		t.Fatal(err)
+	}
+	records := body.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("expected 2 log records, got %d", len(records))
+	}
+	first := records[0]
+	if first.SeverityNumber != 17 || first.SeverityText != "ERROR" || first.Body.StringValue != "hello" || first.TimeUnixNano == "" {
+		t.Errorf("unexpected log record: %+v", first)
+	}
+	if first.TraceID != "0102030405060708090a0b0c0d0e0f10" || first.SpanID != "0102030405060708" || first.Flags != 1 {
+		t.Errorf("unexpected trace context: %+v", first)
+	}
+	var tags interface{}
+	for _, attribute := range first.Attributes {
+		if attribute.Key == "tags" {
+			tags = attribute.Value["arrayValue"]
+		}
+	}
+	if data, _ := json.Marshal(tags); string(data) != `{"values":[{"stringValue":"a"},{"stringValue":"b"}]}` {
+		t.Errorf("unexpected tags: %s", data)
+	}
+	second := records[1]
+	if second.SpanID != "" || second.SeverityNumber != 9 {
+		t.Errorf("unexpected log record: %+v", second)
+	}
+	var spanID interface{}
+	for _, attribute := range second.Attributes {
+		if attribute.Key == dlog_otel.SpanIDKey {
+			spanID = attribute.Value["stringValue"]
+		}
+	}
+	if spanID != "invalid" {
+		t.Errorf("expected the invalid span ID to be an attribute, got %v", second.Attributes)
+	}
+}
+
+func TestOtelRetry(t *testing.T) {
+	server := newTestOtelServer([]int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadRequest})
+	defer server.Close()
+	writer := newTestOtelWriter(t, server.URL, dlog_otel.EncodingProtobuf)
+	defer func() { _ = writer.Close() }()
+	dlog_otel.NewLogger(writer).Infoln("hello")
+	err := writer.Flush()
+	exportError, ok := err.(*dlog_otel.ExportError)
+	if !ok || exportError.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request ExportError, got %v", err)
+	}
+	if requests := server.Requests(); len(requests) != 3 {
+		t.Errorf("expected 3 requests, got %d", len(requests))
+	}
+}
+
+func TestOtelBufferFull(t *testing.T) {
+	server := newTestOtelServer(nil)
+	defer server.Close()
+	writer, err := dlog_otel.NewWriter(
+		dlog_otel.Options{
+			URL:           server.URL,
+			FlushInterval: time.Hour,
+			BufferLimit:   1,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = writer.Close() }()
+	entry := &dlog.Entry{Time: time.Now(), Level: dlog.LevelInfo, Message: "hello"}
+	if err := writer.Handle(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Handle(entry); err != dlog_otel.ErrBufferFull {
+		t.Fatalf("expected ErrBufferFull, got %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Handle(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOtelSeverityNumber(t *testing.T) {
+	for level, expected := range map[dlog.Level]int{
+		dlog.LevelNone:      0,
+		dlog.LevelTrace:     1,
+		dlog.LevelDebug:     5,
+		dlog.LevelInfo:      9,
+		dlog.LevelInfo + 5:  11,
+		dlog.LevelWarn:      13,
+		dlog.LevelError:     17,
+		dlog.LevelFatal:     21,
+		dlog.LevelPanic:     24,
+		dlog.LevelPanic + 5: 24,
+	} {
+		if severityNumber := dlog_otel.SeverityNumber(level); severityNumber != expected {
+			t.Errorf("%d: expected %d, got %d", level, expected, severityNumber)
+		}
+	}
+}
+
+func TestOtelContextHook(t *testing.T) {
+	testOtelContextHookOnce.Do(
+		func() {
+			dlog.RegisterContextHook(dlog_otel.NewContextHook(dlog_otel.ContextHookOptions{SpanEvents: true}))
+		},
+	)
+	span := &testSpan{Span: trace.SpanFromContext(newTestSpanContext())}
+	ctx := trace.ContextWithSpan(newTestSpanContext(), span)
+	handler := &testEntryHandler{}
+	logger := dlog.NewContextLogger(ctx, dlog.NewEntryLogger(handler))
+	logger.WithField("count", 2).Errorf("failed %d times", 3)
+	entries := handler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	fields := entries[0].Fields
+	if fields[dlog_otel.TraceIDKey] != "0102030405060708090a0b0c0d0e0f10" || fields[dlog_otel.SpanIDKey] != "0102030405060708" || fields[dlog_otel.TraceFlagsKey] != "01" {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+	events := span.Events()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 span event, got %d", len(events))
+	}
+	expected := map[string]string{
+		dlog_otel.SpanEventSeverityKey: "error",
+		dlog_otel.SpanEventMessageKey:  "failed 3 times",
+		"count":                        "2",
+	}
+	if events[0].name != dlog_otel.SpanEventName || len(events[0].attributes) != len(expected) {
+		t.Fatalf("unexpected span event: %+v", events[0])
+	}
+	for key, value := range expected {
+		if events[0].attributes[key] != value {
+			t.Errorf("%s: expected %s, got %s", key, value, events[0].attributes[key])
+		}
+	}
+}
+
+type testOtelServer struct {
+	*httptest.Server
+	statusCodes []int
+	requests    []*testOtelRequest
+	lock        sync.Mutex
+}
+
+type testOtelRequest struct {
+	contentType   string
+	authorization string
+	body          []byte
+}
+
+// newTestOtelServer returns a new test OTLP/HTTP receiver that responds
+// with the status codes in order, and then with 200.
+func newTestOtelServer(statusCodes []int) *testOtelServer {
+	server := &testOtelServer{statusCodes: statusCodes}
+	server.Server = httptest.NewServer(
+		http.HandlerFunc(
+			func(responseWriter http.ResponseWriter, request *http.Request) {
+				if request.URL.Path != dlog_otel.LogsPath {
+					http.NotFound(responseWriter, request)
+					return
+				}
+				body, err := ioutil.ReadAll(request.Body)
+				if err != nil {
+					http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				server.lock.Lock()
+				defer server.lock.Unlock()
+				server.requests = append(
+					server.requests,
+					&testOtelRequest{request.Header.Get("Content-Type"), request.Header.Get("Authorization"), body},
+				)
+				if len(server.statusCodes) == 0 {
+					// an empty ExportLogsServiceResponse
+					responseWriter.Header().Set("Content-Type", request.Header.Get("Content-Type"))
+					return
+				}
+				statusCode := server.statusCodes[0]
+				server.statusCodes = server.statusCodes[1:]
+				http.Error(responseWriter, http.StatusText(statusCode), statusCode)
+			},
+		),
+	)
+	return server
+}
+
+func (s *testOtelServer) Requests() []*testOtelRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*testOtelRequest(nil), s.requests...)
+}
+
+func newTestOtelWriter(t *testing.T, url string, encoding dlog_otel.Encoding) *dlog_otel.Writer {
+	writer, err := dlog_otel.NewWriter(
+		dlog_otel.Options{
+			URL:           url,
+			Encoding:      encoding,
+			ServiceName:   "api",
+			Headers:       map[string]string{"Authorization": "Bearer token"},
+			FlushInterval: time.Hour,
+			MinBackoff:    time.Millisecond,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
+
+// testSpan is a recording span that records its events.
+type testSpan struct {
+	trace.Span
+	events []*testSpanEvent
+	lock   sync.Mutex
+}
+
+type testSpanEvent struct {
+	name       string
+	attributes map[string]string
+}
+
+func (s *testSpan) IsRecording() bool {
+	return true
+}
+
+func (s *testSpan) AddEvent(name string, options ...trace.EventOption) {
+	attributes := make(map[string]string)
+	config := trace.NewEventConfig(options...)
+	for _, kv := range config.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.Emit()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, &testSpanEvent{name, attributes})
+}
+
+func (s *testSpan) Events() []*testSpanEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*testSpanEvent(nil), s.events...)
+}
+
+func newTestSpanContext() context.Context {
+	return trace.ContextWithSpanContext(
+		context.Background(),
+		trace.NewSpanContext(
+			trace.SpanContextConfig{
+				TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+				TraceFlags: trace.FlagsSampled,
+			},
+		),
+	)
+}
@@ -0,0 +1,36 @@
+package dlog_testing
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// decodeTestProtobuf decodes the fields of a protobuf message by field number,
+// with varints as their encoded bytes and fixed-size values as their little-endian bytes.
+func decodeTestProtobuf(t *testing.T, data []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		switch key & 7 {
+		case 0:
+			_, n := binary.Uvarint(data)
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:n])
+			data = data[n:]
+		case 1:
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:8])
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			data = data[n:]
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:length])
+			data = data[length:]
+		case 5:
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:4])
+			data = data[4:]
+		default:
+			t.Fatalf("unexpected wire type: %d", key&7)
+		}
+	}
+	return fields
+}
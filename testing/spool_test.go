@@ -0,0 +1,255 @@
+package dlog_testing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/spool"
+)
+
+func TestSpoolRecover(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	downstream := &testSpoolHandler{failing: true}
+	spool := newTestSpool(t, dir, downstream, dlog_spool.Options{})
+	defer func() { _ = spool.Close() }()
+	logger := dlog.NewEntryLogger(spool)
+	logger.WithField("count", 1).Infoln("one")
+	logger.Warnln("two")
+	logger.Errorln("three")
+	time.Sleep(50 * time.Millisecond)
+	if messages := downstream.Messages(); len(messages) != 0 {
+		t.Fatalf("expected no entries while failing, got %v", messages)
+	}
+	downstream.SetFailing(false)
+	messages := downstream.WaitMessages(t, 3)
+	checkSpoolMessages(t, messages, "one", "two", "three")
+	entry := downstream.Entries()[0]
+	if entry.Level != dlog.LevelInfo || entry.Fields["count"] != float64(1) || entry.Line == 0 {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestSpoolRestart(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	failing := &testSpoolHandler{failing: true}
+	spool := newTestSpool(t, dir, failing, dlog_spool.Options{SegmentSize: 256})
+	logger := dlog.NewEntryLogger(spool)
+	for i := 0; i < 10; i++ {
+		logger.Infof("message %d", i)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	downstream := &testSpoolHandler{}
+	spool = newTestSpool(t, dir, downstream, dlog_spool.Options{SegmentSize: 256})
+	messages := downstream.WaitMessages(t, 10)
+	for i, message := range messages {
+		if expected := fmt.Sprintf("message %d", i); message != expected {
+			t.Errorf("expected %s, got %s", expected, message)
+		}
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// sent Entries are not sent again
+	downstream = &testSpoolHandler{}
+	spool = newTestSpool(t, dir, downstream, dlog_spool.Options{SegmentSize: 256})
+	dlog.NewEntryLogger(spool).Infoln("after restart")
+	checkSpoolMessages(t, downstream.WaitMessages(t, 1), "after restart")
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if segments := testSpoolSegments(t, dir); len(segments) != 1 {
+		t.Errorf("expected sent segments to be deleted, got %v", segments)
+	}
+}
+
+func TestSpoolEvict(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	downstream := &testSpoolHandler{failing: true}
+	spool := newTestSpool(t, dir, downstream, dlog_spool.Options{SegmentSize: 512, MaxDiskSize: 1024})
+	defer func() { _ = spool.Close() }()
+	logger := dlog.NewEntryLogger(spool)
+	for i := 0; i < 100; i++ {
+		logger.Infof("message %d", i)
+	}
+	var size int64
+	for _, segment := range testSpoolSegments(t, dir) {
+		fileInfo, err := os.Stat(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += fileInfo.Size()
+	}
+	if size > 1024 {
+		t.Errorf("expected at most 1024 bytes of segments, got %d", size)
+	}
+	downstream.SetFailing(false)
+	messages := downstream.WaitMessages(t, 1)
+	for deadline := time.Now().Add(5 * time.Second); messages[len(messages)-1] != "message 99"; messages = downstream.Messages() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the newest entry to be sent, got %v", messages)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(messages) >= 100 {
+		t.Errorf("expected the oldest entries to be dropped, got %d entries", len(messages))
+	}
+}
+
+func TestSpoolFlusher(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	downstream := &testSpoolHandler{flushErrors: 2}
+	spool := newTestSpool(t, dir, downstream, dlog_spool.Options{})
+	defer func() { _ = spool.Close() }()
+	dlog.NewEntryLogger(spool).Infoln("hello")
+	// the Entry is sent again until Flush succeeds
+	checkSpoolMessages(t, downstream.WaitMessages(t, 3), "hello", "hello", "hello")
+}
+
+func TestSpoolRotateError(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	downstream := &testSpoolHandler{}
+	spool := newTestSpool(t, dir, downstream, dlog_spool.Options{SegmentSize: 64})
+	defer func() { _ = spool.Close() }()
+	// a directory in place of the next segment makes opening it fail
+	nextSegmentPath := filepath.Join(dir, fmt.Sprintf("%020d.seg", 2))
+	if err := os.Mkdir(nextSegmentPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Handle(&dlog.Entry{Time: time.Now(), Level: dlog.LevelInfo, Message: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Handle(&dlog.Entry{Time: time.Now(), Level: dlog.LevelInfo, Message: "two"}); err == nil {
+		t.Fatal("expected an error opening the next segment")
+	}
+	if err := os.Remove(nextSegmentPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Handle(&dlog.Entry{Time: time.Now(), Level: dlog.LevelInfo, Message: "three"}); err != nil {
+		t.Fatal(err)
+	}
+	checkSpoolMessages(t, downstream.WaitMessages(t, 2), "one", "three")
+}
+
+func TestSpoolUnencodableField(t *testing.T) {
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	downstream := &testSpoolHandler{}
+	spool := newTestSpool(t, dir, downstream, dlog_spool.Options{})
+	defer func() { _ = spool.Close() }()
+	if err := spool.Handle(
+		&dlog.Entry{
+			Time:    time.Now(),
+			Level:   dlog.LevelInfo,
+			Message: "one",
+			Fields:  map[string]interface{}{"ratio": math.NaN(), "count": 1},
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	checkSpoolMessages(t, downstream.WaitMessages(t, 1), "one")
+	if fields := downstream.Entries()[0].Fields; fields["ratio"] != "NaN" || fields["count"] != float64(1) {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+}
+
+type testSpoolHandler struct {
+	lock        sync.Mutex
+	failing     bool
+	flushErrors int
+	entries     []*dlog.Entry
+}
+
+func (h *testSpoolHandler) Handle(entry *dlog.Entry) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.failing {
+		return errors.New("failing")
+	}
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func (h *testSpoolHandler) Flush() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.flushErrors > 0 {
+		h.flushErrors--
+		return errors.New("flush failing")
+	}
+	return nil
+}
+
+func (h *testSpoolHandler) SetFailing(failing bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.failing = failing
+}
+
+func (h *testSpoolHandler) Entries() []*dlog.Entry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]*dlog.Entry(nil), h.entries...)
+}
+
+func (h *testSpoolHandler) Messages() []string {
+	var messages []string
+	for _, entry := range h.Entries() {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+func (h *testSpoolHandler) WaitMessages(t *testing.T, count int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if messages := h.Messages(); len(messages) >= count {
+			return messages
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d entries, got %v", count, h.Messages())
+	return nil
+}
+
+func newTestSpool(t *testing.T, dir string, downstream dlog.EntryHandler, options dlog_spool.Options) *dlog_spool.Spool {
+	options.MinBackoff = time.Millisecond
+	options.MaxBackoff = 10 * time.Millisecond
+	spool, err := dlog_spool.NewSpool(dir, downstream, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spool
+}
+
+func testSpoolSegments(t *testing.T, dir string) []string {
+	segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segments
+}
+
+func checkSpoolMessages(t *testing.T, messages []string, expected ...string) {
+	if len(messages) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, messages)
+	}
+	for i, message := range messages {
+		if message != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], message)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package dlog_testing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/dlogsql"
+)
+
+func TestSQL(t *testing.T) {
+	handler := &testEntryHandler{}
+	db := newTestSQLDB(dlog.NewEntryLogger(handler).AtLevel(dlog.LevelDebug), dlogsql.Options{SlowThreshold: 20 * time.Millisecond})
+	defer func() { _ = db.Close() }()
+	result, err := db.Exec("UPDATE things SET name = ? WHERE id = ?", "secret", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected != 2 {
+		t.Fatalf("unexpected rows affected: %d %v", rowsAffected, err)
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM things WHERE id = ?", 1).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "thing" {
+		t.Errorf("unexpected name: %s", name)
+	}
+	if _, err := db.Exec("SLOW"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("FAIL", 1); err == nil {
+		t.Fatal("expected error")
+	}
+	entries := handler.Entries()
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+	checkSQLEntry(t, entries[0], "UPDATE things SET name = ? WHERE id = ?", dlog.LevelDebug, 2)
+	if entries[0].Fields["rows_affected"] != int64(2) || entries[0].Fields["arg_values"] != nil {
+		t.Errorf("unexpected fields: %v", entries[0].Fields)
+	}
+	checkSQLEntry(t, entries[1], "SELECT name FROM things WHERE id = ?", dlog.LevelDebug, 1)
+	if _, ok := entries[1].Fields["rows_affected"]; ok {
+		t.Errorf("unexpected rows affected for query: %v", entries[1].Fields)
+	}
+	checkSQLEntry(t, entries[2], "SLOW", dlog.LevelWarn, 0)
+	checkSQLEntry(t, entries[3], "FAIL", dlog.LevelError, 1)
+	if entries[3].Fields["error"] == nil {
+		t.Errorf("expected error field: %v", entries[3].Fields)
+	}
+}
+
+func TestSQLTransaction(t *testing.T) {
+	handler := &testEntryHandler{}
+	db := newTestSQLDB(nil, dlogsql.Options{Level: dlog.LevelInfo, ArgValues: true})
+	defer func() { _ = db.Close() }()
+	// without a logger, the logger of the context is used
+	ctx := dlog.NewContext(context.Background(), dlog.NewEntryLogger(handler).With(dlog.String(dlog.RequestIDKey, "abc")))
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM things WHERE id = ?", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	entries := handler.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, query := range []string{"BEGIN", "DELETE FROM things WHERE id = ?", "COMMIT"} {
+		if entries[i].Fields["query"] != query || entries[i].Level != dlog.LevelInfo || entries[i].Fields[dlog.RequestIDKey] != "abc" {
+			t.Errorf("unexpected entry: %+v", entries[i])
+		}
+	}
+	if values, ok := entries[1].Fields["arg_values"].([]interface{}); !ok || len(values) != 1 || values[0] != int64(1) {
+		t.Errorf("unexpected arg values: %v", entries[1].Fields["arg_values"])
+	}
+}
+
+func TestSQLColumnConverter(t *testing.T) {
+	handler := &testEntryHandler{}
+	db := newTestSQLDB(dlog.NewEntryLogger(handler), dlogsql.Options{Level: dlog.LevelInfo, ArgValues: true})
+	defer func() { _ = db.Close() }()
+	stmt, err := db.Prepare("CONVERT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = stmt.Close() }()
+	// testSQLID is only supported by the driver.ColumnConverter of the driver.Stmt
+	if _, err := stmt.Exec(testSQLID{7}); err != nil {
+		t.Fatal(err)
+	}
+	entries := handler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if values, ok := entries[0].Fields["arg_values"].([]interface{}); !ok || len(values) != 1 || values[0] != int64(7) {
+		t.Errorf("unexpected arg values: %v", entries[0].Fields["arg_values"])
+	}
+}
+
+func checkSQLEntry(t *testing.T, entry *dlog.Entry, query string, level dlog.Level, args int) {
+	if entry.Message != dlogsql.QueryMessage || entry.Level != level || entry.Fields["query"] != query || entry.Fields["args"] != int64(args) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if _, ok := entry.Fields["duration"].(time.Duration); !ok {
+		t.Errorf("unexpected duration: %v", entry.Fields["duration"])
+	}
+}
+
+func newTestSQLDB(logger dlog.Logger, options dlogsql.Options) *sql.DB {
+	return sql.OpenDB(&testSQLConnector{dlogsql.Wrap(&testSQLDriver{}, logger, options)})
+}
+
+type testSQLConnector struct {
+	driver driver.Driver
+}
+
+func (c *testSQLConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c *testSQLConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// testSQLDriver is an in-memory driver with only the pre-context interfaces. Executions
+// fail for "FAIL", sleep for "SLOW", and affect as many rows as they have arguments.
+// Queries return a single row with the column "name".
+type testSQLDriver struct{}
+
+func (d *testSQLDriver) Open(string) (driver.Conn, error) {
+	return &testSQLConn{}, nil
+}
+
+type testSQLConn struct{}
+
+func (c *testSQLConn) Prepare(query string) (driver.Stmt, error) {
+	if query == "CONVERT" {
+		return &testSQLConverterStmt{&testSQLStmt{query}}, nil
+	}
+	return &testSQLStmt{query}, nil
+}
+
+func (c *testSQLConn) Close() error {
+	return nil
+}
+
+func (c *testSQLConn) Begin() (driver.Tx, error) {
+	return &testSQLTx{}, nil
+}
+
+// Exec implements driver.Execer, queries are prepared.
+func (c *testSQLConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return (&testSQLStmt{query}).Exec(args)
+}
+
+type testSQLStmt struct {
+	query string
+}
+
+func (s *testSQLStmt) Close() error {
+	return nil
+}
+
+func (s *testSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *testSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch s.query {
+	case "FAIL":
+		return nil, errors.New("failed")
+	case "SLOW":
+		time.Sleep(30 * time.Millisecond)
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *testSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT") {
+		return nil, errors.New("not a query")
+	}
+	return &testSQLRows{}, nil
+}
+
+// testSQLConverterStmt converts testSQLIDs to their int64 values.
+type testSQLConverterStmt struct {
+	*testSQLStmt
+}
+
+func (s *testSQLConverterStmt) ColumnConverter(int) driver.ValueConverter {
+	return s
+}
+
+func (s *testSQLConverterStmt) ConvertValue(value interface{}) (driver.Value, error) {
+	if id, ok := value.(testSQLID); ok {
+		return id.id, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(value)
+}
+
+type testSQLID struct {
+	id int64
+}
+
+type testSQLRows struct {
+	done bool
+}
+
+func (r *testSQLRows) Columns() []string {
+	return []string{"name"}
+}
+
+func (r *testSQLRows) Close() error {
+	return nil
+}
+
+func (r *testSQLRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = "thing"
+	return nil
+}
+
+type testSQLTx struct{}
+
+func (t *testSQLTx) Commit() error {
+	return nil
+}
+
+func (t *testSQLTx) Rollback() error {
+	return nil
+}
@@ -0,0 +1,294 @@
+package dlog_testing
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/syslog"
+)
+
+var (
+	testSyslogTime = time.Date(2017, 1, 2, 3, 4, 5, 6000, time.UTC)
+)
+
+func TestSyslogRFC5424UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	writer := newTestSyslogWriter(t, dlog_syslog.Options{Network: "udp", Address: conn.LocalAddr().String()})
+	defer func() { _ = writer.Close() }()
+	if err := writer.Handle(
+		&dlog.Entry{
+			Time:    testSyslogTime,
+			Level:   dlog.LevelWarn,
+			Message: "hello",
+			Fields:  map[string]interface{}{"b": `quote" bracket] slash\`, "a key=": 1},
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(
+		t,
+		readPacket(t, conn),
+		`<12>1 2017-01-02T03:04:05.000006Z host app `+strconv.Itoa(os.Getpid())+` - [dlog@32473 a_key_="1" b="quote\" bracket\] slash\\"] hello`,
+	)
+}
+
+func TestSyslogRFC3164UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	writer := newTestSyslogWriter(
+		t,
+		dlog_syslog.Options{
+			Network:  "udp",
+			Address:  conn.LocalAddr().String(),
+			Format:   dlog_syslog.FormatRFC3164,
+			Facility: dlog_syslog.FacilityLocal0,
+		},
+	)
+	defer func() { _ = writer.Close() }()
+	if err := writer.Handle(
+		&dlog.Entry{
+			Time:    testSyslogTime,
+			Level:   dlog.LevelError,
+			Message: "hello",
+			Fields:  map[string]interface{}{"a": "b c"},
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(t, readPacket(t, conn), `<131>Jan  2 03:04:05 host app[`+strconv.Itoa(os.Getpid())+`]: hello a="b c"`)
+}
+
+func TestSyslogTCPReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	writer := newTestSyslogWriter(t, dlog_syslog.Options{Network: "tcp", Address: listener.Addr().String()})
+	defer func() { _ = writer.Close() }()
+	logger := dlog_syslog.NewLogger(writer)
+	logger.Infoln("one")
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(t, readOctetCounted(t, bufio.NewReader(conn)), "one")
+	_ = conn.Close()
+	// writes to the closed connection may succeed before the close is noticed
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	for i := 0; ; i++ {
+		logger.Infoln("two")
+		select {
+		case conn := <-accepted:
+			defer func() { _ = conn.Close() }()
+			checkSyslogMessage(t, readOctetCounted(t, bufio.NewReader(conn)), "two")
+			return
+		case <-time.After(10 * time.Millisecond):
+			if i == 100 {
+				t.Fatal("writer did not reconnect")
+			}
+		}
+	}
+}
+
+func TestSyslogTLS(t *testing.T) {
+	certificate := newTestCertificate(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	certPool := x509.NewCertPool()
+	certPool.AddCert(certificate.Leaf)
+	writer := newTestSyslogWriter(
+		t,
+		dlog_syslog.Options{
+			Network:   "tls",
+			Address:   listener.Addr().String(),
+			TLSConfig: &tls.Config{RootCAs: certPool, ServerName: "127.0.0.1"},
+			Framing:   dlog_syslog.FramingNonTransparent,
+		},
+	)
+	defer func() { _ = writer.Close() }()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- writer.Handle(&dlog.Entry{Time: testSyslogTime, Level: dlog.LevelInfo, Message: "hello"})
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(t, strings.TrimSuffix(line, "\n"), "<14>1 2017-01-02T03:04:05.000006Z host app "+strconv.Itoa(os.Getpid())+" - - hello")
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on windows")
+	}
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	writer := newTestSyslogWriter(t, dlog_syslog.Options{Network: "unixgram", Address: path})
+	defer func() { _ = writer.Close() }()
+	dlog_syslog.NewLogger(writer).WithField("a", "b").Errorln("hello")
+	message := readPacket(t, conn)
+	if !strings.HasPrefix(message, "<11>1 ") || !strings.HasSuffix(message, ` [dlog@32473 a="b"] hello`) {
+		t.Errorf("unexpected message: %s", message)
+	}
+}
+
+func TestSyslogLocalStream(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on windows")
+	}
+	dir := testTempDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+	writer := newTestSyslogWriter(t, dlog_syslog.Options{Address: path})
+	defer func() { _ = writer.Close() }()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- writer.Handle(&dlog.Entry{Time: testSyslogTime, Level: dlog.LevelError, Message: "hello", Fields: map[string]interface{}{"a": "b"}})
+	}()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+	// the local daemon gets RFC 3164 terminated by a newline
+	checkSyslogMessage(t, strings.TrimSuffix(line, "\n"), "<11>Jan  2 03:04:05 host app["+strconv.Itoa(os.Getpid())+"]: hello a=b")
+}
+
+func newTestSyslogWriter(t *testing.T, options dlog_syslog.Options) *dlog_syslog.Writer {
+	options.Hostname = "host"
+	options.AppName = "app"
+	options.Timeout = 5 * time.Second
+	writer, err := dlog_syslog.NewWriter(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buffer[:n])
+}
+
+func readOctetCounted(t *testing.T, reader *bufio.Reader) string {
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, n)
+	if _, err := io.ReadFull(reader, buffer); err != nil {
+		t.Fatal(err)
+	}
+	return string(buffer)
+}
+
+// checkSyslogMessage checks the full message, or only the message
+// after the header and structured data if expected does not start with "<".
+func checkSyslogMessage(t *testing.T, message string, expected string) {
+	if !strings.HasPrefix(expected, "<") {
+		if !strings.HasSuffix(message, " - "+expected) {
+			t.Errorf("expected message %q, got %q", expected, message)
+		}
+		return
+	}
+	if message != expected {
+		t.Errorf("expected %q, got %q", expected, message)
+	}
+}
+
+func newTestCertificate(t *testing.T) tls.Certificate {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: privateKey, Leaf: leaf}
+}
@@ -2,3 +2,12 @@
 Package dlog_testing provides very basic testing for dlog.
 */
 package dlog_testing // import "go.pedge.io/dlog/testing"
+
+import (
+	"errors"
+)
+
+var (
+	// errTest is the error used by the tests of the adapters.
+	errTest = errors.New("test error")
+)
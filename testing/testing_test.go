@@ -5,11 +5,16 @@ import (
 	"testing"
 
 	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/apex"
 	"go.pedge.io/dlog/glog"
+	"go.pedge.io/dlog/gokit"
+	"go.pedge.io/dlog/hclog"
+	"go.pedge.io/dlog/klog"
 	"go.pedge.io/dlog/lion"
 	"go.pedge.io/dlog/log15"
 	"go.pedge.io/dlog/logrus"
 	"go.pedge.io/dlog/zap"
+	"go.pedge.io/dlog/zerolog"
 )
 
 func TestPrint(t *testing.T) {
@@ -17,12 +22,32 @@ func TestPrint(t *testing.T) {
 	testPrint(t)
 }
 
+func TestPrintApex(t *testing.T) {
+	dlog_apex.Register()
+	testPrint(t)
+}
+
 func TestPrintGlog(t *testing.T) {
 	_ = flag.Set("alsologtostderr", "true")
 	dlog_glog.Register()
 	testPrint(t)
 }
 
+func TestPrintGokit(t *testing.T) {
+	dlog_gokit.Register()
+	testPrint(t)
+}
+
+func TestPrintHclog(t *testing.T) {
+	dlog_hclog.Register()
+	testPrint(t)
+}
+
+func TestPrintKlog(t *testing.T) {
+	dlog_klog.Register()
+	testPrint(t)
+}
+
 func TestPrintLion(t *testing.T) {
 	dlog_lion.Register()
 	testPrint(t)
@@ -43,7 +68,14 @@ func TestPrintZap(t *testing.T) {
 	testPrint(t)
 }
 
+func TestPrintZerolog(t *testing.T) {
+	dlog_zerolog.Register()
+	testPrint(t)
+}
+
 func testPrint(t *testing.T) {
 	dlog.WithField("key", "value").WithField("int", 1).Infof("number %d", 2)
 	dlog.Warnln("warning line")
+	dlog.Tracef("trace %d", 3)
+	dlog.Logln(dlog.LevelError, "error line")
 }
@@ -0,0 +1,78 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.pedge.io/dlog"
+)
+
+func TestRedirectStdLog(t *testing.T) {
+	handler := &testEntryHandler{}
+	dlog.SetLogger(dlog.NewEntryLogger(handler))
+	defer dlog.Register()
+	log.SetPrefix("prefix: ")
+	defer log.SetPrefix("")
+	restore := dlog.RedirectStdLog(dlog.LevelWarn)
+	log.Printf("hello %s", "world")
+	restore()
+	if log.Prefix() != "prefix: " {
+		t.Errorf("expected the prefix to be restored, got %q", log.Prefix())
+	}
+	entries := handler.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Message != "hello world" || entry.Level != dlog.LevelWarn {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if filepath.Base(entry.File) != "writer_test.go" || entry.Line != 21 {
+		t.Errorf("expected caller writer_test.go:21, got %s:%d", entry.File, entry.Line)
+	}
+}
+
+func TestRedirectStdLogStdLogger(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	dlog.SetLogger(dlog.NewStdLogger(log.New(buffer, "", 0)))
+	defer dlog.Register()
+	restore := dlog.RedirectStdLog(dlog.LevelInfo)
+	log.Printf("hello %d", 1)
+	log.Println("hello", 2)
+	restore()
+	if expected := "hello 1\nhello 2\n"; buffer.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buffer.String())
+	}
+}
+
+func TestWriter(t *testing.T) {
+	handler := &testEntryHandler{}
+	writer := dlog.NewWriter(dlog.NewEntryLogger(handler), dlog.LevelError)
+	for _, data := range []string{"a\nb", "c\n\n", "d\r\n", strings.Repeat("x", 70*1024) + "\n", "e"} {
+		if _, err := fmt.Fprint(writer, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fmt.Fprint(writer, "f\n"); err != dlog.ErrWriterClosed {
+		t.Errorf("expected ErrWriterClosed, got %v", err)
+	}
+	entries := handler.Entries()
+	var messages []string
+	for _, entry := range entries {
+		if entry.Level != dlog.LevelError {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+		messages = append(messages, entry.Message)
+	}
+	expected := []string{"a", "bc", "d", strings.Repeat("x", 64*1024), strings.Repeat("x", 6*1024), "e"}
+	if strings.Join(messages, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %d messages, got %d: %.50q", len(expected), len(messages), messages)
+	}
+}
@@ -0,0 +1,65 @@
+package dlog_testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.pedge.io/dlog"
+	"go.pedge.io/dlog/zerolog"
+)
+
+func TestZerolog(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	logger := dlog_zerolog.NewLogger(zerolog.New(buffer).Level(zerolog.InfoLevel))
+	logger.With(
+		dlog.String("string", "value"),
+		dlog.Int("int", 1),
+		dlog.Duration("duration", 1500*time.Millisecond),
+		dlog.Err(errTest),
+	).WithFields(map[string]interface{}{"any": []int{1, 2}}).Warnln("message")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buffer.String())
+	}
+	for key, expected := range map[string]interface{}{
+		"message":  "message",
+		"level":    "warn",
+		"string":   "value",
+		"int":      float64(1),
+		"duration": float64(1500),
+		"error":    "test error",
+	} {
+		if entry[key] != expected {
+			t.Errorf("expected %v for %s, got %v", expected, key, entry[key])
+		}
+	}
+	// AtLevel does not change the parent Logger
+	buffer.Reset()
+	traceLogger := logger.AtLevel(dlog.LevelTrace)
+	logger.Traceln("dropped")
+	traceLogger.Logln(dlog.LevelTrace, "trace")
+	if s := buffer.String(); strings.Contains(s, "dropped") || !strings.Contains(s, `"level":"trace"`) {
+		t.Errorf("unexpected output: %s", s)
+	}
+	if logger.Enabled(dlog.LevelDebug) || !traceLogger.Enabled(dlog.LevelTrace) {
+		t.Error("expected AtLevel to return a new Logger")
+	}
+}
+
+func TestZerologPanic(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	logger := dlog_zerolog.NewLogger(zerolog.New(buffer))
+	defer func() {
+		if recovered := recover(); recovered != "boom 1" {
+			t.Errorf("expected panic, got %v", recovered)
+		}
+		if !strings.Contains(buffer.String(), `"level":"panic"`) {
+			t.Errorf("unexpected output: %s", buffer.String())
+		}
+	}()
+	logger.Panicf("boom %d", 1)
+}
@@ -7,14 +7,27 @@ package dlog_zap
 
 import (
 	"errors"
+	"time"
 
 	"go.pedge.io/dlog"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
 	// ErrCannotSetZapLevel is the error which is used to panic if AtLevel is called.
 	ErrCannotSetZapLevel = errors.New("cannot set zap level")
+
+	levelToZapLevel = map[dlog.Level]zapcore.Level{
+		dlog.LevelNone:  zapcore.InfoLevel,
+		dlog.LevelTrace: zapcore.DebugLevel,
+		dlog.LevelDebug: zapcore.DebugLevel,
+		dlog.LevelInfo:  zapcore.InfoLevel,
+		dlog.LevelWarn:  zapcore.WarnLevel,
+		dlog.LevelError: zapcore.ErrorLevel,
+		dlog.LevelFatal: zapcore.FatalLevel,
+		dlog.LevelPanic: zapcore.PanicLevel,
+	}
 )
 
 // Register registers the default zap Logger as the dlog Logger.
@@ -23,16 +36,27 @@ func Register() {
 }
 
 // NewLogger returns a new dlog.Logger for the given zap.SugaredLogger.
+//
+// zap has no trace level, so dlog.LevelTrace is logged at the debug level.
+// Custom Levels are logged at the zap level for dlog.StandardLevel(level).
+//
+// dlog.Lazy field values are translated to zapcore.ObjectMarshalers that are
+// only added to the zap.SugaredLogger when an entry is logged.
 func NewLogger(zapSugaredLogger *zap.SugaredLogger) dlog.Logger {
-	return newLogger(zapSugaredLogger)
+	return newLogger(zapSugaredLogger, nil)
 }
 
 type logger struct {
 	*zap.SugaredLogger
+	lazyFields []zap.Field
 }
 
-func newLogger(l *zap.SugaredLogger) *logger {
-	return &logger{l}
+func newLogger(l *zap.SugaredLogger, lazyFields []zap.Field) *logger {
+	return &logger{l, lazyFields}
+}
+
+func (l *logger) Enabled(level dlog.Level) bool {
+	return l.SugaredLogger.Desugar().Core().Enabled(levelToZapLevel[dlog.StandardLevel(level)])
 }
 
 func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
@@ -41,49 +65,142 @@ func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
 }
 
 func (l *logger) WithField(key string, value interface{}) dlog.Logger {
-	return newLogger(l.SugaredLogger.With(key, value))
+	return l.WithFields(map[string]interface{}{key: value})
 }
 
 func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
-	args := make([]interface{}, len(fields)*2)
-	i := 0
+	args := make([]interface{}, 0, len(fields)*2)
+	lazyFields := l.lazyFields
 	for key, value := range fields {
-		args[i] = key
-		i++
-		args[i] = value
-		i++
+		if lazy, ok := value.(dlog.Lazy); ok {
+			lazyFields = append(lazyFields[:len(lazyFields):len(lazyFields)], zap.Inline(&lazyMarshaler{key, lazy}))
+			continue
+		}
+		args = append(args, key, value)
+	}
+	return newLogger(l.SugaredLogger.With(args...), lazyFields)
+}
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	zapFields := make([]zap.Field, 0, len(fields))
+	lazyFields := l.lazyFields
+	for _, field := range fields {
+		if lazy, ok := field.Interface.(dlog.Lazy); ok && field.Type == dlog.FieldTypeAny {
+			lazyFields = append(lazyFields[:len(lazyFields):len(lazyFields)], zap.Inline(&lazyMarshaler{field.Key, lazy}))
+			continue
+		}
+		zapFields = append(zapFields, zapField(field))
 	}
-	return newLogger(l.SugaredLogger.With(args...))
+	return newLogger(l.SugaredLogger.Desugar().With(zapFields...).Sugar(), lazyFields)
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.sugaredLogger(zapcore.DebugLevel).Debugf(format, args...)
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.sugaredLogger(zapcore.DebugLevel).Debug(args...)
+}
+
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.sugaredLogger(zapcore.DebugLevel).Debugf(format, args...)
 }
 
 func (l *logger) Debugln(args ...interface{}) {
-	l.SugaredLogger.Debug(args...)
+	l.sugaredLogger(zapcore.DebugLevel).Debug(args...)
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.sugaredLogger(zapcore.InfoLevel).Infof(format, args...)
 }
 
 func (l *logger) Infoln(args ...interface{}) {
-	l.SugaredLogger.Info(args...)
+	l.sugaredLogger(zapcore.InfoLevel).Info(args...)
+}
+
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.sugaredLogger(zapcore.WarnLevel).Warnf(format, args...)
 }
 
 func (l *logger) Warnln(args ...interface{}) {
-	l.SugaredLogger.Warn(args...)
+	l.sugaredLogger(zapcore.WarnLevel).Warn(args...)
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.sugaredLogger(zapcore.ErrorLevel).Errorf(format, args...)
 }
 
 func (l *logger) Errorln(args ...interface{}) {
-	l.SugaredLogger.Error(args...)
+	l.sugaredLogger(zapcore.ErrorLevel).Error(args...)
+}
+
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	l.sugaredLogger(zapcore.FatalLevel).Fatalf(format, args...)
 }
 
 func (l *logger) Fatalln(args ...interface{}) {
-	l.SugaredLogger.Fatal(args...)
+	l.sugaredLogger(zapcore.FatalLevel).Fatal(args...)
+}
+
+func (l *logger) Panicf(format string, args ...interface{}) {
+	l.sugaredLogger(zapcore.PanicLevel).Panicf(format, args...)
 }
 
 func (l *logger) Panicln(args ...interface{}) {
-	l.SugaredLogger.Panic(args...)
+	l.sugaredLogger(zapcore.PanicLevel).Panic(args...)
 }
 
 func (l *logger) Printf(format string, args ...interface{}) {
-	l.SugaredLogger.Infof(format, args...)
+	l.sugaredLogger(zapcore.InfoLevel).Infof(format, args...)
 }
 
 func (l *logger) Println(args ...interface{}) {
-	l.SugaredLogger.Info(args...)
+	l.sugaredLogger(zapcore.InfoLevel).Info(args...)
+}
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	dlog.BaseLogf(l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	dlog.BaseLogln(l, level, args...)
+}
+
+// sugaredLogger returns the zap.SugaredLogger with the lazy fields added
+// if an entry at the given zap level will be logged.
+func (l *logger) sugaredLogger(zapLevel zapcore.Level) *zap.SugaredLogger {
+	if len(l.lazyFields) == 0 || !l.SugaredLogger.Desugar().Core().Enabled(zapLevel) {
+		return l.SugaredLogger
+	}
+	return l.SugaredLogger.Desugar().With(l.lazyFields...).Sugar()
+}
+
+// lazyMarshaler is a zapcore.ObjectMarshaler that adds the evaluated
+// dlog.Lazy value under its key when inlined.
+type lazyMarshaler struct {
+	key  string
+	lazy dlog.Lazy
+}
+
+func (m *lazyMarshaler) MarshalLogObject(objectEncoder zapcore.ObjectEncoder) error {
+	return objectEncoder.AddReflected(m.key, m.lazy())
+}
+
+// zapField maps the dlog.Field directly to a zap.Field.
+func zapField(field dlog.Field) zap.Field {
+	switch field.Type {
+	case dlog.FieldTypeString:
+		return zap.String(field.Key, field.String)
+	case dlog.FieldTypeInt:
+		return zap.Int64(field.Key, field.Integer)
+	case dlog.FieldTypeDuration:
+		return zap.Duration(field.Key, time.Duration(field.Integer))
+	case dlog.FieldTypeError:
+		if err, ok := field.Interface.(error); ok {
+			return zap.NamedError(field.Key, err)
+		}
+		return zap.Skip()
+	default:
+		return zap.Any(field.Key, field.Interface)
+	}
 }
@@ -0,0 +1,227 @@
+/*
+Package dlog_zerolog provides zerolog functionality for dlog.
+
+https://github.com/rs/zerolog
+*/
+package dlog_zerolog // import "go.pedge.io/dlog/zerolog"
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	zerologlog "github.com/rs/zerolog/log"
+	"go.pedge.io/dlog"
+)
+
+var (
+	levelToZerologLevel = map[dlog.Level]zerolog.Level{
+		dlog.LevelNone:  zerolog.InfoLevel,
+		dlog.LevelTrace: zerolog.TraceLevel,
+		dlog.LevelDebug: zerolog.DebugLevel,
+		dlog.LevelInfo:  zerolog.InfoLevel,
+		dlog.LevelWarn:  zerolog.WarnLevel,
+		dlog.LevelError: zerolog.ErrorLevel,
+		dlog.LevelFatal: zerolog.FatalLevel,
+		dlog.LevelPanic: zerolog.PanicLevel,
+	}
+)
+
+func init() {
+	dlog.RegisterBackend(
+		"zerolog",
+		func() dlog.Logger {
+			return NewLogger(zerolog.New(os.Stderr).With().Timestamp().Logger())
+		},
+	)
+}
+
+// Register registers the global zerolog Logger as the dlog Logger.
+func Register() {
+	dlog.SetLogger(NewLogger(zerologlog.Logger))
+}
+
+// NewLogger returns a new dlog.Logger that uses the zerolog.Logger.
+//
+// AtLevel returns a new dlog.Logger with the zerolog.Logger at the level, and does
+// not change the zerolog.Logger. Custom Levels are logged at the zerolog level for
+// dlog.StandardLevel(level). Fatal entries exit and panic entries panic after they
+// are logged, even if their level is disabled.
+//
+// dlog.Lazy field values are only evaluated and added to entries that are logged.
+func NewLogger(zerologLogger zerolog.Logger) dlog.Logger {
+	return newLogger(zerologLogger, nil)
+}
+
+type logger struct {
+	l          zerolog.Logger
+	lazyFields []lazyField
+}
+
+type lazyField struct {
+	key  string
+	lazy dlog.Lazy
+}
+
+func newLogger(l zerolog.Logger, lazyFields []lazyField) *logger {
+	return &logger{l, lazyFields}
+}
+
+func (l *logger) Enabled(level dlog.Level) bool {
+	zerologLevel := levelToZerologLevel[dlog.StandardLevel(level)]
+	return zerologLevel >= l.l.GetLevel() && zerologLevel >= zerolog.GlobalLevel()
+}
+
+func (l *logger) AtLevel(level dlog.Level) dlog.Logger {
+	return newLogger(l.l.Level(levelToZerologLevel[dlog.StandardLevel(level)]), l.lazyFields)
+}
+
+func (l *logger) WithField(key string, value interface{}) dlog.Logger {
+	return l.WithFields(map[string]interface{}{key: value})
+}
+
+func (l *logger) WithFields(fields map[string]interface{}) dlog.Logger {
+	lazyFields := l.lazyFields
+	var nonLazyFields map[string]interface{}
+	for key, value := range fields {
+		if lazy, ok := value.(dlog.Lazy); ok {
+			lazyFields = append(lazyFields[:len(lazyFields):len(lazyFields)], lazyField{key, lazy})
+			continue
+		}
+		if nonLazyFields == nil {
+			nonLazyFields = make(map[string]interface{}, len(fields))
+		}
+		nonLazyFields[key] = value
+	}
+	if nonLazyFields == nil {
+		return newLogger(l.l, lazyFields)
+	}
+	return newLogger(l.l.With().Fields(nonLazyFields).Logger(), lazyFields)
+}
+
+func (l *logger) With(fields ...dlog.Field) dlog.Logger {
+	context := l.l.With()
+	lazyFields := l.lazyFields
+	for _, field := range fields {
+		switch field.Type {
+		case dlog.FieldTypeString:
+			context = context.Str(field.Key, field.String)
+		case dlog.FieldTypeInt:
+			context = context.Int64(field.Key, field.Integer)
+		case dlog.FieldTypeDuration:
+			context = context.Dur(field.Key, time.Duration(field.Integer))
+		case dlog.FieldTypeError:
+			if err, ok := field.Interface.(error); ok {
+				context = context.AnErr(field.Key, err)
+			}
+		default:
+			if lazy, ok := field.Interface.(dlog.Lazy); ok {
+				lazyFields = append(lazyFields[:len(lazyFields):len(lazyFields)], lazyField{field.Key, lazy})
+				continue
+			}
+			context = context.Interface(field.Key, field.Interface)
+		}
+	}
+	return newLogger(context.Logger(), lazyFields)
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.log(zerolog.TraceLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Traceln(args ...interface{}) {
+	l.log(zerolog.TraceLevel, fmt.Sprint(args...))
+}
+
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.log(zerolog.DebugLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Debugln(args ...interface{}) {
+	l.log(zerolog.DebugLevel, fmt.Sprint(args...))
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.log(zerolog.InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Infoln(args ...interface{}) {
+	l.log(zerolog.InfoLevel, fmt.Sprint(args...))
+}
+
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.log(zerolog.WarnLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Warnln(args ...interface{}) {
+	l.log(zerolog.WarnLevel, fmt.Sprint(args...))
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.log(zerolog.ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Errorln(args ...interface{}) {
+	l.log(zerolog.ErrorLevel, fmt.Sprint(args...))
+}
+
+func (l *logger) Fatalf(format string, args ...interface{}) {
+	l.log(zerolog.FatalLevel, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (l *logger) Fatalln(args ...interface{}) {
+	l.log(zerolog.FatalLevel, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+func (l *logger) Panicf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	l.log(zerolog.PanicLevel, message)
+	panic(message)
+}
+
+func (l *logger) Panicln(args ...interface{}) {
+	message := fmt.Sprint(args...)
+	l.log(zerolog.PanicLevel, message)
+	panic(message)
+}
+
+func (l *logger) Printf(format string, args ...interface{}) {
+	l.log(zerolog.InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *logger) Println(args ...interface{}) {
+	l.log(zerolog.InfoLevel, fmt.Sprint(args...))
+}
+
+func (l *logger) Logf(level dlog.Level, format string, args ...interface{}) {
+	// dlog.BaseLogf logs dlog.LevelTrace at the debug level, but zerolog has a trace level
+	if dlog.StandardLevel(level) == dlog.LevelTrace {
+		l.Tracef(format, args...)
+		return
+	}
+	dlog.BaseLogf(l, level, format, args...)
+}
+
+func (l *logger) Logln(level dlog.Level, args ...interface{}) {
+	if dlog.StandardLevel(level) == dlog.LevelTrace {
+		l.Traceln(args...)
+		return
+	}
+	dlog.BaseLogln(l, level, args...)
+}
+
+// log logs the message with WithLevel, which unlike Fatal and Panic
+// does not exit or panic, so that the dlog.Logger methods do.
+func (l *logger) log(zerologLevel zerolog.Level, message string) {
+	event := l.l.WithLevel(zerologLevel)
+	if !event.Enabled() {
+		return
+	}
+	for _, lazyField := range l.lazyFields {
+		event = event.Interface(lazyField.key, lazyField.lazy())
+	}
+	event.Msg(message)
+}